@@ -0,0 +1,52 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrCompleted means the buyer finished checkout before the session could be
+// expired, so the payment will still arrive.
+var ErrCompleted = errors.New("checkout session already completed")
+
+// Expirer closes a checkout session so the buyer can no longer pay through it.
+// Expiring a session that has already expired succeeds.
+type Expirer interface {
+	Expire(ctx context.Context, sessionId string) error
+}
+
+var (
+	mu       sync.RWMutex
+	provider Expirer
+)
+
+// Provider returns the configured expirer: Stripe unless CHECKOUT_PROVIDER is
+// set to "fake".
+func Provider() Expirer {
+	mu.RLock()
+	current := provider
+	mu.RUnlock()
+	if current != nil {
+		return current
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		if os.Getenv("CHECKOUT_PROVIDER") == "fake" {
+			provider = NewFake()
+		} else {
+			provider = NewStripe(os.Getenv("STRIPE_SECRET_KEY"))
+		}
+	}
+	return provider
+}
+
+// SetProvider swaps the expirer, for tests and local development.
+func SetProvider(expirer Expirer) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = expirer
+}
@@ -0,0 +1,34 @@
+package checkout
+
+import (
+	"context"
+	"sync"
+)
+
+// Fake expires sessions in memory. Add a session ID to Completed to mimic a
+// buyer who already paid, or set Err to make expiry fail.
+type Fake struct {
+	mu        sync.Mutex
+	Expired   []string
+	Completed map[string]bool
+	Err       error
+}
+
+func NewFake() *Fake {
+	return &Fake{Completed: map[string]bool{}}
+}
+
+func (f *Fake) Expire(ctx context.Context, sessionId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.Completed[sessionId] {
+		return ErrCompleted
+	}
+
+	f.Expired = append(f.Expired, sessionId)
+	return nil
+}
@@ -0,0 +1,49 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/client"
+)
+
+type Stripe struct {
+	api *client.API
+}
+
+func NewStripe(secretKey string) *Stripe {
+	if secretKey == "" {
+		return &Stripe{}
+	}
+	return &Stripe{api: client.New(secretKey, nil)}
+}
+
+func (s *Stripe) Expire(ctx context.Context, sessionId string) error {
+	if s.api == nil {
+		return errors.New("Stripe secret key not configured")
+	}
+
+	params := &stripe.CheckoutSessionExpireParams{}
+	params.Context = ctx
+	_, err := s.api.CheckoutSessions.Expire(sessionId, params)
+	if err == nil {
+		return nil
+	}
+
+	// Stripe only expires open sessions; find out which way this one closed.
+	getParams := &stripe.CheckoutSessionParams{}
+	getParams.Context = ctx
+	session, getErr := s.api.CheckoutSessions.Get(sessionId, getParams)
+	if getErr != nil {
+		return err
+	}
+	switch session.Status {
+	case stripe.CheckoutSessionStatusExpired:
+		return nil
+	case stripe.CheckoutSessionStatusComplete:
+		return ErrCompleted
+	}
+	return fmt.Errorf("expiring checkout session %s: %v", sessionId, err)
+}
@@ -0,0 +1,31 @@
+// Command migrate-email-verified marks users created before email
+// verification existed as verified, using their creation time, so they are
+// not locked out of products, transactions and withdrawals. Users who signed
+// up since then store an explicit null and are left alone.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"user-athentication-golang/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	collection := database.OpenCollection(database.Client, "user")
+	result, err := collection.UpdateMany(ctx,
+		bson.M{"email_verified_at": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{"email_verified_at": "$created_at"}}},
+	)
+	if err != nil {
+		log.Fatalf("user.email_verified_at: %v", err)
+	}
+	fmt.Printf("user.email_verified_at: %d documents marked verified\n", result.ModifiedCount)
+}
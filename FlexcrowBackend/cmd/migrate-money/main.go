@@ -0,0 +1,103 @@
+// Command migrate-money rewrites money fields stored as plain floats into the
+// {amount, currency} documents used by models.Money. It is safe to run more
+// than once: documents that are already converted are skipped.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var moneyFields = map[string][]string{
+	"user":        {"balance"},
+	"product":     {"price"},
+	"payment":     {"amount", "refunded_amount"},
+	"withdrawal":  {"amount"},
+	"transaction": {"fee", "shipping_price", "amount_buyer", "amount_seller"},
+	"ledger":      {"amount"},
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	for name, fields := range moneyFields {
+		collection := database.OpenCollection(database.Client, name)
+		for _, field := range fields {
+			count, err := migrateField(ctx, collection, field)
+			if err != nil {
+				log.Fatalf("%s.%s: %v", name, field, err)
+			}
+			fmt.Printf("%s.%s: %d documents converted\n", name, field, count)
+		}
+	}
+
+	count, err := migrateFeeTiers(ctx, database.OpenCollection(database.Client, "fee_schedule"))
+	if err != nil {
+		log.Fatalf("fee_schedule.tiers: %v", err)
+	}
+	fmt.Printf("fee_schedule.tiers: %d documents converted\n", count)
+}
+
+func migrateField(ctx context.Context, collection *mongo.Collection, field string) (int, error) {
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$type": "number"}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		legacy := cursor.Current.Lookup(field)
+
+		var value models.Money
+		if err := value.UnmarshalBSONValue(legacy.Type, legacy.Value); err != nil {
+			return count, err
+		}
+
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"_id": id, field: bson.M{"$type": "number"}},
+			bson.M{"$set": bson.M{field: value}},
+		)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
+
+func migrateFeeTiers(ctx context.Context, collection *mongo.Collection) (int, error) {
+	cursor, err := collection.Find(ctx, bson.M{"tiers.above": bson.M{"$type": "number"}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var schedule models.FeeSchedule
+		if err := cursor.Decode(&schedule); err != nil {
+			return count, err
+		}
+
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"_id": schedule.ID},
+			bson.M{"$set": bson.M{"tiers": schedule.Tiers}},
+		)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
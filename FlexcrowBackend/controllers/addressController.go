@@ -13,8 +13,8 @@ import (
 
 	"user-athentication-golang/database"
 
-	helper "user-athentication-golang/helpers"
 	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -48,14 +48,8 @@ func GetAddresses() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
 		var matchStage bson.D
-		if userType == "ADMIN" {
+		if can(c, policy.ActionList, policy.Address{}) {
 			queryUserId := c.Query("user_id")
 			if queryUserId != "" {
 				matchStage = bson.D{{"$match", bson.D{{"user_id", queryUserId}}}}
@@ -115,26 +109,18 @@ func GetAddress() gin.HandlerFunc {
 			return
 		}
 
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
-			return
-		}
-
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		transactionParam := c.Query("transaction")
-
-		if userType != "ADMIN" {
-			if (*address.User_id != userId.(string) && transactionParam != "true") || (address.Status != nil && *address.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to view this address"})
+		// Sellers may see the addresses they ship to.
+		resource := policy.AddressOf(address)
+		if !can(c, policy.ActionRead, resource) {
+			resource.Party_ids, err = transactionParties(ctx, "address_id", addressId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking access"})
 				return
 			}
 		}
+		if !authorize(c, policy.ActionRead, resource) {
+			return
+		}
 
 		c.JSON(http.StatusOK, address)
 	}
@@ -158,11 +144,7 @@ func CreateAddress() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
+		canManage := can(c, policy.ActionManage, policy.Address{})
 
 		userId, exists := c.Get("uid")
 		if !exists {
@@ -170,7 +152,7 @@ func CreateAddress() gin.HandlerFunc {
 			return
 		}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			userIdStr := userId.(string)
 			address.User_id = &userIdStr
 		} else {
@@ -198,7 +180,7 @@ func CreateAddress() gin.HandlerFunc {
 		address.ID = primitive.NewObjectID()
 		address.Address_id = address.ID.Hex()
 
-		resultInsertionNumber, insertErr := addressCollection.InsertOne(ctx, address)
+		resultInsertionNumber, insertErr := auditedInsert(ctx, addressCollection, address, auditEntry(c, "address.created", "address", address.Address_id, nil, address, nil))
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create address"})
 			return
@@ -225,24 +207,11 @@ func UpdateAddress() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+		resource := policy.AddressOf(existingAddress)
+		if !authorize(c, policy.ActionUpdate, resource) {
 			return
 		}
-
-		if userType != "ADMIN" {
-			if *existingAddress.User_id != userId.(string) || (existingAddress.Status != nil && *existingAddress.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this address"})
-				return
-			}
-		}
+		canManage := can(c, policy.ActionManage, resource)
 
 		var updateData models.Address
 		if err := c.BindJSON(&updateData); err != nil {
@@ -252,7 +221,7 @@ func UpdateAddress() gin.HandlerFunc {
 
 		update := bson.M{}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			updateData.User_id = nil
 			updateData.Status = nil
 		}
@@ -260,7 +229,7 @@ func UpdateAddress() gin.HandlerFunc {
 		if updateData.Name != nil {
 			update["name"] = updateData.Name
 		}
-		if updateData.Status != nil && userType == "ADMIN" {
+		if updateData.Status != nil && canManage {
 			update["status"] = updateData.Status
 		}
 		if updateData.Type != nil {
@@ -296,18 +265,19 @@ func UpdateAddress() gin.HandlerFunc {
 
 		update["updated_at"] = time.Now().Format(time.RFC3339)
 
-		result, err := addressCollection.UpdateOne(
+		result, err := auditedUpdate(
 			ctx,
+			addressCollection,
 			bson.M{"address_id": addressId},
 			bson.M{"$set": update},
+			auditEntry(c, "address.updated", "address", addressId, existingAddress, update, nil),
 		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update address"})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update address"})
 			return
 		}
 
@@ -317,8 +287,7 @@ func UpdateAddress() gin.HandlerFunc {
 
 func DeleteAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionDelete, policy.Address{}) {
 			return
 		}
 
@@ -326,7 +295,7 @@ func DeleteAddress() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		result, err := addressCollection.DeleteOne(ctx, bson.M{"address_id": addressId})
+		result, err := auditedDelete(ctx, c, addressCollection, bson.M{"address_id": addressId}, "address.deleted", "address", addressId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete address"})
 			return
@@ -353,43 +322,29 @@ func RemoveAddress() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
+		if !authorize(c, policy.ActionRemove, policy.AddressOf(existingAddress)) {
 			return
 		}
 
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
-			return
-		}
-
-		if userType != "ADMIN" {
-			if *existingAddress.User_id != userId.(string) || (existingAddress.Status != nil && *existingAddress.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to remove this address"})
-				return
-			}
-		}
-
 		status := 2
 		update := bson.M{
 			"status":     status,
 			"updated_at": time.Now().Format(time.RFC3339),
 		}
 
-		result, err := addressCollection.UpdateOne(
+		result, err := auditedUpdate(
 			ctx,
+			addressCollection,
 			bson.M{"address_id": addressId},
 			bson.M{"$set": update},
+			auditEntry(c, "address.removed", "address", addressId, existingAddress, update, nil),
 		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove address"})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove address"})
 			return
 		}
 
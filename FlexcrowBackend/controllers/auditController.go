@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "audit")
+
+// auditSource is who made the request: the signed-in user, their address and
+// the request id, for helpers that write their own audit records.
+func auditSource(c *gin.Context) helper.AuditSource {
+	return helper.AuditSource{
+		Actor:      c.GetString("uid"),
+		Ip_address: c.ClientIP(),
+		Request_id: c.GetString("request_id"),
+	}
+}
+
+// auditEntry describes a write made by the signed-in user. before and after
+// are the record as it was and as it now is, or the fields just set; either
+// may be nil for creates and deletes.
+func auditEntry(c *gin.Context, action string, resourceType string, resourceId string, before interface{}, after interface{}, details map[string]interface{}) helper.AuditEntry {
+	return auditSource(c).Entry(action, resourceType, resourceId, helper.AuditDiff(before, after), details)
+}
+
+// audited runs write and appends entry in one transaction, so a write is
+// never kept without its audit record. write returns an error, such as
+// mongo.ErrNoDocuments when nothing matched, to skip the record.
+func audited(ctx context.Context, entry helper.AuditEntry, write func(sessCtx mongo.SessionContext) error) error {
+	return helper.RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if err := write(sessCtx); err != nil {
+			return err
+		}
+		return helper.AppendAudit(sessCtx, entry)
+	})
+}
+
+// auditedDelete deletes the record matching filter and, in the same
+// transaction, audits it with the contents it had.
+func auditedDelete(ctx context.Context, c *gin.Context, collection *mongo.Collection, filter bson.M, action string, resourceType string, resourceId string) (*mongo.DeleteResult, error) {
+	var result *mongo.DeleteResult
+	err := helper.RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		var existing bson.M
+		err := collection.FindOne(sessCtx, filter).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			result = &mongo.DeleteResult{}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err = collection.DeleteOne(sessCtx, filter)
+		if err != nil {
+			return err
+		}
+		return helper.AppendAudit(sessCtx, auditEntry(c, action, resourceType, resourceId, existing, nil, nil))
+	})
+	return result, err
+}
+
+// auditedInsert inserts document and appends entry in the same transaction.
+func auditedInsert(ctx context.Context, collection *mongo.Collection, document interface{}, entry helper.AuditEntry) (*mongo.InsertOneResult, error) {
+	var result *mongo.InsertOneResult
+	err := audited(ctx, entry, func(sessCtx mongo.SessionContext) error {
+		var err error
+		result, err = collection.InsertOne(sessCtx, document)
+		return err
+	})
+	return result, err
+}
+
+// auditedUpdate applies update to the record matching filter and appends
+// entry in the same transaction. It returns mongo.ErrNoDocuments, and writes
+// no record, when nothing matched.
+func auditedUpdate(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}, entry helper.AuditEntry) (*mongo.UpdateResult, error) {
+	var result *mongo.UpdateResult
+	err := audited(ctx, entry, func(sessCtx mongo.SessionContext) error {
+		var err error
+		result, err = collection.UpdateOne(sessCtx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return nil
+	})
+	return result, err
+}
+
+func GetAuditRecords() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		match := bson.M{}
+		for _, field := range []string{"action", "actor", "resource_type", "resource_id", "ip_address", "request_id"} {
+			if value := c.Query(field); value != "" {
+				match[field] = value
+			}
+		}
+		createdAt := bson.M{}
+		if from, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+			createdAt["$gte"] = from
+		}
+		if to, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+			createdAt["$lt"] = to
+		}
+		if len(createdAt) > 0 {
+			match["created_at"] = createdAt
+		}
+
+		matchStage := bson.D{{"$match", match}}
+		sortStage := bson.D{{"$sort", bson.D{{"sequence", -1}, {"created_at", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"audit_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := auditCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing audit items"})
+			return
+		}
+
+		// Changes hold arbitrary documents, which only decode to plain JSON
+		// objects as bson.M.
+		var allrecords []struct {
+			Total_count int      `json:"total_count"`
+			Audit_items []bson.M `json:"audit_items"`
+		}
+		if err = result.All(ctx, &allrecords); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(allrecords) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count": 0,
+				"audit_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, allrecords[0])
+	}
+}
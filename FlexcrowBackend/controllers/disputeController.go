@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
+	"user-athentication-golang/refund"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var disputeCollection *mongo.Collection = database.OpenCollection(database.Client, "dispute")
+var disputeValidate = validator.New()
+
+func GetDisputes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		userId, exists := c.Get("uid")
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+			return
+		}
+
+		canViewAll := can(c, policy.ActionResolve, policy.Transaction{})
+
+		match := bson.M{}
+		if !canViewAll {
+			match["$or"] = bson.A{bson.M{"seller_id": userId}, bson.M{"buyer_id": userId}}
+		}
+		if transactionId := c.Query("transaction_id"); transactionId != "" {
+			match["transaction_id"] = transactionId
+		}
+		if status, err := strconv.Atoi(c.Query("status")); err == nil {
+			match["status"] = status
+		}
+
+		matchStage := bson.D{{"$match", match}}
+		sortStage := bson.D{{"$sort", bson.D{{"created_at", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"dispute_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := disputeCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing dispute items"})
+			return
+		}
+
+		var alldisputes []struct {
+			Total_count   int              `json:"total_count"`
+			Dispute_items []models.Dispute `json:"dispute_items"`
+		}
+		if err = result.All(ctx, &alldisputes); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(alldisputes) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count":   0,
+				"dispute_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, alldisputes[0])
+	}
+}
+
+func GetDispute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		disputeId := c.Param("dispute_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var dispute models.Dispute
+		err := disputeCollection.FindOne(ctx, bson.M{"dispute_id": disputeId}).Decode(&dispute)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "dispute not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching dispute"})
+			return
+		}
+
+		if disputeRole(c, dispute) == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to view this dispute"})
+			return
+		}
+
+		c.JSON(http.StatusOK, dispute)
+	}
+}
+
+func CreateDispute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var dispute models.Dispute
+
+		if err := c.BindJSON(&dispute); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := disputeValidate.Struct(dispute)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var transaction models.Transaction
+		err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": dispute.Transaction_id}).Decode(&transaction)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "transaction_error"})
+			return
+		}
+
+		userId := c.GetString("uid")
+		resource := policy.TransactionOf(transaction)
+		if !can(c, policy.ActionUpdate, resource) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to dispute this transaction"})
+			return
+		}
+		role := helper.TransactionRole(can(c, policy.ActionManage, resource), userId, *transaction.User_id, *transaction.Customer_id)
+
+		paid, err := helper.TransactionPaid(ctx, transaction)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking escrow"})
+			return
+		}
+		if err := helper.CheckTransactionTransition(*transaction.Status, helper.TransactionDisputed, role, paid); err != nil {
+			transitionErr := err.(*helper.TransitionError)
+			c.JSON(http.StatusConflict, gin.H{"error": transitionErr.Code, "message": transitionErr.Message})
+			return
+		}
+
+		if !filesExist(ctx, dispute.Evidence_file_ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file_error"})
+			return
+		}
+
+		status := helper.DisputeOpen
+		dispute.Status = &status
+		dispute.Seller_id = transaction.User_id
+		dispute.Buyer_id = transaction.Customer_id
+		dispute.Opened_by = &userId
+		dispute.Messages = []models.DisputeMessage{}
+		dispute.Resolution = nil
+		if dispute.Evidence_file_ids == nil {
+			dispute.Evidence_file_ids = []string{}
+		}
+		dispute.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		dispute.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		dispute.ID = primitive.NewObjectID()
+		dispute.Dispute_id = dispute.ID.Hex()
+
+		err = helper.OpenDispute(ctx, dispute, transaction, auditEntry(c, "dispute.opened", "dispute", dispute.Dispute_id, nil, dispute, nil))
+		if err == helper.ErrDisputeExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "dispute_exists", "message": err.Error()})
+			return
+		}
+		if err == helper.ErrStatusConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create dispute"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"dispute_id": dispute.Dispute_id})
+	}
+}
+
+func AddDisputeMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		disputeId := c.Param("dispute_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var dispute models.Dispute
+		err := disputeCollection.FindOne(ctx, bson.M{"dispute_id": disputeId}).Decode(&dispute)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "dispute not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching dispute"})
+			return
+		}
+
+		role := disputeRole(c, dispute)
+		if role == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to post to this dispute"})
+			return
+		}
+
+		var message models.DisputeMessage
+		if err := c.BindJSON(&message); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := disputeValidate.Struct(message)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if !filesExist(ctx, message.File_ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file_error"})
+			return
+		}
+
+		message.Message_id = primitive.NewObjectID().Hex()
+		message.User_id = c.GetString("uid")
+		message.Role = role
+		if message.File_ids == nil {
+			message.File_ids = []string{}
+		}
+		message.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err = auditedUpdate(
+			ctx,
+			disputeCollection,
+			bson.M{"dispute_id": disputeId, "status": helper.DisputeOpen},
+			bson.M{
+				"$push":     bson.M{"messages": message},
+				"$addToSet": bson.M{"evidence_file_ids": bson.M{"$each": message.File_ids}},
+				"$set":      bson.M{"updated_at": time.Now()},
+			},
+			auditEntry(c, "dispute.message_added", "dispute", disputeId, nil, nil, map[string]interface{}{"message_id": message.Message_id}),
+		)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "dispute_resolved", "message": helper.ErrDisputeNotOpen.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add dispute message"})
+			return
+		}
+
+		c.JSON(http.StatusOK, message)
+	}
+}
+
+func ResolveDispute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		disputeId := c.Param("dispute_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var dispute models.Dispute
+		err := disputeCollection.FindOne(ctx, bson.M{"dispute_id": disputeId}).Decode(&dispute)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "dispute not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching dispute"})
+			return
+		}
+
+		var resolution models.DisputeResolution
+		if err := c.BindJSON(&resolution); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := disputeValidate.Struct(resolution)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if *resolution.Type == helper.ResolutionSplit && resolution.Buyer_amount == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "buyer_amount_error"})
+			return
+		}
+		if *resolution.Type != helper.ResolutionSplit {
+			resolution.Buyer_amount = nil
+		}
+
+		var transaction models.Transaction
+		err = transactionCollection.FindOne(ctx, bson.M{"transaction_id": dispute.Transaction_id}).Decode(&transaction)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching transaction"})
+			return
+		}
+
+		if !authorize(c, policy.ActionResolve, policy.TransactionOf(transaction)) {
+			return
+		}
+
+		if resolution.Buyer_amount != nil {
+			buyerAmount := resolution.Buyer_amount.WithCurrency(helper.TransactionCurrency(transaction))
+			resolution.Buyer_amount = &buyerAmount
+		}
+
+		resolution.Resolved_by = c.GetString("uid")
+		resolution.Resolved_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		err = helper.ResolveDispute(ctx, refund.Provider(), dispute, transaction, resolution, auditEntry(c, "dispute.resolved", "dispute", disputeId, nil, resolution, nil))
+		switch {
+		case err == nil:
+		case errors.Is(err, helper.ErrRefundFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": "refund_failed", "message": err.Error()})
+			return
+		case err == helper.ErrNoRefundablePayment:
+			c.JSON(http.StatusConflict, gin.H{"error": "no_refundable_payment", "message": err.Error()})
+			return
+		case err == helper.ErrDisputeNotOpen:
+			c.JSON(http.StatusConflict, gin.H{"error": "dispute_resolved", "message": err.Error()})
+			return
+		case err == helper.ErrStatusConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+			return
+		case err == helper.ErrTransactionNotPaid:
+			c.JSON(http.StatusConflict, gin.H{"error": "transaction_not_paid", "message": err.Error()})
+			return
+		case err == helper.ErrInvalidSplit:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "buyer_amount_error", "message": err.Error()})
+			return
+		case errors.Is(err, helper.ErrEscrowOverdrawn):
+			c.JSON(http.StatusConflict, gin.H{"error": "escrow_overdrawn", "message": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve dispute"})
+			return
+		}
+
+		c.JSON(http.StatusOK, resolution)
+	}
+}
+
+// disputeRole is the role the signed-in user plays in a dispute, or "" when
+// they may not see it.
+func disputeRole(c *gin.Context, dispute models.Dispute) string {
+	resource := policy.Transaction{}
+	if dispute.Seller_id != nil {
+		resource.Seller_id = *dispute.Seller_id
+	}
+	if dispute.Buyer_id != nil {
+		resource.Buyer_id = *dispute.Buyer_id
+	}
+	if !can(c, policy.ActionRead, resource) && !can(c, policy.ActionResolve, resource) {
+		return ""
+	}
+	return helper.TransactionRole(can(c, policy.ActionResolve, resource), c.GetString("uid"), resource.Seller_id, resource.Buyer_id)
+}
+
+func filesExist(ctx context.Context, fileIds []string) bool {
+	if len(fileIds) == 0 {
+		return true
+	}
+
+	unique := map[string]bool{}
+	for _, fileId := range fileIds {
+		unique[fileId] = true
+	}
+
+	count, err := fileCollection.CountDocuments(ctx, bson.M{"file_id": bson.M{"$in": fileIds}})
+	return err == nil && int(count) == len(unique)
+}
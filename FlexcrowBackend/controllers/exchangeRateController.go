@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var exchangeRateCollection *mongo.Collection = database.OpenCollection(database.Client, "exchange_rate")
+var exchangeRateValidate = validator.New()
+
+func GetExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		match := bson.M{}
+		if base := c.Query("base"); base != "" {
+			match["base"] = strings.ToUpper(base)
+		}
+		if quote := c.Query("quote"); quote != "" {
+			match["quote"] = strings.ToUpper(quote)
+		}
+
+		matchStage := bson.D{{"$match", match}}
+		sortStage := bson.D{{"$sort", bson.D{{"effective_from", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"exchange_rate_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := exchangeRateCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing exchange rate items"})
+			return
+		}
+
+		var allrates []struct {
+			Total_count         int                   `json:"total_count"`
+			Exchange_rate_items []models.ExchangeRate `json:"exchange_rate_items"`
+		}
+		if err = result.All(ctx, &allrates); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(allrates) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count":         0,
+				"exchange_rate_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, allrates[0])
+	}
+}
+
+// GetCurrentExchangeRate returns the rate a transaction created now would
+// freeze for ?base=&quote=.
+func GetCurrentExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		base, quote := strings.ToUpper(c.Query("base")), strings.ToUpper(c.Query("quote"))
+		if len(base) != 3 || len(quote) != 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency_error"})
+			return
+		}
+
+		rate, err := helper.ExchangeRateAt(ctx, base, quote, time.Now())
+		if errors.Is(err, helper.ErrNoExchangeRate) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "exchange_rate_unavailable", "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"base": base, "quote": quote, "rate": rate})
+	}
+}
+
+func GetExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exchangeRateId := c.Param("exchange_rate_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rate models.ExchangeRate
+		err := exchangeRateCollection.FindOne(ctx, bson.M{"exchange_rate_id": exchangeRateId}).Decode(&rate)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "exchange rate not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rate)
+	}
+}
+
+// CreateExchangeRate adds a rate rather than editing one, so the history
+// behind every frozen transaction rate stays on record.
+func CreateExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rate models.ExchangeRate
+
+		if err := c.BindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := exchangeRateValidate.Struct(rate)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		base, quote := strings.ToUpper(*rate.Base), strings.ToUpper(*rate.Quote)
+		if base == quote {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency_error"})
+			return
+		}
+		rate.Base, rate.Quote = &base, &quote
+
+		now := time.Now()
+		if rate.Effective_from == nil {
+			rate.Effective_from = &now
+		} else if rate.Effective_from.Before(now.Add(-time.Minute)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from_error"})
+			return
+		}
+
+		createdBy := c.GetString("uid")
+		rate.Created_by = &createdBy
+		rate.Created_at, _ = time.Parse(time.RFC3339, now.Format(time.RFC3339))
+		rate.Updated_at, _ = time.Parse(time.RFC3339, now.Format(time.RFC3339))
+		rate.ID = primitive.NewObjectID()
+		rate.Exchange_rate_id = rate.ID.Hex()
+
+		resultInsertionNumber, insertErr := auditedInsert(ctx, exchangeRateCollection, rate, auditEntry(c, "exchange_rate.created", "exchange_rate", rate.Exchange_rate_id, nil, rate, nil))
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, resultInsertionNumber)
+	}
+}
+
+func DeleteExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exchangeRateId := c.Param("exchange_rate_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := auditedDelete(ctx, c, exchangeRateCollection, bson.M{
+			"exchange_rate_id": exchangeRateId,
+			"effective_from":   bson.M{"$gt": time.Now()},
+		}, "exchange_rate.deleted", "exchange_rate", exchangeRateId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete exchange rate"})
+			return
+		}
+
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "exchange_rate_in_effect"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
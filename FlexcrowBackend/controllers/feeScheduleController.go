@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var feeScheduleCollection *mongo.Collection = database.OpenCollection(database.Client, "fee_schedule")
+var feeScheduleValidate = validator.New()
+
+func GetFeeSchedules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		matchStage := bson.D{{"$match", bson.D{{}}}}
+		sortStage := bson.D{{"$sort", bson.D{{"effective_from", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"fee_schedule_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := feeScheduleCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing fee schedule items"})
+			return
+		}
+
+		// Decode into the models so money fields render as plain numbers.
+		var allschedules []struct {
+			Total_count        int                  `json:"total_count"`
+			Fee_schedule_items []models.FeeSchedule `json:"fee_schedule_items"`
+		}
+		if err = result.All(ctx, &allschedules); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(allschedules) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count":        0,
+				"fee_schedule_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, allschedules[0])
+	}
+}
+
+func GetCurrentFeeSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		schedule, err := helper.CurrentFeeSchedule(ctx, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching fee schedule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, schedule)
+	}
+}
+
+func GetFeeSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		feeScheduleId := c.Param("fee_schedule_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		schedule, err := helper.GetFeeSchedule(ctx, feeScheduleId)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "fee schedule not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching fee schedule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, schedule)
+	}
+}
+
+func CreateFeeSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var schedule models.FeeSchedule
+
+		if err := c.BindJSON(&schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := feeScheduleValidate.Struct(schedule)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if schedule.Effective_from.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from_error"})
+			return
+		}
+
+		schedule.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		schedule.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		schedule.ID = primitive.NewObjectID()
+		schedule.Fee_schedule_id = schedule.ID.Hex()
+
+		resultInsertionNumber, insertErr := auditedInsert(ctx, feeScheduleCollection, schedule, auditEntry(c, "fee_schedule.created", "fee_schedule", schedule.Fee_schedule_id, nil, schedule, nil))
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create fee schedule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, resultInsertionNumber)
+	}
+}
+
+func UpdateFeeSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		feeScheduleId := c.Param("fee_schedule_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var existingSchedule models.FeeSchedule
+		err := feeScheduleCollection.FindOne(ctx, bson.M{"fee_schedule_id": feeScheduleId}).Decode(&existingSchedule)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "fee schedule not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching fee schedule"})
+			return
+		}
+
+		// Transactions keep the schedule they were priced under, so only
+		// schedules that have not taken effect yet may change.
+		if !existingSchedule.Effective_from.After(time.Now()) {
+			c.JSON(http.StatusConflict, gin.H{"error": "fee_schedule_in_effect"})
+			return
+		}
+
+		var updateData models.FeeSchedule
+		if err := c.BindJSON(&updateData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		update := bson.M{}
+
+		if updateData.Name != nil {
+			update["name"] = updateData.Name
+		}
+		if updateData.Tiers != nil {
+			for _, tier := range updateData.Tiers {
+				if err := feeScheduleValidate.Struct(tier); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			update["tiers"] = updateData.Tiers
+		}
+		if updateData.Effective_from != nil {
+			if updateData.Effective_from.Before(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from_error"})
+				return
+			}
+			update["effective_from"] = updateData.Effective_from
+		}
+
+		update["updated_at"] = time.Now().Format(time.RFC3339)
+
+		result, err := auditedUpdate(
+			ctx,
+			feeScheduleCollection,
+			bson.M{"fee_schedule_id": feeScheduleId},
+			bson.M{"$set": update},
+			auditEntry(c, "fee_schedule.updated", "fee_schedule", feeScheduleId, existingSchedule, update, nil),
+		)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "fee schedule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update fee schedule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result.ModifiedCount)
+	}
+}
+
+func DeleteFeeSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		feeScheduleId := c.Param("fee_schedule_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := auditedDelete(ctx, c, feeScheduleCollection, bson.M{
+			"fee_schedule_id": feeScheduleId,
+			"effective_from":  bson.M{"$gt": time.Now()},
+		}, "fee_schedule.deleted", "fee_schedule", feeScheduleId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete fee schedule"})
+			return
+		}
+
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "fee_schedule_in_effect"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
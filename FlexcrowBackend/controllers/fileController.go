@@ -9,8 +9,7 @@ import (
 	"time"
 	"user-athentication-golang/database"
 	"user-athentication-golang/models"
-
-	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/policy"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
@@ -25,6 +24,9 @@ var fileCollection *mongo.Collection = database.OpenCollection(database.Client,
 
 func UploadFile() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !authorize(c, policy.ActionCreate, policy.File{}) {
+			return
+		}
 
 		err := godotenv.Load(".env")
 
@@ -64,9 +66,11 @@ func UploadFile() gin.HandlerFunc {
 			return
 		}
 
+		userId := c.GetString("uid")
 		fileRecord := models.File{
 			ID:            primitive.NewObjectID(),
 			File_id:       primitive.NewObjectID().Hex(),
+			User_id:       &userId,
 			Original_name: file.Filename,
 			Cloud_url:     uploadResult.SecureURL,
 			Cloud_id:      uploadResult.PublicID,
@@ -76,7 +80,7 @@ func UploadFile() gin.HandlerFunc {
 			Updated_at:    time.Now(),
 		}
 
-		_, err = fileCollection.InsertOne(ctx, fileRecord)
+		_, err = auditedInsert(ctx, fileCollection, fileRecord, auditEntry(c, "file.uploaded", "file", fileRecord.File_id, nil, fileRecord, nil))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file record"})
 			return
@@ -91,8 +95,7 @@ func UploadFile() gin.HandlerFunc {
 
 func GetFiles() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionList, policy.File{}) {
 			return
 		}
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -153,21 +156,31 @@ func GetFile() gin.HandlerFunc {
 			return
 		}
 
+		resource := policy.FileOf(file, false)
+		if !can(c, policy.ActionRead, resource) {
+			resource, err = fileResource(ctx, file)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking file access"})
+				return
+			}
+		}
+		if !authorize(c, policy.ActionRead, resource) {
+			return
+		}
+
 		c.JSON(http.StatusOK, file)
 	}
 }
 
 func DeleteFile() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		fileId := c.Param("file_id")
+		if !authorize(c, policy.ActionDelete, policy.File{}) {
 			return
 		}
-
-		fileId := c.Param("file_id")
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := fileCollection.DeleteOne(ctx, bson.M{"file_id": fileId})
+		result, err := auditedDelete(ctx, c, fileCollection, bson.M{"file_id": fileId}, "file.deleted", "file", fileId)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete file"})
@@ -177,3 +190,50 @@ func DeleteFile() gin.HandlerFunc {
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+// fileResource works out who else may see a file: anyone when it is a
+// product or profile image, and both parties when it is a shipping photo
+// or dispute evidence.
+func fileResource(ctx context.Context, file models.File) (policy.File, error) {
+	public := bson.M{"$or": bson.A{bson.M{"image_id": file.File_id}, bson.M{"video_id": file.File_id}}}
+	count, err := productCollection.CountDocuments(ctx, public)
+	if err != nil {
+		return policy.File{}, err
+	}
+	if count == 0 {
+		count, err = userCollection.CountDocuments(ctx, bson.M{"image_id": file.File_id})
+		if err != nil {
+			return policy.File{}, err
+		}
+	}
+	if count > 0 {
+		return policy.FileOf(file, true), nil
+	}
+
+	partyIds, err := transactionParties(ctx, "shipping_image_id", file.File_id)
+	if err != nil {
+		return policy.File{}, err
+	}
+
+	cursor, err := disputeCollection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"evidence_file_ids": file.File_id},
+		bson.M{"messages.file_ids": file.File_id},
+	}})
+	if err != nil {
+		return policy.File{}, err
+	}
+	var disputes []models.Dispute
+	if err := cursor.All(ctx, &disputes); err != nil {
+		return policy.File{}, err
+	}
+	for _, dispute := range disputes {
+		if dispute.Seller_id != nil {
+			partyIds = append(partyIds, *dispute.Seller_id)
+		}
+		if dispute.Buyer_id != nil {
+			partyIds = append(partyIds, *dispute.Buyer_id)
+		}
+	}
+
+	return policy.FileOf(file, false, partyIds...), nil
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ledgerCollection *mongo.Collection = database.OpenCollection(database.Client, "ledger")
+
+func GetLedgerEntries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		userId, exists := c.Get("uid")
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+			return
+		}
+
+		canViewAll := helper.HasPermission(c, policy.PermLedgerViewAll)
+
+		match := bson.M{}
+		if canViewAll {
+			if account := c.Query("account"); account != "" {
+				match["account"] = account
+			}
+		} else {
+			match["account"] = userId
+		}
+		if transactionId := c.Query("transaction_id"); transactionId != "" {
+			match["transaction_id"] = transactionId
+		}
+		if entryType := c.Query("type"); entryType != "" {
+			match["type"] = entryType
+		}
+
+		matchStage := bson.D{{"$match", match}}
+		sortStage := bson.D{{"$sort", bson.D{{"created_at", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"ledger_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := ledgerCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing ledger items"})
+			return
+		}
+
+		// Decode into the models so money fields render as plain numbers.
+		var allentries []struct {
+			Total_count  int                  `json:"total_count"`
+			Ledger_items []models.LedgerEntry `json:"ledger_items"`
+		}
+		if err = result.All(ctx, &allentries); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(allentries) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count":  0,
+				"ledger_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, allentries[0])
+	}
+}
+
+// ReconcileBalances lists wallets that disagree with the ledger. It only
+// rewrites them when called with apply=true.
+func ReconcileBalances() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		fix := c.Query("apply") == "true"
+
+		mismatches, err := helper.ReconcileBalances(ctx, fix, auditSource(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reconcile balances"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"fixed":       fix,
+			"total_count": len(mismatches),
+			"mismatches":  mismatches,
+		})
+	}
+}
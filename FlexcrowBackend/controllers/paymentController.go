@@ -2,10 +2,12 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"net/http"
 	"time"
@@ -19,6 +21,7 @@ import (
 
 	helper "user-athentication-golang/helpers"
 	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -52,14 +55,8 @@ func GetPayments() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
 		var matchStage bson.D
-		if userType == "ADMIN" {
+		if can(c, policy.ActionList, policy.Payment{}) {
 			queryUserId := c.Query("user_id")
 			if queryUserId != "" {
 				matchStage = bson.D{{"$match", bson.D{{"user_id", queryUserId}}}}
@@ -86,7 +83,11 @@ func GetPayments() gin.HandlerFunc {
 			return
 		}
 
-		var allpayments []bson.M
+		// Decode into the models so money fields render as plain numbers.
+		var allpayments []struct {
+			Total_count   int              `json:"total_count"`
+			Payment_items []models.Payment `json:"payment_items"`
+		}
 		if err = result.All(ctx, &allpayments); err != nil {
 			log.Fatal(err)
 		}
@@ -116,25 +117,10 @@ func GetPayment() gin.HandlerFunc {
 			return
 		}
 
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
-			return
-		}
-
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
+		if !authorize(c, policy.ActionRead, policy.PaymentOf(payment)) {
 			return
 		}
 
-		if userType != "ADMIN" {
-			if *payment.User_id != userId.(string) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to view this payment"})
-				return
-			}
-		}
-
 		c.JSON(http.StatusOK, payment)
 	}
 }
@@ -157,11 +143,7 @@ func CreatePayment() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
+		canManage := can(c, policy.ActionManage, policy.Payment{})
 
 		userId, exists := c.Get("uid")
 		if !exists {
@@ -169,7 +151,7 @@ func CreatePayment() gin.HandlerFunc {
 			return
 		}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			userIdStr := userId.(string)
 			payment.User_id = &userIdStr
 		} else {
@@ -197,7 +179,7 @@ func CreatePayment() gin.HandlerFunc {
 		payment.ID = primitive.NewObjectID()
 		payment.Payment_id = payment.ID.Hex()
 
-		_, insertErr := paymentCollection.InsertOne(ctx, payment)
+		_, insertErr := auditedInsert(ctx, paymentCollection, payment, auditEntry(c, "payment.created", "payment", payment.Payment_id, nil, payment, nil))
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create payment"})
 			return
@@ -224,24 +206,11 @@ func UpdatePayment() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+		resource := policy.PaymentOf(existingPayment)
+		if !authorize(c, policy.ActionUpdate, resource) {
 			return
 		}
-
-		if userType != "ADMIN" {
-			if *existingPayment.User_id != userId.(string) || (existingPayment.Status != nil && *existingPayment.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this payment"})
-				return
-			}
-		}
+		canManage := can(c, policy.ActionManage, resource)
 
 		var updateData models.Payment
 		if err := c.BindJSON(&updateData); err != nil {
@@ -251,8 +220,9 @@ func UpdatePayment() gin.HandlerFunc {
 
 		update := bson.M{}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			updateData.User_id = nil
+			updateData.Status = nil
 		}
 
 		if updateData.Status != nil {
@@ -267,18 +237,19 @@ func UpdatePayment() gin.HandlerFunc {
 
 		update["updated_at"] = time.Now().Format(time.RFC3339)
 
-		result, err := paymentCollection.UpdateOne(
+		result, err := auditedUpdate(
 			ctx,
+			paymentCollection,
 			bson.M{"payment_id": paymentId},
 			bson.M{"$set": update},
+			auditEntry(c, "payment.updated", "payment", paymentId, existingPayment, update, nil),
 		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update payment"})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update payment"})
 			return
 		}
 
@@ -288,15 +259,14 @@ func UpdatePayment() gin.HandlerFunc {
 
 func DeletePayment() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionDelete, policy.Payment{}) {
 			return
 		}
 
 		paymentId := c.Param("payment_id")
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := paymentCollection.DeleteOne(ctx, bson.M{"payment_id": paymentId})
+		result, err := auditedDelete(ctx, c, paymentCollection, bson.M{"payment_id": paymentId}, "payment.deleted", "payment", paymentId)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete payment"})
@@ -313,10 +283,10 @@ func CreateStripePayment() gin.HandlerFunc {
 		defer cancel()
 
 		var paymentRequest struct {
-			Amount      float64 `json:"amount" validate:"required"`
-			Currency    string  `json:"currency"`
-			Description string  `json:"description"`
-			Method      string  `json:"method"`
+			Amount      json.Number `json:"amount" validate:"required"`
+			Currency    string      `json:"currency"`
+			Description string      `json:"description"`
+			Method      string      `json:"method"`
 		}
 
 		if err := c.BindJSON(&paymentRequest); err != nil {
@@ -324,13 +294,14 @@ func CreateStripePayment() gin.HandlerFunc {
 			return
 		}
 
-		if paymentRequest.Amount <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
-			return
+		if paymentRequest.Currency == "" {
+			paymentRequest.Currency = models.DefaultCurrency
 		}
 
-		if paymentRequest.Currency == "" {
-			paymentRequest.Currency = "usd"
+		amount, err := models.ParseMoney(paymentRequest.Amount.String(), paymentRequest.Currency)
+		if err != nil || amount.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+			return
 		}
 
 		userId, exists := c.Get("uid")
@@ -339,10 +310,35 @@ func CreateStripePayment() gin.HandlerFunc {
 			return
 		}
 
+		transactionParam := c.Query("transaction")
+
 		var payment models.Payment
-		payment.Amount = &paymentRequest.Amount
+		payment.Amount = &amount
 		payment.Method = &paymentRequest.Method
 
+		var transaction models.Transaction
+		if transactionParam != "" {
+			err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": transactionParam}).Decode(&transaction)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "transaction_error"})
+				return
+			}
+			if !authorize(c, policy.ActionPay, policy.TransactionOf(transaction)) {
+				return
+			}
+			payment.Transaction_id = &transaction.Transaction_id
+
+			// A transaction is charged what it was priced at, in the buyer's
+			// currency at the frozen rate, whatever the client sent.
+			charged := helper.ChargedAmount(transaction)
+			if charged.Amount <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+				return
+			}
+			amount = charged
+			payment.Amount = &amount
+		}
+
 		status := 1
 		payment.Status = &status
 
@@ -354,7 +350,45 @@ func CreateStripePayment() gin.HandlerFunc {
 		payment.ID = primitive.NewObjectID()
 		payment.Payment_id = payment.ID.Hex()
 
-		_, insertErr := paymentCollection.InsertOne(ctx, payment)
+		if paymentRequest.Method == helper.MethodBalance {
+			if transactionParam == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "transaction_error"})
+				return
+			}
+			if transaction.Payment_id != nil && *transaction.Payment_id != "" {
+				c.JSON(http.StatusConflict, gin.H{"error": "transaction_paid", "message": helper.ErrTransactionPaid.Error()})
+				return
+			}
+			if *transaction.Status != helper.TransactionPending && *transaction.Status != helper.TransactionProcessing {
+				c.JSON(http.StatusConflict, gin.H{"error": "invalid_status", "message": "only pending or processing transactions can be paid"})
+				return
+			}
+
+			paid := helper.PaymentPaid
+			payment.Status = &paid
+
+			err := helper.PayFromBalance(ctx, transaction, payment)
+			switch err {
+			case nil:
+			case helper.ErrInsufficientBalance:
+				c.JSON(http.StatusConflict, gin.H{"error": "insufficient_balance", "message": err.Error()})
+				return
+			case helper.ErrTransactionPaid, helper.ErrConcurrentUpdate:
+				c.JSON(http.StatusConflict, gin.H{"error": "concurrent_update", "message": err.Error()})
+				return
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to pay from balance"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"payment_id": payment.Payment_id,
+				"status":     paid,
+			})
+			return
+		}
+
+		_, insertErr := auditedInsert(ctx, paymentCollection, payment, auditEntry(c, "payment.created", "payment", payment.Payment_id, nil, payment, nil))
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create payment record"})
 			return
@@ -369,7 +403,6 @@ func CreateStripePayment() gin.HandlerFunc {
 		stripe.Key = stripeSecretKey
 
 		frontedURL := os.Getenv("FRONTEND_URL")
-		transactionParam := c.Query("transaction")
 
 		successURL := fmt.Sprintf("%s/member/transactions/buy/%s?payment=%s&payment_status=success", frontedURL, transactionParam, payment.Payment_id)
 		cancelURL := fmt.Sprintf("%s/member/transactions/buy/%s?payment=%s&payment_status=cancel", frontedURL, transactionParam, payment.Payment_id)
@@ -382,11 +415,11 @@ func CreateStripePayment() gin.HandlerFunc {
 			LineItems: []*stripe.CheckoutSessionLineItemParams{
 				{
 					PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-						Currency: stripe.String(paymentRequest.Currency),
+						Currency: stripe.String(strings.ToLower(amount.Currency)),
 						ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
 							Name: stripe.String(paymentRequest.Description),
 						},
-						UnitAmount: stripe.Int64(int64(paymentRequest.Amount * 100)),
+						UnitAmount: stripe.Int64(amount.Amount),
 					},
 					Quantity: stripe.Int64(1),
 				},
@@ -403,6 +436,17 @@ func CreateStripePayment() gin.HandlerFunc {
 			return
 		}
 
+		// Expiring the transaction closes the session through this ID.
+		_, err = paymentCollection.UpdateOne(ctx,
+			bson.M{"payment_id": payment.Payment_id},
+			bson.M{"$set": bson.M{"checkout_session": session.ID}},
+		)
+		if err != nil {
+			// Without the URL the buyer cannot reach the session anyway.
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record checkout session"})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"payment_id":   payment.Payment_id,
 			"checkout_url": session.URL,
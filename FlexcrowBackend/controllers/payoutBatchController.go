@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+	"user-athentication-golang/payout"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var payoutBatchCollection *mongo.Collection = database.OpenCollection(database.Client, "payout_batch")
+
+func GetPayoutBatches() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		match := bson.M{}
+		if status, err := strconv.Atoi(c.Query("status")); err == nil {
+			match["status"] = status
+		}
+
+		matchStage := bson.D{{"$match", match}}
+		sortStage := bson.D{{"$sort", bson.D{{"created_at", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"payout_batch_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := payoutBatchCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing payout batches"})
+			return
+		}
+
+		var allbatches []struct {
+			Total_count        int                  `json:"total_count"`
+			Payout_batch_items []models.PayoutBatch `json:"payout_batch_items"`
+		}
+		if err = result.All(ctx, &allbatches); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(allbatches) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count":        0,
+				"payout_batch_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, allbatches[0])
+	}
+}
+
+func GetPayoutBatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		batch, ok := findPayoutBatch(ctx, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, batch)
+	}
+}
+
+func CreatePayoutBatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		batch, err := helper.CreatePayoutBatch(ctx, auditSource(c))
+		if err == helper.ErrNothingToBatch {
+			c.JSON(http.StatusConflict, gin.H{"error": "nothing_to_batch", "message": err.Error()})
+			return
+		}
+		if err == helper.ErrWithdrawalConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create payout batch"})
+			return
+		}
+
+		c.JSON(http.StatusOK, batch)
+	}
+}
+
+// DownloadPayoutBatch returns the batch file; format is csv (the default) or
+// pain001 for the ISO 20022 XML.
+func DownloadPayoutBatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		batch, ok := findPayoutBatch(ctx, c)
+		if !ok {
+			return
+		}
+
+		format := c.DefaultQuery("format", "csv")
+		var buffer bytes.Buffer
+		var contentType string
+		var err error
+		switch format {
+		case "csv":
+			contentType = "text/csv"
+			err = payout.WriteBatchCSV(&buffer, batch)
+		case "pain001":
+			contentType = "application/xml"
+			err = payout.WritePain001(&buffer, batch, payout.DebtorFromEnv())
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_format", "message": "format must be csv or pain001"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write payout batch file"})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", payout.BatchFileName(batch, format)))
+		c.Data(http.StatusOK, contentType, buffer.Bytes())
+	}
+}
+
+// UploadPayoutBatchResult takes the bank's result file for a batch as the
+// multipart field "file".
+func UploadPayoutBatchResult() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		batch, ok := findPayoutBatch(ctx, c)
+		if !ok {
+			return
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+			return
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+			return
+		}
+		defer src.Close()
+
+		outcomes, err := payout.ParseBatchResult(src)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_result_file", "message": err.Error()})
+			return
+		}
+
+		summary, err := helper.ApplyBatchResult(ctx, batch, outcomes, auditSource(c))
+		if err == helper.ErrWithdrawalConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error(), "summary": summary})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply payout batch result", "summary": summary})
+			return
+		}
+
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+func findPayoutBatch(ctx context.Context, c *gin.Context) (models.PayoutBatch, bool) {
+	var batch models.PayoutBatch
+	err := payoutBatchCollection.FindOne(ctx, bson.M{"batch_id": c.Param("batch_id")}).Decode(&batch)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payout batch not found"})
+		return batch, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching payout batch"})
+		return batch, false
+	}
+	return batch, true
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"strconv"
+	"strings"
 
 	"net/http"
 	"time"
@@ -15,6 +16,7 @@ import (
 
 	helper "user-athentication-golang/helpers"
 	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -48,14 +50,8 @@ func GetProducts() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
 		var matchStage bson.D
-		if userType == "ADMIN" {
+		if can(c, policy.ActionList, policy.Product{}) {
 			queryUserId := c.Query("user_id")
 			if queryUserId != "" {
 				matchStage = bson.D{{"$match", bson.D{{"user_id", queryUserId}}}}
@@ -85,7 +81,11 @@ func GetProducts() gin.HandlerFunc {
 			return
 		}
 
-		var allproducts []bson.M
+		// Decode into the models so money fields render as plain numbers.
+		var allproducts []struct {
+			Total_count   int              `json:"total_count"`
+			Product_items []models.Product `json:"product_items"`
+		}
 		if err = result.All(ctx, &allproducts); err != nil {
 			log.Fatal(err)
 		}
@@ -115,26 +115,18 @@ func GetProduct() gin.HandlerFunc {
 			return
 		}
 
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
-			return
-		}
-
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		transactionParam := c.Query("transaction")
-
-		if userType != "ADMIN" {
-			if (*product.User_id != userId.(string) && transactionParam != "true") || (product.Status != nil && *product.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to view this product"})
+		// Buyers may see the products they hold a transaction for.
+		resource := policy.ProductOf(product)
+		if !can(c, policy.ActionRead, resource) {
+			resource.Party_ids, err = transactionParties(ctx, "product_id", productId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking access"})
 				return
 			}
 		}
+		if !authorize(c, policy.ActionRead, resource) {
+			return
+		}
 
 		c.JSON(http.StatusOK, product)
 	}
@@ -145,6 +137,10 @@ func CreateProduct() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		if !requireVerifiedEmail(ctx, c) {
+			return
+		}
+
 		var product models.Product
 
 		if err := c.BindJSON(&product); err != nil {
@@ -158,11 +154,7 @@ func CreateProduct() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
+		canManage := can(c, policy.ActionManage, policy.Product{})
 
 		userId, exists := c.Get("uid")
 		if !exists {
@@ -170,7 +162,7 @@ func CreateProduct() gin.HandlerFunc {
 			return
 		}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			userIdStr := userId.(string)
 			product.User_id = &userIdStr
 		} else {
@@ -193,12 +185,20 @@ func CreateProduct() gin.HandlerFunc {
 			product.Status = &status
 		}
 
+		currency := models.DefaultCurrency
+		if product.Currency != nil && *product.Currency != "" {
+			currency = strings.ToUpper(*product.Currency)
+		}
+		price := product.Price.WithCurrency(currency)
+		product.Currency = &currency
+		product.Price = &price
+
 		product.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		product.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		product.ID = primitive.NewObjectID()
 		product.Product_id = product.ID.Hex()
 
-		resultInsertionNumber, insertErr := productCollection.InsertOne(ctx, product)
+		resultInsertionNumber, insertErr := auditedInsert(ctx, productCollection, product, auditEntry(c, "product.created", "product", product.Product_id, nil, product, nil))
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create product"})
 			return
@@ -225,24 +225,11 @@ func UpdateProduct() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+		resource := policy.ProductOf(existingProduct)
+		if !authorize(c, policy.ActionUpdate, resource) {
 			return
 		}
-
-		if userType != "ADMIN" {
-			if *existingProduct.User_id != userId.(string) || (existingProduct.Status != nil && *existingProduct.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this product"})
-				return
-			}
-		}
+		canManage := can(c, policy.ActionManage, resource)
 
 		var updateData models.Product
 		if err := c.BindJSON(&updateData); err != nil {
@@ -250,9 +237,14 @@ func UpdateProduct() gin.HandlerFunc {
 			return
 		}
 
+		if updateData.Currency != nil && len(*updateData.Currency) != 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency_error"})
+			return
+		}
+
 		update := bson.M{}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			updateData.User_id = nil
 			updateData.Status = nil
 		}
@@ -269,8 +261,17 @@ func UpdateProduct() gin.HandlerFunc {
 		if updateData.Description != nil {
 			update["description"] = updateData.Description
 		}
-		if updateData.Price != nil {
-			update["price"] = updateData.Price
+		if updateData.Price != nil || updateData.Currency != nil {
+			currency := helper.ProductCurrency(existingProduct)
+			if updateData.Currency != nil && *updateData.Currency != "" {
+				currency = strings.ToUpper(*updateData.Currency)
+			}
+			price := helper.MoneyOrZero(existingProduct.Price)
+			if updateData.Price != nil {
+				price = *updateData.Price
+			}
+			update["currency"] = currency
+			update["price"] = price.WithCurrency(currency)
 		}
 		if updateData.Image_id != nil {
 			update["image_id"] = updateData.Image_id
@@ -281,18 +282,19 @@ func UpdateProduct() gin.HandlerFunc {
 
 		update["updated_at"] = time.Now().Format(time.RFC3339)
 
-		result, err := productCollection.UpdateOne(
+		result, err := auditedUpdate(
 			ctx,
+			productCollection,
 			bson.M{"product_id": productId},
 			bson.M{"$set": update},
+			auditEntry(c, "product.updated", "product", productId, existingProduct, update, nil),
 		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product"})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product"})
 			return
 		}
 
@@ -302,8 +304,7 @@ func UpdateProduct() gin.HandlerFunc {
 
 func DeleteProduct() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionDelete, policy.Product{}) {
 			return
 		}
 
@@ -311,7 +312,7 @@ func DeleteProduct() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		result, err := productCollection.DeleteOne(ctx, bson.M{"product_id": productId})
+		result, err := auditedDelete(ctx, c, productCollection, bson.M{"product_id": productId}, "product.deleted", "product", productId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete product"})
 			return
@@ -338,43 +339,29 @@ func RemoveProduct() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+		if !authorize(c, policy.ActionRemove, policy.ProductOf(existingProduct)) {
 			return
 		}
 
-		if userType != "ADMIN" {
-			if *existingProduct.User_id != userId.(string) || (existingProduct.Status != nil && *existingProduct.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to remove this product"})
-				return
-			}
-		}
-
 		status := 2
 		update := bson.M{
 			"status":     status,
 			"updated_at": time.Now().Format(time.RFC3339),
 		}
 
-		result, err := productCollection.UpdateOne(
+		result, err := auditedUpdate(
 			ctx,
+			productCollection,
 			bson.M{"product_id": productId},
 			bson.M{"$set": update},
+			auditEntry(c, "product.removed", "product", productId, existingProduct, update, nil),
 		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove product"})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove product"})
 			return
 		}
 
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"user-athentication-golang/database"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var roleCollection *mongo.Collection = database.OpenCollection(database.Client, "role")
+var roleValidate = validator.New()
+
+var roleIdPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// checkRolePermissions answers for a permission list a role may not hold:
+// unknown names, or permissions the signed-in user does not hold themselves.
+func checkRolePermissions(c *gin.Context, permissions []string) bool {
+	if err := helper.ValidatePermissions(permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown_permission", "message": err.Error()})
+		return false
+	}
+	for _, permission := range permissions {
+		if !helper.HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "a role cannot grant permissions you do not hold", "permission": permission})
+			return false
+		}
+	}
+	return true
+}
+
+func GetRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		roles, err := helper.Roles(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing roles"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"role_items":  roles,
+			"permissions": policy.Permissions,
+		})
+	}
+}
+
+func CreateRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var role models.Role
+		if err := c.BindJSON(&role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := roleValidate.Struct(role)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if !roleIdPattern.MatchString(role.Role_id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role_id_error", "message": "role_id may only contain lowercase letters, digits and underscores"})
+			return
+		}
+		if !checkRolePermissions(c, role.Permissions) {
+			return
+		}
+
+		if helper.IsBuiltInRole(role.Role_id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role_exists"})
+			return
+		}
+		count, err := roleCollection.CountDocuments(ctx, bson.M{"role_id": role.Role_id})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking role"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role_exists"})
+			return
+		}
+
+		role.Built_in = false
+		role.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		role.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		role.ID = primitive.NewObjectID()
+
+		resultInsertionNumber, insertErr := auditedInsert(ctx, roleCollection, role, auditEntry(c, "role.created", "role", role.Role_id, nil, role, nil))
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, resultInsertionNumber)
+	}
+}
+
+func UpdateRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleId := c.Param("role_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if helper.IsBuiltInRole(roleId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "built_in_role", "message": helper.ErrBuiltInRole.Error()})
+			return
+		}
+
+		var existingRole models.Role
+		err := roleCollection.FindOne(ctx, bson.M{"role_id": roleId}).Decode(&existingRole)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching role"})
+			return
+		}
+
+		var updateData struct {
+			Name        *string   `json:"name" validate:"omitempty,min=2,max=100"`
+			Description *string   `json:"description" validate:"omitempty,max=500"`
+			Permissions *[]string `json:"permissions"`
+		}
+		if err := c.BindJSON(&updateData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := roleValidate.Struct(updateData)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		update := bson.M{}
+		if updateData.Name != nil {
+			update["name"] = *updateData.Name
+		}
+		if updateData.Description != nil {
+			update["description"] = *updateData.Description
+		}
+		if updateData.Permissions != nil {
+			// Removing a permission is as sensitive as granting it.
+			if !checkRolePermissions(c, append(append([]string{}, existingRole.Permissions...), *updateData.Permissions...)) {
+				return
+			}
+			update["permissions"] = *updateData.Permissions
+		}
+		update["updated_at"] = time.Now()
+
+		result, err := auditedUpdate(
+			ctx,
+			roleCollection,
+			bson.M{"role_id": roleId},
+			bson.M{"$set": update},
+			auditEntry(c, "role.updated", "role", roleId, existingRole, update, nil),
+		)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result.ModifiedCount)
+	}
+}
+
+// DeleteRole removes a custom role and takes it away from every user who
+// held it.
+func DeleteRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleId := c.Param("role_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if helper.IsBuiltInRole(roleId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "built_in_role", "message": helper.ErrBuiltInRole.Error()})
+			return
+		}
+
+		var existingRole models.Role
+		err := roleCollection.FindOne(ctx, bson.M{"role_id": roleId}).Decode(&existingRole)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching role"})
+			return
+		}
+		if !checkRolePermissions(c, existingRole.Permissions) {
+			return
+		}
+
+		var result *mongo.DeleteResult
+		err = helper.RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			var err error
+			result, err = roleCollection.DeleteOne(sessCtx, bson.M{"role_id": roleId})
+			if err != nil {
+				return err
+			}
+			_, err = userCollection.UpdateMany(
+				sessCtx,
+				bson.M{"roles": roleId},
+				bson.M{"$pull": bson.M{"roles": roleId}},
+			)
+			if err != nil {
+				return err
+			}
+			return helper.AppendAudit(sessCtx, auditEntry(c, "role.deleted", "role", roleId, existingRole, nil, nil))
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// SetUserRoles replaces the roles of a user. The caller must hold every
+// permission of the roles being added or taken away.
+func SetUserRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.Param("user_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body struct {
+			Roles []string `json:"roles"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var existingUser models.User
+		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&existingUser)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching user"})
+			return
+		}
+
+		if !authorize(c, policy.ActionAssignRoles, policy.UserOf(existingUser)) {
+			return
+		}
+
+		roles := []string{}
+		seen := map[string]bool{}
+		for _, roleId := range body.Roles {
+			if seen[roleId] {
+				continue
+			}
+			seen[roleId] = true
+			if _, err := helper.FindRole(ctx, roleId); err != nil {
+				if err == helper.ErrUnknownRole {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "unknown_role", "message": err.Error(), "role_id": roleId})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking roles"})
+				return
+			}
+			roles = append(roles, roleId)
+		}
+
+		changed := []string{}
+		for _, roleId := range roles {
+			if !containsString(existingUser.Roles, roleId) {
+				changed = append(changed, roleId)
+			}
+		}
+		for _, roleId := range existingUser.Roles {
+			if !seen[roleId] {
+				changed = append(changed, roleId)
+			}
+		}
+
+		allowed, err := helper.CanGrantRoles(ctx, c, changed)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking roles"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "you cannot grant or remove a role with permissions you do not hold"})
+			return
+		}
+
+		result, err := auditedUpdate(
+			ctx,
+			userCollection,
+			bson.M{"user_id": userId},
+			bson.M{"$set": bson.M{"roles": roles, "updated_at": time.Now().Format(time.RFC3339)}},
+			auditEntry(c, "user.roles_changed", "user", userId, bson.M{"roles": existingUser.Roles}, bson.M{"roles": roles}, nil),
+		)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update roles"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result.ModifiedCount)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
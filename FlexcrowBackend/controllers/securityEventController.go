@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"user-athentication-golang/database"
+
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var securityEventCollection *mongo.Collection = database.OpenCollection(database.Client, "security_event")
+
+func GetSecurityEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err1 := strconv.Atoi(c.Query("page"))
+		if err1 != nil || page < 1 {
+			page = 1
+		}
+
+		startIndex := (page - 1) * recordPerPage
+		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+
+		match := bson.M{}
+		if eventType := c.Query("type"); eventType != "" {
+			match["type"] = eventType
+		}
+		if userId := c.Query("user_id"); userId != "" {
+			match["user_id"] = userId
+		}
+		if email := c.Query("email"); email != "" {
+			match["email"] = strings.ToLower(email)
+		}
+		if ip := c.Query("ip_address"); ip != "" {
+			match["ip_address"] = ip
+		}
+
+		matchStage := bson.D{{"$match", match}}
+		sortStage := bson.D{{"$sort", bson.D{{"created_at", -1}}}}
+		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
+		projectStage := bson.D{
+			{"$project", bson.D{
+				{"_id", 0},
+				{"total_count", 1},
+				{"security_event_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}},
+			}}}
+
+		result, err := securityEventCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, sortStage, groupStage, projectStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing security event items"})
+			return
+		}
+
+		var allevents []struct {
+			Total_count          int                    `json:"total_count"`
+			Security_event_items []models.SecurityEvent `json:"security_event_items"`
+		}
+		if err = result.All(ctx, &allevents); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(allevents) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"total_count":          0,
+				"security_event_items": []bson.M{},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, allevents[0])
+	}
+}
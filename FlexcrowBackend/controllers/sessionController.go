@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	helper "user-athentication-golang/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.RevokeSession(ctx, c.GetString("session_id"), helper.SessionRevokedLogout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while logging out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	}
+}
+
+func GetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		sessions, err := helper.UserSessions(ctx, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"current_session_id": c.GetString("session_id"),
+			"session_items":      sessions,
+		})
+	}
+}
+
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		err := helper.RevokeUserSession(ctx, c.GetString("uid"), c.Param("session_id"), helper.SessionRevokedByUser)
+		if err == helper.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while revoking the session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
+
+// RevokeAllSessions signs the user out everywhere, including the session
+// making the request.
+func RevokeAllSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		revoked, err := helper.RevokeUserSessions(ctx, c.GetString("uid"), helper.SessionRevokedByUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while revoking sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// totpError answers for the errors the two-factor helpers return and reports
+// whether it wrote a response.
+func totpError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case err == helper.ErrTotpRequired:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "totp_required", "message": err.Error()})
+	case err == helper.ErrInvalidTotpCode:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_totp_code", "message": err.Error()})
+	case err == helper.ErrTotpAttempts:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too_many_requests", "message": err.Error()})
+	case err == helper.ErrTotpNotEnabled, err == helper.ErrTotpAlreadyEnabled, err == helper.ErrTotpNotStarted:
+		c.JSON(http.StatusConflict, gin.H{"error": "totp_state_error", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking the two-factor code"})
+	}
+	return true
+}
+
+// requireFreshTotp stops the request unless the signed-in user either has no
+// 2FA or sent a code that has not been used before.
+func requireFreshTotp(ctx context.Context, c *gin.Context, code string) bool {
+	return !totpError(c, helper.RequireFreshTotp(ctx, c.GetString("uid"), code))
+}
+
+func currentUser(ctx context.Context, c *gin.Context) (models.User, bool) {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": c.GetString("uid")}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return user, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching user"})
+		return user, false
+	}
+	return user, true
+}
+
+func SetupTotp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, ok := currentUser(ctx, c)
+		if !ok {
+			return
+		}
+
+		secret, uri, err := helper.BeginTotpEnrollment(ctx, user)
+		if totpError(c, err) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"secret": secret, "provisioning_uri": uri})
+	}
+}
+
+func EnableTotp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body totpCodeRequest
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := currentUser(ctx, c)
+		if !ok {
+			return
+		}
+
+		codes, err := helper.EnableTotp(ctx, user, body.Code, auditSource(c))
+		if totpError(c, err) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+func DisableTotp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body totpCodeRequest
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := currentUser(ctx, c)
+		if !ok {
+			return
+		}
+
+		if totpError(c, helper.DisableTotp(ctx, user, body.Code, auditSource(c))) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+func RegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body totpCodeRequest
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := currentUser(ctx, c)
+		if !ok {
+			return
+		}
+
+		codes, err := helper.RegenerateRecoveryCodes(ctx, user, body.Code)
+		if totpError(c, err) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// LoginTotp is the second login step: it trades the challenge token from
+// Login plus an authenticator or recovery code for real tokens.
+func LoginTotp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body struct {
+			Challenge_token string `json:"challenge_token"`
+			Code            string `json:"code"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, msg := helper.ValidateChallengeToken(body.Challenge_token)
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_challenge_token"})
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&user); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_challenge_token"})
+			return
+		}
+		if user.Status != nil && *user.Status == helper.UserDisabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account_disabled"})
+			return
+		}
+
+		if !loginAllowed(ctx, c, *user.Email) {
+			return
+		}
+
+		// Nobody is signed in yet, so the user is the actor.
+		source := auditSource(c)
+		source.Actor = user.User_id
+		err := helper.VerifySecondFactor(ctx, user, body.Code, source)
+		if err == helper.ErrInvalidTotpCode {
+			if err := helper.RecordLoginFailure(ctx, models.SecurityEvent{
+				User_id:    &user.User_id,
+				Email:      *user.Email,
+				Ip_address: c.ClientIP(),
+				User_agent: c.Request.UserAgent(),
+			}, "invalid_totp_code"); err != nil {
+				log.Printf("recording failed login for user %s: %v", user.User_id, err)
+			}
+		}
+		if totpError(c, err) {
+			return
+		}
+
+		finishLogin(ctx, c, user)
+	}
+}
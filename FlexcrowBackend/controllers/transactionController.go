@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"log"
 	"strconv"
 
@@ -15,6 +16,8 @@ import (
 
 	helper "user-athentication-golang/helpers"
 	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
+	"user-athentication-golang/refund"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -24,6 +27,26 @@ import (
 var transactionCollection *mongo.Collection = database.OpenCollection(database.Client, "transaction")
 var transactionValidate = validator.New()
 
+// transactionParties lists the sellers and buyers of every transaction whose
+// field is id, for resources that counterparties may see.
+func transactionParties(ctx context.Context, field string, id string) ([]string, error) {
+	parties := []string{}
+
+	cursor, err := transactionCollection.Find(ctx, bson.M{field: id})
+	if err != nil {
+		return parties, err
+	}
+	var transactions []models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return parties, err
+	}
+	for _, transaction := range transactions {
+		resource := policy.TransactionOf(transaction)
+		parties = append(parties, resource.Seller_id, resource.Buyer_id)
+	}
+	return parties, nil
+}
+
 func GetTransactions() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -55,22 +78,19 @@ func GetTransactions() gin.HandlerFunc {
 		if userIdParam == "current" {
 			matchStage = bson.D{{"$match", bson.D{{"user_id", userId}}}}
 		} else if userIdParam != "" {
-			if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			if !authorize(c, policy.ActionList, policy.Transaction{}) {
 				return
 			}
 			matchStage = bson.D{{"$match", bson.D{{"user_id", userIdParam}}}}
 		} else if customerIdParam == "current" {
 			matchStage = bson.D{{"$match", bson.D{{"customer_id", userId}}}}
 		} else if customerIdParam != "" {
-			if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			if !authorize(c, policy.ActionList, policy.Transaction{}) {
 				return
 			}
 			matchStage = bson.D{{"$match", bson.D{{"customer_id", customerIdParam}}}}
 		} else {
-			if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			if !authorize(c, policy.ActionList, policy.Transaction{}) {
 				return
 			}
 			matchStage = bson.D{{"$match", bson.D{{}}}}
@@ -91,7 +111,11 @@ func GetTransactions() gin.HandlerFunc {
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing transaction items"})
 		}
-		var alltransactions []bson.M
+		// Decode into the models so money fields render as plain numbers.
+		var alltransactions []struct {
+			Total_count       int                  `json:"total_count"`
+			Transaction_items []models.Transaction `json:"transaction_items"`
+		}
 		if err = result.All(ctx, &alltransactions); err != nil {
 			log.Fatal(err)
 		}
@@ -115,12 +139,6 @@ func GetTransaction() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in token"})
-			return
-		}
-
 		var transaction models.Transaction
 		err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": transactionId}).Decode(&transaction)
 		if err != nil {
@@ -132,24 +150,11 @@ func GetTransaction() gin.HandlerFunc {
 			return
 		}
 
-		userIdParam := c.Query("user_id")
-		customerIdParam := c.Query("customer_id")
-		userIdStr := userId.(string)
-
-		if userIdParam == "current" && *transaction.User_id == userIdStr {
-			c.JSON(http.StatusOK, transaction)
+		if !authorize(c, policy.ActionRead, policy.TransactionOf(transaction)) {
 			return
-		} else if customerIdParam == "current" && *transaction.Customer_id == userIdStr {
-			c.JSON(http.StatusOK, transaction)
-			return
-		} else {
-			if err := helper.CheckUserType(c, "ADMIN"); err == nil {
-				c.JSON(http.StatusOK, transaction)
-				return
-			}
 		}
 
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusOK, transaction)
 	}
 }
 
@@ -158,6 +163,10 @@ func CreateTransaction() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		if !requireVerifiedEmail(ctx, c) {
+			return
+		}
+
 		var transaction models.Transaction
 
 		if err := c.BindJSON(&transaction); err != nil {
@@ -237,11 +246,7 @@ func CreateTransaction() gin.HandlerFunc {
 			}
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
+		canManage := can(c, policy.ActionManage, policy.Transaction{})
 
 		userId, exists := c.Get("uid")
 		if !exists {
@@ -249,7 +254,7 @@ func CreateTransaction() gin.HandlerFunc {
 			return
 		}
 
-		if userType != "ADMIN" {
+		if !canManage {
 			userIdStr := userId.(string)
 			transaction.User_id = &userIdStr
 		} else {
@@ -267,8 +272,8 @@ func CreateTransaction() gin.HandlerFunc {
 			transaction.User_id = &userID
 		}
 
-		if transaction.Status == nil {
-			status := 1
+		if transaction.Status == nil || !canManage {
+			status := helper.TransactionPending
 			transaction.Status = &status
 		}
 
@@ -279,7 +284,30 @@ func CreateTransaction() gin.HandlerFunc {
 		transaction.ID = primitive.NewObjectID()
 		transaction.Transaction_id = transaction.ID.Hex()
 
-		resultInsertionNumber, insertErr := transactionCollection.InsertOne(ctx, transaction)
+		// Currency and rate come from the product and the rate table, not the client.
+		transaction.Currency = nil
+		transaction.Exchange_rate = nil
+		transaction.Amount_charged = nil
+
+		schedule, err := helper.CurrentFeeSchedule(ctx, transaction.Created_at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while loading fee schedule"})
+			return
+		}
+		if err := helper.PriceTransaction(ctx, &transaction, schedule); err != nil {
+			if errors.Is(err, helper.ErrNoExchangeRate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "exchange_rate_unavailable", "message": err.Error()})
+				return
+			}
+			if errors.Is(err, helper.ErrProductNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "product_error", "message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while computing fee"})
+			return
+		}
+
+		resultInsertionNumber, insertErr := auditedInsert(ctx, transactionCollection, transaction, auditEntry(c, "transaction.created", "transaction", transaction.Transaction_id, nil, transaction, nil))
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create transaction"})
 			return
@@ -306,24 +334,17 @@ func UpdateTransaction() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
 		userId, exists := c.Get("uid")
 		if !exists {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
 			return
 		}
 
-		if userType != "ADMIN" {
-			if *existingTransaction.User_id != userId.(string) && *existingTransaction.Customer_id != userId.(string) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this transaction"})
-				return
-			}
+		resource := policy.TransactionOf(existingTransaction)
+		if !authorize(c, policy.ActionUpdate, resource) {
+			return
 		}
+		role := helper.TransactionRole(can(c, policy.ActionManage, resource), userId.(string), *existingTransaction.User_id, *existingTransaction.Customer_id)
 
 		var updateData models.Transaction
 		if err := c.BindJSON(&updateData); err != nil {
@@ -331,6 +352,61 @@ func UpdateTransaction() gin.HandlerFunc {
 			return
 		}
 
+		if role != helper.RoleAdmin {
+			updateData.Payment_id = nil
+		}
+
+		if updateData.Status != nil {
+			paid, err := helper.TransactionPaid(ctx, existingTransaction)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking escrow"})
+				return
+			}
+			if err := helper.CheckTransactionTransition(*existingTransaction.Status, *updateData.Status, role, paid); err != nil {
+				transitionErr := err.(*helper.TransitionError)
+				c.JSON(http.StatusConflict, gin.H{"error": transitionErr.Code, "message": transitionErr.Message})
+				return
+			}
+		}
+
+		if updateData.Status != nil && *updateData.Status != *existingTransaction.Status {
+			if *updateData.Status == helper.TransactionDisputed {
+				c.JSON(http.StatusConflict, gin.H{"error": "dispute_required", "message": "open a dispute through /disputes"})
+				return
+			}
+
+			if *existingTransaction.Status == helper.TransactionDisputed {
+				open, err := helper.HasOpenDispute(ctx, transactionId)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking disputes"})
+					return
+				}
+				if open {
+					c.JSON(http.StatusConflict, gin.H{"error": "dispute_open", "message": "resolve the dispute through /disputes"})
+					return
+				}
+			}
+		}
+
+		// The price is what the buyer pays into escrow, so it is fixed once
+		// the transaction moves on or any money has arrived.
+		repricing := updateData.Product_id != nil || updateData.Product_number != nil || updateData.Shipping_price != nil || updateData.Fee_type != nil
+		if repricing {
+			if *existingTransaction.Status != helper.TransactionPending {
+				c.JSON(http.StatusConflict, gin.H{"error": "pricing_locked", "message": "the price can only change while the transaction is pending"})
+				return
+			}
+			paid, err := helper.TransactionPaid(ctx, existingTransaction)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking escrow"})
+				return
+			}
+			if paid {
+				c.JSON(http.StatusConflict, gin.H{"error": "pricing_locked", "message": "the price cannot change once the transaction is paid"})
+				return
+			}
+		}
+
 		if updateData.Product_id != nil && *updateData.Product_id != "" {
 			var product models.Product
 			errProduct := productCollection.FindOne(context.TODO(), bson.M{"product_id": updateData.Product_id}).Decode(&product)
@@ -416,27 +492,137 @@ func UpdateTransaction() gin.HandlerFunc {
 		if updateData.Delivered_details != nil {
 			update["delivered_details"] = updateData.Delivered_details
 		}
-		if updateData.Fee != nil {
-			update["fee"] = updateData.Fee
-		}
 		if updateData.Fee_type != nil {
 			update["fee_type"] = updateData.Fee_type
 		}
 
+		pricedTransaction := existingTransaction
+		if repricing {
+			if updateData.Product_id != nil {
+				pricedTransaction.Product_id = updateData.Product_id
+			}
+			if updateData.Product_number != nil {
+				pricedTransaction.Product_number = updateData.Product_number
+			}
+			if updateData.Shipping_price != nil {
+				pricedTransaction.Shipping_price = updateData.Shipping_price
+			}
+			if updateData.Fee_type != nil {
+				pricedTransaction.Fee_type = updateData.Fee_type
+			}
+
+			schedule, err := helper.TransactionFeeSchedule(ctx, existingTransaction)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while loading fee schedule"})
+				return
+			}
+			if err := helper.PriceTransaction(ctx, &pricedTransaction, schedule); err != nil {
+				if errors.Is(err, helper.ErrNoExchangeRate) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "exchange_rate_unavailable", "message": err.Error()})
+					return
+				}
+				if errors.Is(err, helper.ErrProductNotFound) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "product_error", "message": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while computing fee"})
+				return
+			}
+
+			update["currency"] = pricedTransaction.Currency
+			update["shipping_price"] = pricedTransaction.Shipping_price
+			update["payment_currency"] = pricedTransaction.Payment_currency
+			update["exchange_rate"] = pricedTransaction.Exchange_rate
+			update["amount_charged"] = pricedTransaction.Amount_charged
+			update["fee"] = pricedTransaction.Fee
+			update["fee_schedule_id"] = pricedTransaction.Fee_schedule_id
+			update["amount_buyer"] = pricedTransaction.Amount_buyer
+			update["amount_seller"] = pricedTransaction.Amount_seller
+		}
+
 		update["updated_at"] = time.Now().Format(time.RFC3339)
 
-		result, err := transactionCollection.UpdateOne(
+		if updateData.Status != nil && *updateData.Status == helper.TransactionCompleted && *existingTransaction.Status != helper.TransactionCompleted {
+			err := helper.CompleteTransaction(ctx, pricedTransaction, update, auditEntry(c, "transaction.updated", "transaction", transactionId, existingTransaction, update, nil))
+			if err == helper.ErrStatusConflict {
+				c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+				return
+			}
+			if err == helper.ErrTransactionNotPaid {
+				c.JSON(http.StatusConflict, gin.H{"error": "transaction_not_paid", "message": err.Error()})
+				return
+			}
+			if errors.Is(err, helper.ErrEscrowOverdrawn) {
+				c.JSON(http.StatusConflict, gin.H{"error": "escrow_overdrawn", "message": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to complete transaction"})
+				return
+			}
+
+			c.JSON(http.StatusOK, 1)
+			return
+		}
+
+		if updateData.Status != nil && (*updateData.Status == helper.TransactionCanceled || *updateData.Status == helper.TransactionRejected) && *existingTransaction.Status != *updateData.Status {
+			// Only the buyer, or an admin on their behalf, may take the refund as balance.
+			refundTo := c.Query("refund_to")
+			if role == helper.RoleSeller {
+				refundTo = ""
+			}
+			if refundTo != "" && refundTo != helper.RefundToCard && refundTo != helper.RefundToBalance {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "refund_to_error"})
+				return
+			}
+
+			err := helper.CancelTransaction(ctx, refund.Provider(), existingTransaction, update, helper.RefundRequest{
+				Destination: refundTo,
+				Source:      auditSource(c),
+				Reason:      "transaction " + helper.TransactionStatusName(*updateData.Status),
+			}, auditEntry(c, "transaction.updated", "transaction", transactionId, existingTransaction, update, nil))
+			switch {
+			case err == nil:
+			case err == helper.ErrStatusConflict:
+				c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+				return
+			case err == helper.ErrNoRefundablePayment:
+				c.JSON(http.StatusConflict, gin.H{"error": "no_refundable_payment", "message": err.Error()})
+				return
+			case errors.Is(err, helper.ErrEscrowOverdrawn):
+				c.JSON(http.StatusConflict, gin.H{"error": "escrow_overdrawn", "message": err.Error()})
+				return
+			case errors.Is(err, helper.ErrRefundFailed):
+				c.JSON(http.StatusBadGateway, gin.H{"error": "refund_failed", "message": err.Error()})
+				return
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update transaction"})
+				return
+			}
+
+			c.JSON(http.StatusOK, 1)
+			return
+		}
+
+		filter := bson.M{"transaction_id": transactionId, "status": existingTransaction.Status}
+		if repricing {
+			// A payment attached since the check above was for the old price.
+			filter["payment_id"] = existingTransaction.Payment_id
+		}
+
+		result, err := auditedUpdate(
 			ctx,
-			bson.M{"transaction_id": transactionId},
+			transactionCollection,
+			filter,
 			bson.M{"$set": update},
+			auditEntry(c, "transaction.updated", "transaction", transactionId, existingTransaction, update, nil),
 		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update transaction"})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": "transaction status changed while updating, please retry"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update transaction"})
 			return
 		}
 
@@ -446,15 +632,14 @@ func UpdateTransaction() gin.HandlerFunc {
 
 func DeleteTransaction() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionDelete, policy.Transaction{}) {
 			return
 		}
 
 		transactionId := c.Param("transaction_id")
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := transactionCollection.DeleteOne(ctx, bson.M{"transaction_id": transactionId})
+		result, err := auditedDelete(ctx, c, transactionCollection, bson.M{"transaction_id": transactionId}, "transaction.deleted", "transaction", transactionId)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete transaction"})
@@ -464,3 +649,88 @@ func DeleteTransaction() gin.HandlerFunc {
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+func RefundTransaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionId := c.Param("transaction_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var refundRequest struct {
+			Amount    *models.Money `json:"amount"`
+			Refund_to string        `json:"refund_to" validate:"omitempty,eq=card|eq=balance"`
+			Reason    string        `json:"reason" validate:"max=500"`
+		}
+		if err := c.BindJSON(&refundRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := transactionValidate.Struct(refundRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var transaction models.Transaction
+		err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": transactionId}).Decode(&transaction)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching transaction"})
+			return
+		}
+
+		if !authorize(c, policy.ActionRefund, policy.TransactionOf(transaction)) {
+			return
+		}
+
+		// Without an amount the whole remaining escrow is refunded.
+		amount := refundRequest.Amount
+		if amount != nil {
+			converted := amount.WithCurrency(helper.TransactionCurrency(transaction))
+			amount = &converted
+		}
+		if amount == nil {
+			held, err := helper.EscrowHeld(ctx, transaction)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading escrow"})
+				return
+			}
+			amount = &held
+		}
+
+		refundPayment, err := helper.RefundTransaction(ctx, refund.Provider(), transaction, helper.RefundRequest{
+			Amount:      *amount,
+			Destination: refundRequest.Refund_to,
+			Source:      auditSource(c),
+			Reason:      refundRequest.Reason,
+		}, auditEntry(c, "transaction.refunded", "transaction", transactionId, nil, nil, map[string]interface{}{
+			"amount":    *amount,
+			"refund_to": refundRequest.Refund_to,
+			"reason":    refundRequest.Reason,
+		}))
+		switch {
+		case err == nil:
+		case err == helper.ErrRefundExceedsEscrow:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount_error", "message": err.Error()})
+			return
+		case errors.Is(err, helper.ErrEscrowOverdrawn):
+			c.JSON(http.StatusConflict, gin.H{"error": "escrow_overdrawn", "message": err.Error()})
+			return
+		case err == helper.ErrNoRefundablePayment:
+			c.JSON(http.StatusConflict, gin.H{"error": "no_refundable_payment", "message": err.Error()})
+			return
+		case errors.Is(err, helper.ErrRefundFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": "refund_failed", "message": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refund transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, refundPayment)
+	}
+}
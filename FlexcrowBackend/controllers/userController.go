@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 
 	"net/http"
 	"time"
@@ -16,6 +18,7 @@ import (
 
 	helper "user-athentication-golang/helpers"
 	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -60,6 +63,10 @@ func SignUp() gin.HandlerFunc {
 
 		defaultStatus := 1
 		user.Status = &defaultStatus
+		// ADMIN is the superuser role, so nobody can sign up as one.
+		userType := "USER"
+		user.User_type = &userType
+		user.Roles = nil
 
 		validationErr := validate.Struct(user)
 		if validationErr != nil {
@@ -95,9 +102,10 @@ func SignUp() gin.HandlerFunc {
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
-		token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, *&user.User_id)
-		user.Token = &token
-		user.Refresh_token = &refreshToken
+		user.Token = nil
+		user.Refresh_token = nil
+		user.Email_verified_at = nil
+		user.Totp_enabled = false
 
 		resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
 		if insertErr != nil {
@@ -105,6 +113,11 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
+		// The account exists either way; a lost email can be sent again.
+		if err := helper.SendVerificationEmail(ctx, user); err != nil {
+			log.Printf("sending verification email to user %s: %v", user.User_id, err)
+		}
+
 		c.JSON(http.StatusOK, resultInsertionNumber)
 
 	}
@@ -113,6 +126,8 @@ func SignUp() gin.HandlerFunc {
 func Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
 		var user models.User
 		var foundUser models.User
 
@@ -120,44 +135,342 @@ func Login() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if user.Email == nil || user.Password == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email and password are required"})
+			return
+		}
+
+		if !loginAllowed(ctx, c, *user.Email) {
+			return
+		}
 
 		err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+		if err == mongo.ErrNoDocuments {
+			loginFailed(ctx, c, *user.Email, nil, "unknown_email")
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching user"})
+			return
+		}
+
+		passwordIsValid, _ := VerifyPassword(*user.Password, *foundUser.Password)
+		if !passwordIsValid {
+			loginFailed(ctx, c, *user.Email, &foundUser.User_id, "wrong_password")
+			return
+		}
+
+		if foundUser.Status != nil && *foundUser.Status == helper.UserDisabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account_disabled"})
+			return
+		}
+
+		if foundUser.Totp_enabled {
+			challengeToken, err := helper.GenerateChallengeToken(foundUser.User_id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while starting the login"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge_token": challengeToken})
+			return
+		}
+
+		finishLogin(ctx, c, foundUser)
+	}
+}
+
+// loginAllowed answers 429 while the account or client IP is locked out.
+func loginAllowed(ctx context.Context, c *gin.Context, email string) bool {
+	err := helper.CheckLoginAllowed(ctx, email, c.ClientIP())
+	if locked, ok := err.(*helper.LoginLockedError); ok {
+		c.Header("Retry-After", strconv.Itoa(locked.RetryAfter()))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "too_many_attempts",
+			"message":     locked.Error(),
+			"retry_after": locked.RetryAfter(),
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking login attempts"})
+		return false
+	}
+	return true
+}
+
+// loginFailed records the failure and answers 401 without saying whether the
+// email or the password was wrong.
+func loginFailed(ctx context.Context, c *gin.Context, email string, userId *string, reason string) {
+	err := helper.RecordLoginFailure(ctx, models.SecurityEvent{
+		User_id:    userId,
+		Email:      email,
+		Ip_address: c.ClientIP(),
+		User_agent: c.Request.UserAgent(),
+	}, reason)
+	if err != nil {
+		log.Printf("recording failed login for %s: %v", email, err)
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_credentials", "message": "email or password is incorrect"})
+}
+
+// loginResponse is the signed-in user with their new tokens, which are only
+// ever sent here and in the refresh response.
+type loginResponse struct {
+	models.User
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+}
+
+// finishLogin opens a session for a user who has passed every login step
+// and responds with the user and their new tokens.
+func finishLogin(ctx context.Context, c *gin.Context, foundUser models.User) {
+	if err := helper.ClearLoginFailures(ctx, *foundUser.Email); err != nil {
+		log.Printf("clearing failed logins for user %s: %v", foundUser.User_id, err)
+	}
+
+	token, refreshToken, err := helper.StartSession(ctx, foundUser, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while starting the session"})
+		return
+	}
+
+	err = userCollection.FindOne(ctx, bson.M{"user_id": foundUser.User_id}).Decode(&foundUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse{User: foundUser, Token: token, Refresh_token: refreshToken})
+}
+
+func RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
+
+		var body struct {
+			Refresh_token string `json:"refresh_token"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, refreshToken, err := helper.RotateRefreshToken(ctx, body.Refresh_token)
+		switch {
+		case err == helper.ErrInvalidRefreshToken:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_refresh_token"})
+			return
+		case err == helper.ErrRefreshTokenReused:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh_token_reused", "message": err.Error()})
+			return
+		case err == helper.ErrSessionRevoked:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session_revoked"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while refreshing the token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+	}
+}
+
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := helper.VerifyEmail(ctx, body.Token)
+		if err == helper.ErrInvalidUserToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_token", "message": err.Error()})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "login or passowrd is incorrect 555"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while verifying the email"})
 			return
 		}
 
-		passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+	}
+}
+
+// ResendVerificationEmail answers the same way whether or not the address
+// belongs to an account, so it cannot be used to discover users.
+func ResendVerificationEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
-		if passwordIsValid != true {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		if foundUser.Email == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		for _, limit := range []struct {
+			key   string
+			count int
+		}{
+			{"resend_verification:ip:" + c.ClientIP(), 10},
+			{"resend_verification:email:" + strings.ToLower(body.Email), 3},
+		} {
+			allowed, err := helper.AllowRate(ctx, limit.key, limit.count, time.Hour)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while sending the email"})
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "too_many_requests", "message": "Too many verification requests; try again later"})
+				return
+			}
+		}
+
+		var user models.User
+		err := userCollection.FindOne(ctx, bson.M{"email": body.Email, "email_verified_at": nil}).Decode(&user)
+		if err == nil {
+			if err := helper.SendVerificationEmail(ctx, user); err != nil {
+				log.Printf("sending verification email to user %s: %v", user.User_id, err)
+			}
+		} else if err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while sending the email"})
 			return
 		}
-		token, refreshToken, _ := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id)
 
-		helper.UpdateAllTokens(token, refreshToken, foundUser.User_id)
-		err = userCollection.FindOne(ctx, bson.M{"user_id": foundUser.User_id}).Decode(&foundUser)
+		c.JSON(http.StatusOK, gin.H{"message": "If the address needs verifying, an email is on its way"})
+	}
+}
+
+// ForgotPassword answers the same way for known and unknown addresses and
+// sends the email in the background, so neither the body nor the response
+// time gives away whether an account exists.
+func ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var body struct {
+			Email string `json:"email" validate:"required,email"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email_error"})
+			return
+		}
+
+		for _, limit := range []struct {
+			key   string
+			count int
+		}{
+			{"forgot_password:ip:" + c.ClientIP(), 10},
+			{"forgot_password:email:" + strings.ToLower(body.Email), 3},
+		} {
+			allowed, err := helper.AllowRate(ctx, limit.key, limit.count, time.Hour)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while sending the email"})
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "too_many_requests", "message": "Too many reset requests; try again later"})
+				return
+			}
+		}
+
+		go func(email string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+			defer cancel()
+			if err := helper.SendPasswordReset(ctx, email); err != nil {
+				log.Printf("sending password reset email: %v", err)
+			}
+		}(body.Email)
+
+		c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an account, a reset link is on its way"})
+	}
+}
+
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
+		var body struct {
+			Token       string `json:"token" binding:"required"`
+			NewPassword string `json:"new_password" binding:"required,min=6"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := helper.ResetPassword(ctx, body.Token, HashPassword(body.NewPassword), auditSource(c))
+		if err == helper.ErrInvalidUserToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_token", "message": err.Error()})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while resetting the password"})
 			return
 		}
 
-		c.JSON(http.StatusOK, foundUser)
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+	}
+}
 
+// requireVerifiedEmail stops the request with 403 when the signed-in user
+// has not verified their email address.
+func requireVerifiedEmail(ctx context.Context, c *gin.Context) bool {
+	err := helper.RequireVerifiedEmail(ctx, c.GetString("uid"))
+	if err == helper.ErrEmailNotVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email_not_verified", "message": err.Error()})
+		return false
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking the user"})
+		return false
+	}
+	return true
+}
+
+// can asks the policy whether the signed-in user may perform action on
+// resource.
+func can(c *gin.Context, action string, resource policy.Resource) bool {
+	return policy.Can(helper.CurrentActor(c), action, resource)
+}
+
+// authorize stops the request with 403 unless the signed-in user may perform
+// action on resource.
+func authorize(c *gin.Context, action string, resource policy.Resource) bool {
+	if can(c, action, resource) {
+		return true
+	}
+	message := fmt.Sprintf("you are not authorized to %s this %s", strings.ReplaceAll(action, "_", " "), resource.Kind())
+	switch action {
+	case policy.ActionRead:
+		message = fmt.Sprintf("you are not authorized to view this %s", resource.Kind())
+	case policy.ActionList:
+		message = fmt.Sprintf("you are not authorized to list every %s", resource.Kind())
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": message})
+	return false
 }
 
 func GetUsers() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionList, policy.User{}) {
 			return
 		}
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -191,7 +504,11 @@ func GetUsers() gin.HandlerFunc {
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
 		}
-		var allusers []bson.M
+		// Decode into the models so money fields render as plain numbers.
+		var allusers []struct {
+			Total_count int           `json:"total_count"`
+			User_items  []models.User `json:"user_items"`
+		}
 		if err = result.All(ctx, &allusers); err != nil {
 			log.Fatal(err)
 		}
@@ -204,8 +521,7 @@ func GetUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userId := c.Param("user_id")
 
-		if err := helper.MatchUserTypeToUid(c, userId); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionRead, policy.User{User_id: userId}) {
 			return
 		}
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -245,11 +561,6 @@ func GetCurrentUser() gin.HandlerFunc {
 
 func CreateUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var user models.User
 
@@ -286,6 +597,16 @@ func CreateUser() gin.HandlerFunc {
 			return
 		}
 
+		if !authorize(c, policy.ActionCreate, policy.User{}) {
+			return
+		}
+		if *user.User_type == "ADMIN" && !can(c, policy.ActionChangeType, policy.User{}) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "only a superuser can create ADMIN users"})
+			return
+		}
+		// Roles are granted through PUT /users/:user_id/roles.
+		user.Roles = nil
+
 		password := HashPassword(*user.Password)
 		user.Password = &password
 
@@ -293,8 +614,12 @@ func CreateUser() gin.HandlerFunc {
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
+		// Accounts an admin creates are treated as verified.
+		verifiedAt := time.Now()
+		user.Email_verified_at = &verifiedAt
+		user.Totp_enabled = false
 
-		resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
+		resultInsertionNumber, insertErr := auditedInsert(ctx, userCollection, user, auditEntry(c, "user.created", "user", user.User_id, nil, user, nil))
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
 			return
@@ -321,11 +646,11 @@ func UpdateUser() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
+		resource := policy.UserOf(existingUser)
+		if !authorize(c, policy.ActionUpdate, resource) {
 			return
 		}
+		canEdit := can(c, policy.ActionManage, resource)
 
 		contextUserId, exists := c.Get("uid")
 		if !exists {
@@ -339,15 +664,6 @@ func UpdateUser() gin.HandlerFunc {
 			return
 		}
 
-		transactionParam := c.Query("transaction")
-
-		if userType != "ADMIN" {
-			if (existingUser.User_id != userIdStr && transactionParam != "true") || (existingUser.Status != nil && *existingUser.Status != 1) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this user"})
-				return
-			}
-		}
-
 		var updateData models.User
 		if err := c.BindJSON(&updateData); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -384,13 +700,48 @@ func UpdateUser() gin.HandlerFunc {
 			}
 		}
 
+		// Users change their own password through /users/:user_id/password,
+		// which checks the current password and 2FA; staff may reset others'.
+		if updateData.Password != nil && *updateData.Password != "" && (!canEdit || userId == userIdStr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password_error", "message": "change the password through /users/" + userId + "/password"})
+			return
+		}
+
 		update := bson.M{}
 
+		if !canEdit {
+			updateData.User_type = nil
+			updateData.Status = nil
+		}
+		if !can(c, policy.ActionEditBalance, resource) {
+			updateData.Balance = nil
+			updateData.Wallets = nil
+		}
+		// Making or unmaking an ADMIN changes who is a superuser.
+		if updateData.User_type != nil && *updateData.User_type != *existingUser.User_type && !can(c, policy.ActionChangeType, resource) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": "only a superuser can change the user type"})
+			return
+		}
+
+		// Admins set balances per currency; balance is the default currency wallet.
+		targets := map[string]models.Money{}
+		for currency, amount := range updateData.Wallets {
+			currency = strings.ToUpper(currency)
+			targets[currency] = amount.WithCurrency(currency)
+		}
+		if updateData.Balance != nil {
+			targets[models.DefaultCurrency] = *updateData.Balance
+		}
+
 		if updateData.Username != nil {
 			update["username"] = updateData.Username
 		}
 		if updateData.Email != nil {
 			update["email"] = updateData.Email
+			if *updateData.Email != *existingUser.Email {
+				update["email_changed_at"] = time.Now()
+				update["email_verified_at"] = nil
+			}
 		}
 		if updateData.First_name != nil {
 			update["first_name"] = updateData.First_name
@@ -407,9 +758,6 @@ func UpdateUser() gin.HandlerFunc {
 		if updateData.Status != nil {
 			update["status"] = updateData.Status
 		}
-		if updateData.Balance != nil {
-			update["balance"] = updateData.Balance
-		}
 		if updateData.Image_id != nil {
 			update["image_id"] = updateData.Image_id
 		}
@@ -420,15 +768,60 @@ func UpdateUser() gin.HandlerFunc {
 		if updateData.Password != nil && *updateData.Password != "" {
 			hashedPassword := HashPassword(*updateData.Password)
 			update["password"] = &hashedPassword
+			update["password_changed_at"] = time.Now()
 		}
 
 		update["updated_at"] = time.Now().Format(time.RFC3339)
 
-		result, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"user_id": userId},
-			bson.M{"$set": update},
-		)
+		var result *mongo.UpdateResult
+		err = helper.RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			var err error
+			result, err = userCollection.UpdateOne(
+				sessCtx,
+				bson.M{"user_id": userId},
+				bson.M{"$set": update},
+			)
+			if err != nil {
+				return err
+			}
+
+			if reason := revokeReason(updateData.Status, update); reason != "" {
+				if _, err := helper.RevokeUserSessions(sessCtx, userId, reason); err != nil {
+					return err
+				}
+			}
+			var currentUser models.User
+			if err := userCollection.FindOne(sessCtx, bson.M{"user_id": userId}).Decode(&currentUser); err != nil {
+				return err
+			}
+			wallets := helper.UserWallets(currentUser)
+
+			for currency, target := range targets {
+				current, ok := wallets[currency]
+				if !ok {
+					current = models.NewMoney(0, currency)
+				}
+				delta := target.Sub(current)
+				if delta.IsZero() {
+					continue
+				}
+
+				ref := helper.LedgerRef{Created_by: &userIdStr}
+				err := helper.PostLedger(sessCtx,
+					helper.LedgerEntry(helper.AccountAdjustment, helper.LedgerAdjustment, delta.Neg(), ref),
+					helper.LedgerEntry(userId, helper.LedgerAdjustment, delta, ref),
+				)
+				if err != nil {
+					return err
+				}
+			}
+
+			var updatedUser models.User
+			if err := userCollection.FindOne(sessCtx, bson.M{"user_id": userId}).Decode(&updatedUser); err != nil {
+				return err
+			}
+			return helper.AppendAudit(sessCtx, auditEntry(c, "user.updated", "user", userId, existingUser, updatedUser, nil))
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
 			return
@@ -439,21 +832,67 @@ func UpdateUser() gin.HandlerFunc {
 			return
 		}
 
+		if _, changed := update["email_verified_at"]; changed {
+			existingUser.Email = updateData.Email
+			if err := helper.SendVerificationEmail(ctx, existingUser); err != nil {
+				log.Printf("sending verification email to user %s: %v", userId, err)
+			}
+		}
+
 		c.JSON(http.StatusOK, result.ModifiedCount)
 	}
 }
 
-func DeleteUser() gin.HandlerFunc {
+// revokeReason says why an update to a user should sign them out everywhere,
+// or returns "" when it should not.
+func revokeReason(status *int, update bson.M) string {
+	if status != nil && *status == helper.UserDisabled {
+		return helper.SessionRevokedUserDisabled
+	}
+	if _, ok := update["password"]; ok {
+		return helper.SessionRevokedPasswordChange
+	}
+	return ""
+}
+
+func UnlockUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		err := userCollection.FindOne(ctx, bson.M{"user_id": c.Param("user_id")}).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching user"})
+			return
+		}
+
+		if !authorize(c, policy.ActionUnlock, policy.UserOf(user)) {
+			return
+		}
+
+		if err := helper.UnlockAccount(ctx, user, auditSource(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while unlocking the account"})
 			return
 		}
 
+		c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+	}
+}
+
+func DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
 		userId := c.Param("user_id")
+		if !authorize(c, policy.ActionDelete, policy.User{User_id: userId}) {
+			return
+		}
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := userCollection.DeleteOne(ctx, bson.M{"user_id": userId})
+		result, err := auditedDelete(ctx, c, userCollection, bson.M{"user_id": userId}, "user.deleted", "user", userId)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
@@ -500,6 +939,7 @@ func GetUsernameByID() gin.HandlerFunc {
 			"user_type":  user.User_type,
 			"phone":      user.Phone,
 			"balance":    user.Balance,
+			"wallets":    helper.UserWallets(user),
 			"image_id":   user.Image_id,
 		}
 
@@ -527,18 +967,34 @@ func GetCurrentUserData() gin.HandlerFunc {
 			return
 		}
 
+		granted, err := helper.RolePermissions(ctx, helper.UserRoles(user))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching user data"})
+			return
+		}
+		permissions := []string{}
+		for permission := range granted {
+			permissions = append(permissions, permission)
+		}
+		sort.Strings(permissions)
+
 		userData := gin.H{
-			"user_id":    user.User_id,
-			"username":   user.Username,
-			"email":      user.Email,
-			"first_name": user.First_name,
-			"last_name":  user.Last_name,
-			"user_type":  user.User_type,
-			"status":     user.Status,
-			"balance":    user.Balance,
-			"image_id":   user.Image_id,
-			"address_id": user.Address_id,
-			"phone":      user.Phone,
+			"user_id":           user.User_id,
+			"username":          user.Username,
+			"email":             user.Email,
+			"first_name":        user.First_name,
+			"last_name":         user.Last_name,
+			"user_type":         user.User_type,
+			"status":            user.Status,
+			"balance":           user.Balance,
+			"wallets":           helper.UserWallets(user),
+			"image_id":          user.Image_id,
+			"address_id":        user.Address_id,
+			"phone":             user.Phone,
+			"email_verified_at": user.Email_verified_at,
+			"totp_enabled":      user.Totp_enabled,
+			"roles":             helper.UserRoles(user),
+			"permissions":       permissions,
 		}
 
 		c.JSON(http.StatusOK, userData)
@@ -562,27 +1018,14 @@ func UpdatePassword() gin.HandlerFunc {
 			return
 		}
 
-		contextUserId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
-			return
-		}
-
-		userIdStr, ok := contextUserId.(string)
-		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id in context is not a valid string"})
-			return
-		}
-
-		userType, _ := c.Get("user_type")
-		if userType != "ADMIN" && existingUser.User_id != userIdStr {
-			c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this user's password"})
+		if !authorize(c, policy.ActionChangePassword, policy.UserOf(existingUser)) {
 			return
 		}
 
 		type PasswordUpdate struct {
 			CurrentPassword string `json:"current_password" binding:"required"`
 			NewPassword     string `json:"new_password" binding:"required,min=6"`
+			TotpCode        string `json:"totp_code"`
 		}
 
 		var passwordData PasswordUpdate
@@ -602,24 +1045,39 @@ func UpdatePassword() gin.HandlerFunc {
 			return
 		}
 
+		if !requireFreshTotp(ctx, c, passwordData.TotpCode) {
+			return
+		}
+
 		hashedPassword := HashPassword(passwordData.NewPassword)
 
-		result, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"user_id": userId},
-			bson.M{"$set": bson.M{
-				"password":   hashedPassword,
-				"updated_at": time.Now().Format(time.RFC3339),
-			}},
-		)
+		// The new password and signing out every session stand or fall together.
+		err = audited(ctx, auditEntry(c, "user.password_changed", "user", userId, nil, nil, nil), func(sessCtx mongo.SessionContext) error {
+			result, err := userCollection.UpdateOne(
+				sessCtx,
+				bson.M{"user_id": userId},
+				bson.M{"$set": bson.M{
+					"password":            hashedPassword,
+					"password_changed_at": time.Now(),
+					"updated_at":          time.Now().Format(time.RFC3339),
+				}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return mongo.ErrNoDocuments
+			}
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
+			_, err = helper.RevokeUserSessions(sessCtx, userId, helper.SessionRevokedPasswordChange)
+			return err
+		})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 			return
 		}
-
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
 			return
 		}
 
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/refund"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+const maxWebhookBodyBytes = int64(65536)
+
+func StripeWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+		if webhookSecret == "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Stripe webhook secret not configured"})
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodyBytes))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+
+		event, err := webhook.ConstructEvent(payload, c.GetHeader("Stripe-Signature"), webhookSecret)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_signature"})
+			return
+		}
+
+		err = helper.HandleStripeEvent(ctx, refund.Provider(), event)
+		if err == helper.ErrEventProcessed {
+			c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+			return
+		}
+		if err == helper.ErrPaymentMismatch {
+			// Nothing is booked; the charge has to be looked at by hand.
+			log.Printf("stripe event %s (%s) charged a different amount than its payment", event.ID, event.Type)
+			c.JSON(http.StatusOK, gin.H{"received": true})
+			return
+		}
+		if err == helper.ErrPaymentNotFound {
+			log.Printf("stripe event %s (%s) does not reference a known payment", event.ID, event.Type)
+			c.JSON(http.StatusOK, gin.H{"received": true})
+			return
+		}
+		if err != nil {
+			log.Printf("failed to handle stripe event %s: %v", event.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to handle event"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	}
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func stripeSignature(payload []byte, secret string, at time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%x", at.Unix(), webhook.ComputeSignature(at, payload, secret))
+}
+
+func postWebhook(payload []byte, signature string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/webhooks/stripe", StripeWebhook())
+
+	request := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", bytes.NewReader(payload))
+	if signature != "" {
+		request.Header.Set("Stripe-Signature", signature)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestStripeWebhookRejectsBadSignatures(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", testWebhookSecret)
+
+	payload := []byte(`{"id":"evt_1","object":"event","type":"checkout.session.completed","data":{"object":{}}}`)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+	}{
+		{"unsigned", payload, ""},
+		{"signed with another secret", payload, stripeSignature(payload, "whsec_other", now)},
+		{"payload changed after signing", []byte(`{"id":"evt_2","object":"event","type":"checkout.session.completed","data":{"object":{}}}`), stripeSignature(payload, testWebhookSecret, now)},
+		{"signature too old", payload, stripeSignature(payload, testWebhookSecret, now.Add(-webhook.DefaultTolerance-time.Minute))},
+		{"malformed header", payload, "v1=not-hex"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := postWebhook(test.payload, test.signature)
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400; body %s", recorder.Code, recorder.Body)
+			}
+			if !bytes.Contains(recorder.Body.Bytes(), []byte("invalid_signature")) {
+				t.Errorf("body %s, want invalid_signature", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestStripeWebhookWithoutSecret(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "")
+
+	payload := []byte(`{"id":"evt_1","object":"event","type":"checkout.session.completed"}`)
+	recorder := postWebhook(payload, stripeSignature(payload, testWebhookSecret, time.Now()))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", recorder.Code)
+	}
+}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"log"
 	"strconv"
+	"strings"
 
 	"net/http"
 	"time"
@@ -15,6 +17,8 @@ import (
 
 	helper "user-athentication-golang/helpers"
 	"user-athentication-golang/models"
+	"user-athentication-golang/payout"
+	"user-athentication-golang/policy"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -48,14 +52,8 @@ func GetWithdrawals() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
 		var matchStage bson.D
-		if userType == "ADMIN" {
+		if can(c, policy.ActionList, policy.Withdrawal{}) {
 			queryUserId := c.Query("user_id")
 			if queryUserId != "" {
 				matchStage = bson.D{{"$match", bson.D{{"user_id", queryUserId}}}}
@@ -82,7 +80,11 @@ func GetWithdrawals() gin.HandlerFunc {
 			return
 		}
 
-		var allwithdrawals []bson.M
+		// Decode into the models so money fields render as plain numbers.
+		var allwithdrawals []struct {
+			Total_count      int                 `json:"total_count"`
+			Withdrawal_items []models.Withdrawal `json:"withdrawal_items"`
+		}
 		if err = result.All(ctx, &allwithdrawals); err != nil {
 			log.Fatal(err)
 		}
@@ -112,25 +114,10 @@ func GetWithdrawal() gin.HandlerFunc {
 			return
 		}
 
-		userId, exists := c.Get("uid")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
+		if !authorize(c, policy.ActionRead, policy.WithdrawalOf(withdrawal)) {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
-			return
-		}
-
-		if userType != "ADMIN" {
-			if *withdrawal.User_id != userId.(string) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to view this withdrawal"})
-				return
-			}
-		}
-
 		c.JSON(http.StatusOK, withdrawal)
 	}
 }
@@ -140,6 +127,10 @@ func CreateWithdrawal() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		if !requireVerifiedEmail(ctx, c) {
+			return
+		}
+
 		var withdrawal models.Withdrawal
 
 		if err := c.BindJSON(&withdrawal); err != nil {
@@ -153,12 +144,12 @@ func CreateWithdrawal() gin.HandlerFunc {
 			return
 		}
 
-		userType, exists := c.Get("user_type")
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user type not found in context"})
+		if !requireFreshTotp(ctx, c, withdrawal.Totp_code) {
 			return
 		}
 
+		canManage := can(c, policy.ActionManage, policy.Withdrawal{})
+
 		userId, exists := c.Get("uid")
 		if !exists {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "user id not found in context"})
@@ -166,7 +157,7 @@ func CreateWithdrawal() gin.HandlerFunc {
 		}
 
 		var userIdStr string
-		if userType != "ADMIN" {
+		if !canManage {
 			userIdStr = userId.(string)
 			withdrawal.User_id = &userIdStr
 		} else {
@@ -184,68 +175,59 @@ func CreateWithdrawal() gin.HandlerFunc {
 			withdrawal.User_id = &userIdStr
 		}
 
-		userObjectID, err := primitive.ObjectIDFromHex(userIdStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID format"})
-			return
-		}
-
-		var user models.User
-		err = userCollection.FindOne(ctx, bson.M{"_id": userObjectID}).Decode(&user)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
-			return
+		currency := models.DefaultCurrency
+		if withdrawal.Currency != nil && *withdrawal.Currency != "" {
+			currency = strings.ToUpper(*withdrawal.Currency)
 		}
+		amount := withdrawal.Amount.WithCurrency(currency)
+		withdrawal.Amount = &amount
+		withdrawal.Currency = &currency
 
-		if user.Balance == nil || *user.Balance < *withdrawal.Amount {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance for withdrawal"})
+		if withdrawal.Amount.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
 			return
 		}
 
-		if withdrawal.Status == nil {
-			status := 1
-			withdrawal.Status = &status
-		}
+		status := helper.WithdrawalRequested
+		withdrawal.Status = &status
+		withdrawal.Payout_reference = nil
+		withdrawal.Reject_reason = nil
+		withdrawal.Reviewed_by = nil
 
 		withdrawal.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		withdrawal.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		withdrawal.ID = primitive.NewObjectID()
 		withdrawal.Withdrawal_id = withdrawal.ID.Hex()
 
-		resultInsertionNumber, insertErr := withdrawalCollection.InsertOne(ctx, withdrawal)
-		if insertErr != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create withdrawal"})
+		err := helper.RequestWithdrawal(ctx, withdrawal, auditEntry(c, "withdrawal.requested", "withdrawal", withdrawal.Withdrawal_id, nil, withdrawal, nil))
+		if err == helper.ErrInsufficientBalance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance for withdrawal"})
 			return
 		}
-
-		newBalance := *user.Balance - *withdrawal.Amount
-		updateTime := time.Now()
-		_, updateErr := userCollection.UpdateOne(
-			ctx,
-			bson.M{"_id": userObjectID},
-			bson.M{"$set": bson.M{"balance": newBalance, "updated_at": updateTime}},
-		)
-		if updateErr != nil {
-			log.Printf("Error updating user balance: %v", updateErr)
-			c.JSON(http.StatusOK, gin.H{
-				"message":       "withdrawal created but balance update failed",
-				"withdrawal_id": withdrawal.Withdrawal_id,
-			})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+			return
+		}
+		var ruleErr *helper.WithdrawalRuleError
+		if errors.As(err, &ruleErr) {
+			response := gin.H{"error": ruleErr.Code, "message": ruleErr.Message}
+			for key, value := range ruleErr.Details {
+				response[key] = value
+			}
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create withdrawal"})
 			return
 		}
 
-		c.JSON(http.StatusOK, resultInsertionNumber)
+		c.JSON(http.StatusOK, gin.H{"InsertedID": withdrawal.ID})
 	}
 }
 
 func UpdateWithdrawal() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
 		withdrawalId := c.Param("withdrawal_id")
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
@@ -261,59 +243,177 @@ func UpdateWithdrawal() gin.HandlerFunc {
 			return
 		}
 
+		resource := policy.WithdrawalOf(existingWithdrawal)
+		if !authorize(c, policy.ActionUpdate, resource) {
+			return
+		}
+		role := helper.RoleOwner
+		if can(c, policy.ActionApprove, resource) {
+			role = helper.RoleAdmin
+		}
+
 		var updateData models.Withdrawal
 		if err := c.BindJSON(&updateData); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		if updateData.Amount != nil && updateData.Amount.WithCurrency(existingWithdrawal.Amount.Currency) != *existingWithdrawal.Amount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount_locked", "message": "the amount of a withdrawal cannot change once funds are held"})
+			return
+		}
+
 		update := bson.M{}
 
-		if updateData.Status != nil {
-			update["status"] = updateData.Status
+		if role == helper.RoleAdmin {
+			if updateData.Method != nil {
+				update["method"] = updateData.Method
+			}
+			if updateData.Account != nil {
+				update["account"] = updateData.Account
+			}
 		}
-		if updateData.Amount != nil {
-			update["amount"] = updateData.Amount
+
+		if *existingWithdrawal.Status == helper.WithdrawalInBatch && len(update) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "withdrawal_in_batch", "message": "a withdrawal cannot be edited while its payout batch is at the bank"})
+			return
 		}
-		if updateData.Method != nil {
-			update["method"] = updateData.Method
+
+		status := *existingWithdrawal.Status
+		if updateData.Status != nil {
+			status = *updateData.Status
 		}
-		if updateData.Account != nil {
-			update["account"] = updateData.Account
+		if err := helper.CheckWithdrawalTransition(*existingWithdrawal.Status, status, role); err != nil {
+			transitionErr := err.(*helper.TransitionError)
+			c.JSON(http.StatusConflict, gin.H{"error": transitionErr.Code, "message": transitionErr.Message})
+			return
 		}
 
-		update["updated_at"] = time.Now().Format(time.RFC3339)
+		if status == *existingWithdrawal.Status {
+			if len(update) == 0 {
+				c.JSON(http.StatusOK, 0)
+				return
+			}
+			update["updated_at"] = time.Now()
+
+			result, err := auditedUpdate(
+				ctx,
+				withdrawalCollection,
+				bson.M{"withdrawal_id": withdrawalId, "status": existingWithdrawal.Status},
+				bson.M{"$set": update},
+				auditEntry(c, "withdrawal.updated", "withdrawal", withdrawalId, existingWithdrawal, update, nil),
+			)
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": helper.ErrWithdrawalConflict.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update withdrawal"})
+				return
+			}
+
+			c.JSON(http.StatusOK, result.ModifiedCount)
+			return
+		}
 
-		result, err := withdrawalCollection.UpdateOne(
-			ctx,
-			bson.M{"withdrawal_id": withdrawalId},
-			bson.M{"$set": update},
-		)
+		if status == helper.WithdrawalPaid {
+			if updateData.Payout_reference == nil || *updateData.Payout_reference == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "payout_reference_required", "message": helper.ErrPayoutReferenceRequired.Error()})
+				return
+			}
+			update["payout_reference"] = updateData.Payout_reference
+		}
+		if status == helper.WithdrawalRejected && updateData.Reject_reason != nil {
+			update["reject_reason"] = updateData.Reject_reason
+		}
+
+		update["status"] = status
+		err = helper.TransitionWithdrawal(ctx, existingWithdrawal, status, update, auditEntry(c, "withdrawal.updated", "withdrawal", withdrawalId, existingWithdrawal, update, nil))
+		if err == helper.ErrWithdrawalConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update withdrawal"})
 			return
 		}
 
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "withdrawal not found"})
+		if status == helper.WithdrawalApproved {
+			existingWithdrawal.Status = &status
+			if _, err := dispatchPayout(ctx, c, existingWithdrawal); err != nil {
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, 1)
+	}
+}
+
+// PayoutWithdrawal retries the payout of an approved withdrawal, e.g. one the
+// provider did not confirm or one approved before the provider configuration
+// changed. A withdrawal the provider already took is refused.
+func PayoutWithdrawal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		withdrawalId := c.Param("withdrawal_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var withdrawal models.Withdrawal
+		err := withdrawalCollection.FindOne(ctx, bson.M{"withdrawal_id": withdrawalId}).Decode(&withdrawal)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "withdrawal not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching withdrawal"})
+			return
+		}
+
+		if !authorize(c, policy.ActionPayout, policy.WithdrawalOf(withdrawal)) {
+			return
+		}
+
+		withdrawal, err = dispatchPayout(ctx, c, withdrawal)
+		if err != nil {
 			return
 		}
 
-		c.JSON(http.StatusOK, result.ModifiedCount)
+		c.JSON(http.StatusOK, withdrawal)
 	}
 }
 
+// dispatchPayout writes the error response itself when the payout fails.
+func dispatchPayout(ctx context.Context, c *gin.Context, withdrawal models.Withdrawal) (models.Withdrawal, error) {
+	withdrawal, err := helper.DispatchPayout(ctx, payout.Provider(), withdrawal, auditSource(c))
+	switch {
+	case err == nil:
+	case err == helper.ErrWithdrawalNotApproved:
+		c.JSON(http.StatusConflict, gin.H{"error": "withdrawal_not_approved", "message": err.Error()})
+	case err == helper.ErrWithdrawalConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": "status_conflict", "message": err.Error()})
+	case err == helper.ErrPayoutDispatched:
+		c.JSON(http.StatusConflict, gin.H{"error": "payout_already_dispatched", "message": err.Error()})
+	case errors.Is(err, helper.ErrPayoutUnconfirmed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "payout_unconfirmed", "message": err.Error()})
+	case errors.Is(err, helper.ErrPayoutFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "payout_failed", "message": err.Error()})
+	default:
+		log.Printf("payout of withdrawal %s: %v", withdrawal.Withdrawal_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to pay out withdrawal"})
+	}
+	return withdrawal, err
+}
+
 func DeleteWithdrawal() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !authorize(c, policy.ActionDelete, policy.Withdrawal{}) {
 			return
 		}
 
 		withdrawalId := c.Param("withdrawal_id")
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := withdrawalCollection.DeleteOne(ctx, bson.M{"withdrawal_id": withdrawalId})
+		result, err := auditedDelete(ctx, c, withdrawalCollection, bson.M{"withdrawal_id": withdrawalId}, "withdrawal.deleted", "withdrawal", withdrawalId)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete withdrawal"})
@@ -323,3 +423,65 @@ func DeleteWithdrawal() gin.HandlerFunc {
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+func GetWithdrawalRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		rules, err := helper.CurrentWithdrawalRules(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching withdrawal rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+func UpdateWithdrawalRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rules models.WithdrawalRules
+		if err := c.BindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := withdrawalValidate.Struct(rules); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		seen := map[string]bool{}
+		for _, limit := range rules.Limits {
+			currency := strings.ToUpper(*limit.Currency)
+			if seen[currency] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "duplicate_currency", "message": "each currency may only have one set of limits"})
+				return
+			}
+			seen[currency] = true
+
+			if limit.Min_amount != nil && limit.Max_amount != nil && limit.Min_amount.Amount > limit.Max_amount.Amount {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limits", "message": "the minimum withdrawal cannot be above the maximum"})
+				return
+			}
+			for _, amount := range []*models.Money{limit.Min_amount, limit.Max_amount, limit.Daily_limit, limit.Monthly_limit} {
+				if amount != nil && amount.Amount < 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limits", "message": "limits cannot be negative"})
+					return
+				}
+			}
+		}
+
+		rules, err := helper.SaveWithdrawalRules(ctx, rules, auditSource(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update withdrawal rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rules)
+	}
+}
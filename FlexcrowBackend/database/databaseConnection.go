@@ -13,13 +13,18 @@ import (
 )
 
 func DBinstance() *mongo.Client {
+	// Without a .env file the settings come from the environment, as they do
+	// in tests and containers.
 	err := godotenv.Load(".env")
 
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Println("No .env file, using the environment")
 	}
 
 	MongoDb := os.Getenv("MONGODB_URL")
+	if MongoDb == "" {
+		MongoDb = "mongodb://localhost:27017"
+	}
 
 	client, err := mongo.NewClient(options.Client().ApplyURI(MongoDb))
 	if err != nil {
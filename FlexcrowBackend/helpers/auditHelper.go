@@ -0,0 +1,329 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "audit")
+var auditHeadCollection *mongo.Collection = database.OpenCollection(database.Client, "audit_head")
+
+const AuditActorScheduler = "system:scheduler"
+const AuditActorStripe = "system:stripe"
+
+// auditHeadId is the single audit_head document, which holds the sequence
+// and hash of the newest record.
+const auditHeadId = "audit"
+
+// auditRedacted fields are recorded as changed without their values.
+var auditRedacted = map[string]bool{
+	"password":            true,
+	"token":               true,
+	"refresh_token":       true,
+	"totp_secret":         true,
+	"totp_pending_secret": true,
+	"totp_recovery_codes": true,
+}
+
+// AuditSource is who asked for a write and the request it came in on.
+// Helpers that audit their own writes take one from the controller.
+type AuditSource struct {
+	Actor      string
+	Ip_address string
+	Request_id string
+}
+
+// AuditScheduler is the source of writes made by background jobs.
+var AuditScheduler = AuditSource{Actor: AuditActorScheduler}
+
+// AuditStripe is the source of writes made for Stripe webhook events.
+var AuditStripe = AuditSource{Actor: AuditActorStripe}
+
+// AuditEntry is what the caller knows about a write. AppendAudit adds the
+// sequence, time and hashes.
+type AuditEntry struct {
+	AuditSource
+	Action        string
+	Resource_type string
+	Resource_id   string
+	Changes       map[string]models.AuditChange
+	Details       map[string]interface{}
+}
+
+type auditHead struct {
+	Sequence int64  `bson:"sequence"`
+	Hash     string `bson:"hash"`
+}
+
+func WriteAudit(ctx context.Context, action string, source AuditSource, resourceType string, resourceId string, details map[string]interface{}) error {
+	return AppendAudit(ctx, source.Entry(action, resourceType, resourceId, nil, details))
+}
+
+// Entry describes one write made on behalf of source.
+func (source AuditSource) Entry(action string, resourceType string, resourceId string, changes map[string]models.AuditChange, details map[string]interface{}) AuditEntry {
+	return AuditEntry{
+		AuditSource:   source,
+		Action:        action,
+		Resource_type: resourceType,
+		Resource_id:   resourceId,
+		Changes:       changes,
+		Details:       details,
+	}
+}
+
+// AppendAudit adds entry to the end of the audit chain. Inside a transaction
+// it joins it, so the record commits or rolls back with the write it
+// describes; otherwise it runs in its own. Either way two writers can never
+// claim the same sequence number.
+func AppendAudit(ctx context.Context, entry AuditEntry) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return appendAudit(ctx, entry)
+	}
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		return appendAudit(sessCtx, entry)
+	})
+}
+
+func appendAudit(ctx context.Context, entry AuditEntry) error {
+	var head auditHead
+	err := auditHeadCollection.FindOne(ctx, bson.M{"_id": auditHeadId}).Decode(&head)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	record := models.AuditRecord{
+		ID:            primitive.NewObjectID(),
+		Sequence:      head.Sequence + 1,
+		Action:        entry.Action,
+		Actor:         entry.Actor,
+		Resource_type: entry.Resource_type,
+		Resource_id:   entry.Resource_id,
+		Changes:       entry.Changes,
+		Details:       entry.Details,
+		Ip_address:    entry.Ip_address,
+		Request_id:    entry.Request_id,
+		Created_at:    time.Now(),
+		Prev_hash:     head.Hash,
+	}
+	record.Audit_id = record.ID.Hex()
+
+	// The hash is taken over the encoded record and that exact encoding is
+	// what gets stored, so map ordering cannot change it on the way back.
+	raw, err := bson.Marshal(record)
+	if err != nil {
+		return err
+	}
+	hash, err := AuditHash(raw)
+	if err != nil {
+		return err
+	}
+	document, err := withAuditHash(raw, hash)
+	if err != nil {
+		return err
+	}
+
+	if _, err := auditCollection.InsertOne(ctx, document); err != nil {
+		return err
+	}
+
+	_, err = auditHeadCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": auditHeadId, "sequence": head.Sequence},
+		bson.M{"$set": bson.M{"sequence": record.Sequence, "hash": hash}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// auditContent is a stored audit record without its hash field, which is
+// exactly what the hash covers.
+func auditContent(raw bson.Raw) ([][]byte, error) {
+	elements, err := raw.Elements()
+	if err != nil {
+		return nil, err
+	}
+	content := make([][]byte, 0, len(elements))
+	for _, element := range elements {
+		if element.Key() == "hash" {
+			continue
+		}
+		content = append(content, element)
+	}
+	return content, nil
+}
+
+// AuditHash is the hex SHA-256 of an encoded audit record, leaving out its
+// hash field. The record's prev_hash is part of what is hashed.
+func AuditHash(raw bson.Raw) (string, error) {
+	content, err := auditContent(raw)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bsoncore.BuildDocument(nil, content...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func withAuditHash(raw bson.Raw, hash string) (bson.Raw, error) {
+	content, err := auditContent(raw)
+	if err != nil {
+		return nil, err
+	}
+	content = append(content, bsoncore.AppendStringElement(nil, "hash", hash))
+	return bson.Raw(bsoncore.BuildDocument(nil, content...)), nil
+}
+
+// AuditDiff lists the fields that differ between before and after, as they
+// are stored. Either may be nil, for creates and deletes. after may hold
+// only the fields being set, like a $set document; fields it leaves out are
+// not compared.
+func AuditDiff(before interface{}, after interface{}) map[string]models.AuditChange {
+	from, to := auditFields(before), auditFields(after)
+	changes := map[string]models.AuditChange{}
+
+	if to == nil {
+		for key, value := range from {
+			changes[key] = models.AuditChange{From: value}
+		}
+	}
+	for key, value := range to {
+		if reflect.DeepEqual(from[key], value) {
+			continue
+		}
+		changes[key] = models.AuditChange{From: from[key], To: value}
+	}
+
+	delete(changes, "_id")
+	for key, change := range changes {
+		if auditRedacted[key] {
+			changes[key] = models.AuditChange{From: redacted(change.From), To: redacted(change.To)}
+		}
+	}
+	return changes
+}
+
+func auditFields(value interface{}) bson.M {
+	if value == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func redacted(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return "[redacted]"
+}
+
+// AuditVerification is the outcome of checking the audit chain. Broken_at
+// is the sequence of the first record that fails, or 0 when the chain holds.
+type AuditVerification struct {
+	Checked       int64  `json:"checked"`
+	Unchained     int64  `json:"unchained"`
+	Head_sequence int64  `json:"head_sequence"`
+	Broken_at     int64  `json:"broken_at"`
+	Reason        string `json:"reason"`
+}
+
+// VerifyAuditLink checks one encoded record against the sequence and hash
+// the previous record leaves off at. It returns the record's hash, or why
+// the link is broken.
+func VerifyAuditLink(raw bson.Raw, sequence int64, prevHash string) (string, error) {
+	var link struct {
+		Sequence  int64  `bson:"sequence"`
+		Prev_hash string `bson:"prev_hash"`
+		Hash      string `bson:"hash"`
+	}
+	if err := bson.Unmarshal(raw, &link); err != nil {
+		return "", fmt.Errorf("record cannot be decoded: %v", err)
+	}
+	if link.Sequence != sequence {
+		return "", fmt.Errorf("expected sequence %d, found %d", sequence, link.Sequence)
+	}
+	if link.Prev_hash != prevHash {
+		return "", fmt.Errorf("prev_hash does not match the hash of record %d", sequence-1)
+	}
+	hash, err := AuditHash(raw)
+	if err != nil {
+		return "", fmt.Errorf("record cannot be hashed: %v", err)
+	}
+	if hash != link.Hash {
+		return "", fmt.Errorf("hash does not match the record's contents")
+	}
+	return hash, nil
+}
+
+// VerifyAuditChain walks the audit chain from the first record and checks
+// that the head points at its last one. Records written before the chain
+// existed have no sequence and are only counted.
+func VerifyAuditChain(ctx context.Context) (AuditVerification, error) {
+	var result AuditVerification
+
+	unchained, err := auditCollection.CountDocuments(ctx, bson.M{"sequence": bson.M{"$exists": false}})
+	if err != nil {
+		return result, err
+	}
+	result.Unchained = unchained
+
+	var head auditHead
+	err = auditHeadCollection.FindOne(ctx, bson.M{"_id": auditHeadId}).Decode(&head)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return result, err
+	}
+	result.Head_sequence = head.Sequence
+
+	cursor, err := auditCollection.Find(ctx,
+		bson.M{"sequence": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{"sequence", 1}}),
+	)
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(ctx)
+
+	prevHash := ""
+	for cursor.Next(ctx) {
+		sequence := result.Checked + 1
+		hash, err := VerifyAuditLink(cursor.Current, sequence, prevHash)
+		if err != nil {
+			result.Broken_at = sequence
+			result.Reason = err.Error()
+			return result, nil
+		}
+		prevHash = hash
+		result.Checked++
+	}
+	if err := cursor.Err(); err != nil {
+		return result, err
+	}
+
+	if head.Sequence != result.Checked || head.Hash != prevHash {
+		result.Broken_at = result.Checked + 1
+		result.Reason = fmt.Sprintf("head is at sequence %d but the chain ends at %d", head.Sequence, result.Checked)
+	}
+	return result, nil
+}
@@ -0,0 +1,306 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+	"user-athentication-golang/refund"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var disputeCollection *mongo.Collection = database.OpenCollection(database.Client, "dispute")
+
+const (
+	DisputeOpen     = 1
+	DisputeResolved = 2
+)
+
+const (
+	ResolutionRefund  = "refund"
+	ResolutionRelease = "release"
+	ResolutionSplit   = "split"
+)
+
+var ErrDisputeExists = errors.New("transaction already has an open dispute")
+var ErrDisputeNotOpen = errors.New("dispute is already resolved")
+var ErrTransactionNotPaid = errors.New("transaction has no funds held in escrow")
+var ErrInvalidSplit = errors.New("split amount must be between zero and the amount held less the fee")
+
+// EscrowHeld is what the escrow account still holds for a transaction:
+// captured payments less anything already released or refunded.
+func EscrowHeld(ctx context.Context, transaction models.Transaction) (models.Money, error) {
+	held := models.NewMoney(0, MoneyOrZero(transaction.Amount_buyer).Currency)
+
+	cursor, err := ledgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"account": AccountEscrow, "transaction_id": transaction.Transaction_id}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$amount.currency",
+			"total": bson.M{"$sum": "$amount.amount"},
+		}}},
+	})
+	if err != nil {
+		return held, err
+	}
+
+	var rows []struct {
+		Currency string `bson:"_id"`
+		Total    int64  `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return held, err
+	}
+
+	for _, row := range rows {
+		if row.Total != 0 {
+			held = models.NewMoney(row.Total, row.Currency)
+		}
+	}
+	return held, nil
+}
+
+// TransactionPaid reports whether escrow holds any money for a transaction.
+func TransactionPaid(ctx context.Context, transaction models.Transaction) (bool, error) {
+	held, err := EscrowHeld(ctx, transaction)
+	if err != nil {
+		return false, err
+	}
+	return held.Amount > 0, nil
+}
+
+func HasOpenDispute(ctx context.Context, transactionId string) (bool, error) {
+	count, err := disputeCollection.CountDocuments(ctx, bson.M{"transaction_id": transactionId, "status": DisputeOpen})
+	return count > 0, err
+}
+
+// OpenDispute stores the dispute and moves the transaction to disputed in one
+// step, so a transaction is never disputed without a reason on record. entry
+// is audited in the same step.
+func OpenDispute(ctx context.Context, dispute models.Dispute, transaction models.Transaction, entry AuditEntry) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		open, err := HasOpenDispute(sessCtx, transaction.Transaction_id)
+		if err != nil {
+			return err
+		}
+		if open {
+			return ErrDisputeExists
+		}
+
+		if _, err := disputeCollection.InsertOne(sessCtx, dispute); err != nil {
+			return err
+		}
+
+		result, err := transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": transaction.Status},
+			bson.M{"$set": bson.M{"status": TransactionDisputed, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrStatusConflict
+		}
+		return AppendAudit(sessCtx, entry)
+	})
+}
+
+// DisputeShares splits what escrow holds between buyer, seller and platform.
+// A refund returns everything including the fee; release and split keep the
+// fee and pay the seller whatever the buyer does not get back.
+func DisputeShares(resolutionType string, held models.Money, fee models.Money, buyerAmount models.Money) (buyer models.Money, seller models.Money, platform models.Money, err error) {
+	zero := models.NewMoney(0, held.Currency)
+
+	switch resolutionType {
+	case ResolutionRefund:
+		return held, zero, zero, nil
+	case ResolutionRelease:
+		buyerAmount = zero
+	case ResolutionSplit:
+		buyerAmount = models.NewMoney(buyerAmount.Amount, held.Currency)
+	default:
+		return zero, zero, zero, errors.New("unknown resolution type")
+	}
+
+	if held.IsZero() {
+		return zero, zero, zero, ErrTransactionNotPaid
+	}
+
+	platform = models.NewMoney(fee.Amount, held.Currency)
+	if platform.Amount > held.Amount {
+		platform = held
+	}
+
+	remaining := held.Sub(platform)
+	if buyerAmount.Amount < 0 || buyerAmount.Amount > remaining.Amount {
+		return zero, zero, zero, ErrInvalidSplit
+	}
+
+	return buyerAmount, remaining.Sub(buyerAmount), platform, nil
+}
+
+// ResolveDispute settles the escrow as resolution says and audits entry in
+// the same transaction. Any buyer refund is paid out once that has committed;
+// if the provider declines it, the dispute is reopened and the release undone
+// so it can be resolved again.
+func ResolveDispute(ctx context.Context, refunder refund.Refunder, dispute models.Dispute, transaction models.Transaction, resolution models.DisputeResolution, entry AuditEntry) error {
+	finalStatus := TransactionCompleted
+	if *resolution.Type == ResolutionRefund {
+		finalStatus = TransactionCanceled
+	}
+
+	var pending *PendingRefund
+	var releases []models.LedgerEntry
+
+	err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		held, err := EscrowHeld(sessCtx, transaction)
+		if err != nil {
+			return err
+		}
+
+		buyer, seller, platform, err := DisputeShares(*resolution.Type, held, MoneyOrZero(transaction.Fee), MoneyOrZero(resolution.Buyer_amount))
+		if err != nil {
+			return err
+		}
+
+		result, err := disputeCollection.UpdateOne(
+			sessCtx,
+			bson.M{"dispute_id": dispute.Dispute_id, "status": DisputeOpen},
+			bson.M{"$set": bson.M{
+				"status":     DisputeResolved,
+				"resolution": resolution,
+				"updated_at": time.Now(),
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrDisputeNotOpen
+		}
+
+		result, err = transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": TransactionDisputed},
+			bson.M{"$set": bson.M{"status": finalStatus, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrStatusConflict
+		}
+
+		ref := LedgerRef{
+			Transaction_id: &transaction.Transaction_id,
+			Payment_id:     transaction.Payment_id,
+			Created_by:     &resolution.Resolved_by,
+			Note:           resolution.Note,
+		}
+
+		if released := seller.Add(platform); !released.IsZero() {
+			entries := []models.LedgerEntry{LedgerEntry(AccountEscrow, LedgerRelease, released.Neg(), ref)}
+			if !seller.IsZero() {
+				entries = append(entries, LedgerEntry(*transaction.User_id, LedgerRelease, seller, ref))
+			}
+			if !platform.IsZero() {
+				entries = append(entries, LedgerEntry(AccountFeeRevenue, LedgerFeeRevenue, platform, ref))
+			}
+			if err := PostLedger(sessCtx, entries...); err != nil {
+				return err
+			}
+			releases = entries
+		}
+
+		if !buyer.IsZero() {
+			destination := ""
+			if resolution.Refund_to != nil {
+				destination = *resolution.Refund_to
+			}
+			_, pending, err = ReserveRefund(sessCtx, transaction, RefundRequest{
+				Amount:      buyer,
+				Destination: destination,
+				Source:      entry.AuditSource,
+				Reason:      "dispute " + dispute.Dispute_id,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return AppendAudit(sessCtx, entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = SettleRefund(ctx, refunder, pending)
+	if errors.Is(err, ErrRefundFailed) {
+		if reopenErr := reopenDispute(ctx, dispute, transaction, finalStatus, releases, entry.AuditSource); reopenErr != nil {
+			return fmt.Errorf("%w; reopening dispute %s also failed: %v", err, dispute.Dispute_id, reopenErr)
+		}
+	}
+	return err
+}
+
+// reopenDispute undoes a resolution whose refund was declined: the dispute is
+// open again, the transaction disputed, and whatever the resolution released
+// to the seller and platform goes back into escrow.
+func reopenDispute(ctx context.Context, dispute models.Dispute, transaction models.Transaction, resolved int, released []models.LedgerEntry, source AuditSource) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		result, err := disputeCollection.UpdateOne(
+			sessCtx,
+			bson.M{"dispute_id": dispute.Dispute_id, "status": DisputeResolved},
+			bson.M{
+				"$set":   bson.M{"status": DisputeOpen, "updated_at": time.Now()},
+				"$unset": bson.M{"resolution": ""},
+			},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			return err
+		}
+
+		result, err = transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": resolved},
+			bson.M{"$set": bson.M{"status": TransactionDisputed, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrStatusConflict
+		}
+
+		if len(released) > 0 {
+			note := "dispute resolution reversed: refund declined"
+			reversal := make([]models.LedgerEntry, 0, len(released))
+			for _, entry := range released {
+				ref := LedgerRef{
+					Transaction_id: entry.Transaction_id,
+					Payment_id:     entry.Payment_id,
+					Created_by:     entry.Created_by,
+					Note:           &note,
+				}
+				reversal = append(reversal, LedgerEntry(entry.Account, entry.Type, entry.Amount.Neg(), ref))
+			}
+			if err := PostLedger(sessCtx, reversal...); err != nil {
+				return err
+			}
+		}
+
+		changes := AuditDiff(
+			bson.M{"status": DisputeResolved, "transaction_status": resolved},
+			bson.M{"status": DisputeOpen, "transaction_status": TransactionDisputed},
+		)
+		return AppendAudit(sessCtx, source.Entry("dispute.reopened", "dispute", dispute.Dispute_id, changes, map[string]interface{}{
+			"transaction_id": transaction.Transaction_id,
+			"reason":         "refund declined",
+		}))
+	})
+}
@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"user-athentication-golang/models"
+	"user-athentication-golang/refund"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// seedOpenDispute disputes a paid transaction the way OpenDispute does.
+func seedOpenDispute(t *testing.T, ctx context.Context, transaction models.Transaction) models.Dispute {
+	t.Helper()
+
+	_, err := transactionCollection.UpdateOne(ctx, bson.M{"transaction_id": transaction.Transaction_id}, bson.M{"$set": bson.M{"status": TransactionDisputed}})
+	if err != nil {
+		t.Fatalf("disputing transaction: %v", err)
+	}
+
+	status, reason := DisputeOpen, "item never arrived"
+	dispute := models.Dispute{
+		ID:             primitive.NewObjectID(),
+		Transaction_id: &transaction.Transaction_id,
+		Seller_id:      transaction.User_id,
+		Buyer_id:       transaction.Customer_id,
+		Opened_by:      transaction.Customer_id,
+		Status:         &status,
+		Reason:         &reason,
+		Created_at:     time.Now(),
+		Updated_at:     time.Now(),
+	}
+	dispute.Dispute_id = dispute.ID.Hex()
+	if _, err := disputeCollection.InsertOne(ctx, dispute); err != nil {
+		t.Fatalf("seeding dispute: %v", err)
+	}
+	return dispute
+}
+
+func splitResolution(buyerAmount models.Money) models.DisputeResolution {
+	resolutionType := ResolutionSplit
+	return models.DisputeResolution{
+		Type:         &resolutionType,
+		Buyer_amount: &buyerAmount,
+		Resolved_by:  testSource.Actor,
+		Resolved_at:  time.Now(),
+	}
+}
+
+func TestResolveDisputeReopensOnDeclinedRefund(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, _ := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	dispute := seedOpenDispute(t, ctx, transaction)
+	resolution := splitResolution(models.NewMoney(4000, "THB"))
+	entry := testSource.Entry("dispute.resolved", "dispute", dispute.Dispute_id, nil, nil)
+
+	refunder := refund.NewFake()
+	refunder.Err = errors.New("card_declined")
+	err := ResolveDispute(ctx, refunder, dispute, transaction, resolution, entry)
+	if !errors.Is(err, ErrRefundFailed) {
+		t.Fatalf("ResolveDispute returned %v, want ErrRefundFailed", err)
+	}
+
+	var stored models.Dispute
+	if err := disputeCollection.FindOne(ctx, bson.M{"dispute_id": dispute.Dispute_id}).Decode(&stored); err != nil {
+		t.Fatalf("reading dispute: %v", err)
+	}
+	if *stored.Status != DisputeOpen || stored.Resolution != nil {
+		t.Errorf("dispute is status %d with resolution %+v, want it open again", *stored.Status, stored.Resolution)
+	}
+	if status := transactionStatus(t, ctx, transaction.Transaction_id); status != TransactionDisputed {
+		t.Errorf("transaction is status %d, want disputed", status)
+	}
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 10000 {
+		t.Errorf("escrow holds %d, want all 10000 back", held.Amount)
+	}
+	if balance := walletAmount(t, ctx, *transaction.User_id, "THB"); balance != 0 {
+		t.Errorf("seller holds %d, want the release undone", balance)
+	}
+	auditRecord(t, ctx, "dispute.reopened", dispute.Dispute_id)
+
+	refunder.Err = nil
+	if err := ResolveDispute(ctx, refunder, dispute, transaction, resolution, entry); err != nil {
+		t.Fatalf("resolving again: %v", err)
+	}
+	if balance := walletAmount(t, ctx, *transaction.User_id, "THB"); balance != 6000 {
+		t.Errorf("seller holds %d, want 6000", balance)
+	}
+	if held := escrowHeld(t, ctx, transaction); !held.IsZero() {
+		t.Errorf("escrow holds %d, want nothing", held.Amount)
+	}
+}
@@ -0,0 +1,79 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"user-athentication-golang/mailer"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const PurposeVerifyEmail = "verify_email"
+
+const verifyEmailLifetime = 48 * time.Hour
+
+var ErrEmailNotVerified = errors.New("verify your email address before continuing")
+
+// AppURL is where links in emails point: APP_URL, or the local frontend.
+func AppURL() string {
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		return appURL
+	}
+	return "http://localhost:5173"
+}
+
+func SendVerificationEmail(ctx context.Context, user models.User) error {
+	raw, err := IssueUserToken(ctx, user.User_id, PurposeVerifyEmail, *user.Email, verifyEmailLifetime)
+	if err != nil {
+		return err
+	}
+
+	link := AppURL() + "/auth/verify-email?token=" + url.QueryEscape(raw)
+	return mailer.Provider().Send(ctx, mailer.Message{
+		To:      *user.Email,
+		Subject: "Verify your Flexcrow email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link within %d hours:\n\n%s\n\nIf you did not sign up, ignore this email.\n",
+			*user.First_name, int(verifyEmailLifetime.Hours()), link),
+	})
+}
+
+// VerifyEmail consumes a verification token. A token sent to an address the
+// user has since changed away from does not verify the new one.
+func VerifyEmail(ctx context.Context, raw string) error {
+	token, err := ConsumeUserToken(ctx, PurposeVerifyEmail, raw)
+	if err != nil {
+		return err
+	}
+
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": token.User_id, "email": token.Email},
+		bson.M{"$set": bson.M{"email_verified_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidUserToken
+	}
+	return nil
+}
+
+// RequireVerifiedEmail returns ErrEmailNotVerified unless the user has
+// confirmed their current email address.
+func RequireVerifiedEmail(ctx context.Context, userId string) error {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return err
+	}
+	if user.Email_verified_at == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
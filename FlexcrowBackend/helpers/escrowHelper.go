@@ -0,0 +1,220 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"user-athentication-golang/checkout"
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var transactionCollection *mongo.Collection = database.OpenCollection(database.Client, "transaction")
+var productCollection *mongo.Collection = database.OpenCollection(database.Client, "product")
+
+var ErrStatusConflict = errors.New("transaction status changed while updating")
+
+const CancelReasonExpired = "expired"
+
+func MoneyOrZero(value *models.Money) models.Money {
+	if value == nil {
+		return models.NewMoney(0, models.DefaultCurrency)
+	}
+	return *value
+}
+
+func TransactionAmounts(price models.Money, number int, shipping models.Money, fee models.Money, feeType int) (buyer models.Money, seller models.Money) {
+	amount := price.Mul(int64(number)).Add(shipping)
+
+	// Split fees round the buyer's half up so buyer minus seller is always the fee.
+	sellerShare := fee.Amount / 2
+	buyerShare := fee.Amount - sellerShare
+
+	switch feeType {
+	case 2:
+		return amount, amount.Sub(fee)
+	case 3:
+		return amount.Add(models.NewMoney(buyerShare, fee.Currency)), amount.Sub(models.NewMoney(sellerShare, fee.Currency))
+	default:
+		return amount.Add(fee), amount
+	}
+}
+
+func SellerAmount(ctx context.Context, transaction models.Transaction) (models.Money, error) {
+	if transaction.Amount_seller != nil {
+		return *transaction.Amount_seller, nil
+	}
+
+	var product models.Product
+	err := productCollection.FindOne(ctx, bson.M{"product_id": transaction.Product_id}).Decode(&product)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	number, feeType := 1, 1
+	if transaction.Product_number != nil {
+		number = *transaction.Product_number
+	}
+	if transaction.Fee_type != nil {
+		feeType = *transaction.Fee_type
+	}
+
+	_, seller := TransactionAmounts(MoneyOrZero(product.Price), number, MoneyOrZero(transaction.Shipping_price), MoneyOrZero(transaction.Fee), feeType)
+	return seller, nil
+}
+
+// CompleteTransaction releases escrow to the seller and appends entry in the
+// same MongoDB transaction.
+func CompleteTransaction(ctx context.Context, transaction models.Transaction, update bson.M, entry AuditEntry) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if _, err := completeTransaction(sessCtx, transaction, update); err != nil {
+			return err
+		}
+		return AppendAudit(sessCtx, entry)
+	})
+}
+
+// AutoReleaseTransaction completes a transaction on the buyer's behalf and
+// records who released it and why in the same MongoDB transaction.
+func AutoReleaseTransaction(ctx context.Context, transaction models.Transaction, details map[string]interface{}) error {
+	now := time.Now()
+
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		amount, err := completeTransaction(sessCtx, transaction, bson.M{
+			"auto_released_at": now,
+			"updated_at":       now,
+		})
+		if err != nil {
+			return err
+		}
+
+		details["seller_id"] = transaction.User_id
+		details["seller_amount"] = amount
+		details["fee"] = MoneyOrZero(transaction.Fee)
+		return WriteAudit(sessCtx, "transaction.auto_release", AuditScheduler, "transaction", transaction.Transaction_id, details)
+	})
+}
+
+func completeTransaction(sessCtx mongo.SessionContext, transaction models.Transaction, update bson.M) (models.Money, error) {
+	update["status"] = TransactionCompleted
+
+	result, err := transactionCollection.UpdateOne(
+		sessCtx,
+		bson.M{"transaction_id": transaction.Transaction_id, "status": transaction.Status},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.Money{}, ErrStatusConflict
+	}
+
+	amount, err := SellerAmount(sessCtx, transaction)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	fee := MoneyOrZero(transaction.Fee)
+
+	// Only money the buyer actually paid in can be released.
+	release := amount.Add(fee)
+	held, err := EscrowHeld(sessCtx, transaction)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if held.Currency != release.Currency || held.Amount < release.Amount {
+		return models.Money{}, ErrTransactionNotPaid
+	}
+
+	ref := LedgerRef{Transaction_id: &transaction.Transaction_id, Payment_id: transaction.Payment_id}
+	err = PostLedger(sessCtx,
+		LedgerEntry(AccountEscrow, LedgerRelease, amount.Add(fee).Neg(), ref),
+		LedgerEntry(*transaction.User_id, LedgerRelease, amount, ref),
+		LedgerEntry(AccountFeeRevenue, LedgerFeeRevenue, fee, ref),
+	)
+	return amount, err
+}
+
+// ExpireTransaction cancels a pending transaction that was never paid and
+// cancels the checkout payments still waiting on it, after expirer closes
+// their checkout sessions. It returns ErrStatusConflict when the buyer has
+// already completed one.
+func ExpireTransaction(ctx context.Context, expirer checkout.Expirer, transaction models.Transaction, details map[string]interface{}) error {
+	now := time.Now()
+
+	// Close the checkout pages first so the buyer cannot pay after the
+	// transaction is canceled.
+	cursor, err := paymentCollection.Find(ctx, bson.M{
+		"transaction_id":   transaction.Transaction_id,
+		"status":           PaymentPending,
+		"checkout_session": bson.M{"$nin": bson.A{nil, ""}},
+	})
+	if err != nil {
+		return err
+	}
+	var pending []models.Payment
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+	for _, payment := range pending {
+		err := expirer.Expire(ctx, *payment.Checkout_session)
+		if err == checkout.ErrCompleted {
+			// The payment is on its way; the transaction is no longer unpaid.
+			return ErrStatusConflict
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		linked := bson.A{bson.M{"transaction_id": transaction.Transaction_id}}
+		if transaction.Payment_id != nil && *transaction.Payment_id != "" {
+			linked = append(linked, bson.M{"payment_id": *transaction.Payment_id})
+		}
+
+		paid, err := paymentCollection.CountDocuments(sessCtx, bson.M{
+			"$or":    linked,
+			"status": bson.M{"$in": bson.A{PaymentPaid, PaymentRefunded}},
+		})
+		if err != nil {
+			return err
+		}
+		if paid > 0 {
+			return nil
+		}
+
+		result, err := transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": TransactionPending},
+			bson.M{"$set": bson.M{
+				"status":        TransactionCanceled,
+				"cancel_reason": CancelReasonExpired,
+				"updated_at":    now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrStatusConflict
+		}
+
+		payments, err := paymentCollection.UpdateMany(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": PaymentPending},
+			bson.M{"$set": bson.M{"status": PaymentCanceled, "updated_at": now}},
+		)
+		if err != nil {
+			return err
+		}
+
+		details["payments_canceled"] = payments.ModifiedCount
+		return WriteAudit(sessCtx, "transaction.expire", AuditScheduler, "transaction", transaction.Transaction_id, details)
+	})
+}
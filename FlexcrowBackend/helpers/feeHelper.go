@@ -0,0 +1,167 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var feeScheduleCollection *mongo.Collection = database.OpenCollection(database.Client, "fee_schedule")
+
+const DefaultFeeScheduleId = "default"
+
+var ErrProductNotFound = errors.New("product not found")
+
+func DefaultFeeSchedule() models.FeeSchedule {
+	name := "Default"
+	effectiveFrom := time.Time{}
+	above0 := models.MoneyFromFloat(0, models.DefaultCurrency)
+	above100 := models.MoneyFromFloat(100, models.DefaultCurrency)
+	above200 := models.MoneyFromFloat(200, models.DefaultCurrency)
+	rate2, rate5, rate8 := 0.02, 0.05, 0.08
+
+	return models.FeeSchedule{
+		Fee_schedule_id: DefaultFeeScheduleId,
+		Name:            &name,
+		Tiers: []models.FeeTier{
+			{Above: &above0, Rate: &rate2},
+			{Above: &above100, Rate: &rate5},
+			{Above: &above200, Rate: &rate8},
+		},
+		Effective_from: &effectiveFrom,
+	}
+}
+
+func CurrentFeeSchedule(ctx context.Context, at time.Time) (models.FeeSchedule, error) {
+	var schedule models.FeeSchedule
+	opts := options.FindOne().SetSort(bson.M{"effective_from": -1})
+	err := feeScheduleCollection.FindOne(ctx, bson.M{"effective_from": bson.M{"$lte": at}}, opts).Decode(&schedule)
+	if err == mongo.ErrNoDocuments {
+		return DefaultFeeSchedule(), nil
+	}
+	return schedule, err
+}
+
+func GetFeeSchedule(ctx context.Context, feeScheduleId string) (models.FeeSchedule, error) {
+	if feeScheduleId == DefaultFeeScheduleId {
+		return DefaultFeeSchedule(), nil
+	}
+
+	var schedule models.FeeSchedule
+	err := feeScheduleCollection.FindOne(ctx, bson.M{"fee_schedule_id": feeScheduleId}).Decode(&schedule)
+	return schedule, err
+}
+
+// FeeFor picks the tier by comparing amount with the tier thresholds, so
+// amount must be in the schedule's currency.
+func FeeFor(schedule models.FeeSchedule, amount models.Money) models.Money {
+	return amount.MulRate(feeRate(schedule, amount))
+}
+
+func feeRate(schedule models.FeeSchedule, amount models.Money) float64 {
+	tiers := make([]models.FeeTier, len(schedule.Tiers))
+	copy(tiers, schedule.Tiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Above.Amount < tiers[j].Above.Amount })
+
+	if len(tiers) == 0 {
+		return 0
+	}
+
+	rate := *tiers[0].Rate
+	for _, tier := range tiers {
+		if amount.Amount > tier.Above.Amount {
+			rate = *tier.Rate
+		}
+	}
+
+	return rate
+}
+
+// feeForListing charges the tier rate on an amount in any currency, picking
+// the tier from its value in the schedule's currency.
+func feeForListing(ctx context.Context, schedule models.FeeSchedule, amount models.Money) (models.Money, error) {
+	scheduleCurrency := models.DefaultCurrency
+	if len(schedule.Tiers) > 0 {
+		scheduleCurrency = schedule.Tiers[0].Above.Currency
+	}
+
+	basis := amount
+	if amount.Currency != scheduleCurrency {
+		rate, err := ExchangeRateAt(ctx, amount.Currency, scheduleCurrency, time.Now())
+		if err != nil {
+			return models.Money{}, err
+		}
+		basis = amount.Convert(scheduleCurrency, rate)
+	}
+
+	return amount.MulRate(feeRate(schedule, basis)), nil
+}
+
+func PriceTransaction(ctx context.Context, transaction *models.Transaction, schedule models.FeeSchedule) error {
+	var product models.Product
+	err := productCollection.FindOne(ctx, bson.M{"product_id": transaction.Product_id}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		return ErrProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	number, feeType := 1, 1
+	if transaction.Product_number != nil {
+		number = *transaction.Product_number
+	}
+	if transaction.Fee_type != nil {
+		feeType = *transaction.Fee_type
+	}
+
+	price := MoneyOrZero(product.Price)
+	currency := ProductCurrency(product)
+	if transaction.Currency != nil && *transaction.Currency != currency {
+		// The frozen rate was for the old listing currency.
+		transaction.Exchange_rate = nil
+	}
+	transaction.Currency = &currency
+
+	shipping := MoneyOrZero(transaction.Shipping_price)
+	if shipping.Currency != currency {
+		shipping = shipping.WithCurrency(currency)
+		transaction.Shipping_price = &shipping
+	}
+
+	fee, err := feeForListing(ctx, schedule, price.Mul(int64(number)).Add(shipping))
+	if err != nil {
+		return err
+	}
+	buyer, seller := TransactionAmounts(price, number, shipping, fee, feeType)
+
+	transaction.Fee = &fee
+	transaction.Amount_buyer = &buyer
+	transaction.Amount_seller = &seller
+	transaction.Fee_schedule_id = &schedule.Fee_schedule_id
+
+	return PriceCharge(ctx, transaction)
+}
+
+func ProductCurrency(product models.Product) string {
+	if product.Currency != nil && *product.Currency != "" {
+		return strings.ToUpper(*product.Currency)
+	}
+	return MoneyOrZero(product.Price).Currency
+}
+
+func TransactionFeeSchedule(ctx context.Context, transaction models.Transaction) (models.FeeSchedule, error) {
+	if transaction.Fee_schedule_id != nil && *transaction.Fee_schedule_id != "" {
+		return GetFeeSchedule(ctx, *transaction.Fee_schedule_id)
+	}
+	return CurrentFeeSchedule(ctx, transaction.Created_at)
+}
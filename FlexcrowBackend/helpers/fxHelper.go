@@ -0,0 +1,143 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var exchangeRateCollection *mongo.Collection = database.OpenCollection(database.Client, "exchange_rate")
+
+var ErrNoExchangeRate = errors.New("no exchange rate between these currencies")
+
+// ExchangeRateAt returns how many units of to one unit of from buys at the
+// given time, using the inverse of the opposite pair if only that is on file.
+func ExchangeRateAt(ctx context.Context, from string, to string, at time.Time) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+
+	opts := options.FindOne().SetSort(bson.M{"effective_from": -1})
+
+	var rate models.ExchangeRate
+	err := exchangeRateCollection.FindOne(ctx, bson.M{"base": from, "quote": to, "effective_from": bson.M{"$lte": at}}, opts).Decode(&rate)
+	if err == nil {
+		return *rate.Rate, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return 0, err
+	}
+
+	err = exchangeRateCollection.FindOne(ctx, bson.M{"base": to, "quote": from, "effective_from": bson.M{"$lte": at}}, opts).Decode(&rate)
+	if err == mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("%w: %s to %s", ErrNoExchangeRate, from, to)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 1 / *rate.Rate, nil
+}
+
+// TransactionCurrency is the listing currency: what the seller is paid in and
+// what escrow holds.
+func TransactionCurrency(transaction models.Transaction) string {
+	if transaction.Currency != nil && *transaction.Currency != "" {
+		return *transaction.Currency
+	}
+	return MoneyOrZero(transaction.Amount_buyer).Currency
+}
+
+// PaymentCurrency is what the buyer pays in.
+func PaymentCurrency(transaction models.Transaction) string {
+	if transaction.Payment_currency != nil && *transaction.Payment_currency != "" {
+		return *transaction.Payment_currency
+	}
+	return TransactionCurrency(transaction)
+}
+
+// ChargedAmount is what the buyer pays, in the payment currency.
+func ChargedAmount(transaction models.Transaction) models.Money {
+	if transaction.Amount_charged != nil {
+		return *transaction.Amount_charged
+	}
+	return MoneyOrZero(transaction.Amount_buyer)
+}
+
+// ListingAmount converts a payment-currency amount to the listing currency at
+// the rate frozen on the transaction. The full charge maps back to exactly the
+// buyer amount so rounding never leaves dust in escrow.
+func ListingAmount(transaction models.Transaction, paid models.Money) models.Money {
+	listing := TransactionCurrency(transaction)
+	if paid.Currency == listing {
+		return paid
+	}
+	// Transactions from before exchange rates were frozen booked payments in
+	// whatever currency they arrived in.
+	if transaction.Exchange_rate == nil || *transaction.Exchange_rate == 0 {
+		return paid
+	}
+	if paid == ChargedAmount(transaction) {
+		return MoneyOrZero(transaction.Amount_buyer)
+	}
+	return paid.Convert(listing, 1 / *transaction.Exchange_rate)
+}
+
+// ChargeAmount is the inverse of ListingAmount.
+func ChargeAmount(transaction models.Transaction, listing models.Money) models.Money {
+	currency := PaymentCurrency(transaction)
+	if listing.Currency == currency || transaction.Exchange_rate == nil {
+		return listing
+	}
+	if listing == MoneyOrZero(transaction.Amount_buyer) {
+		return ChargedAmount(transaction)
+	}
+	return listing.Convert(currency, *transaction.Exchange_rate)
+}
+
+// EscrowEntries moves money between account and escrow; positive amounts go
+// into escrow. outer is in the account's currency and inner in the escrow
+// currency. When they differ the FX account takes both legs so each currency
+// still balances.
+func EscrowEntries(account string, entryType string, outer models.Money, inner models.Money, ref LedgerRef) []models.LedgerEntry {
+	entries := []models.LedgerEntry{LedgerEntry(account, entryType, outer.Neg(), ref)}
+	if outer.Currency != inner.Currency {
+		entries = append(entries,
+			LedgerEntry(AccountFX, LedgerFXConversion, outer, ref),
+			LedgerEntry(AccountFX, LedgerFXConversion, inner.Neg(), ref),
+		)
+	}
+	return append(entries, LedgerEntry(AccountEscrow, entryType, inner, ref))
+}
+
+// PriceCharge freezes the exchange rate on a transaction the first time it is
+// priced and works out what the buyer is charged in their currency.
+func PriceCharge(ctx context.Context, transaction *models.Transaction) error {
+	listing := TransactionCurrency(*transaction)
+	paying := listing
+	if transaction.Payment_currency != nil && *transaction.Payment_currency != "" {
+		paying = strings.ToUpper(*transaction.Payment_currency)
+	}
+	transaction.Payment_currency = &paying
+
+	if transaction.Exchange_rate == nil {
+		rate, err := ExchangeRateAt(ctx, listing, paying, time.Now())
+		if err != nil {
+			return err
+		}
+		transaction.Exchange_rate = &rate
+	}
+
+	charged := MoneyOrZero(transaction.Amount_buyer).Convert(paying, *transaction.Exchange_rate)
+	transaction.Amount_charged = &charged
+	return nil
+}
@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	pingOnce sync.Once
+	pingErr  error
+)
+
+// testSource stands in for the request a controller would pass to helpers
+// that audit their own writes.
+var testSource = AuditSource{Actor: "admin", Ip_address: "203.0.113.7", Request_id: "req-test"}
+
+// requireDatabase skips tests that need MongoDB unless MONGODB_DATABASE names
+// a throwaway database ending in _test. MONGODB_URL must point at a replica
+// set, since escrow and refunds run in multi-document transactions.
+func requireDatabase(t *testing.T) context.Context {
+	t.Helper()
+
+	if !strings.HasSuffix(os.Getenv("MONGODB_DATABASE"), "_test") {
+		t.Skip("set MONGODB_URL and a MONGODB_DATABASE ending in _test to run database tests")
+	}
+
+	pingOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		pingErr = database.Client.Ping(ctx, nil)
+	})
+	if pingErr != nil {
+		t.Skipf("MongoDB is not reachable: %v", pingErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func seedUser(t *testing.T, ctx context.Context, balance models.Money) string {
+	t.Helper()
+
+	userId := primitive.NewObjectID().Hex()
+	_, err := userCollection.InsertOne(ctx, bson.M{
+		"_id":        primitive.NewObjectID(),
+		"user_id":    userId,
+		"balance":    balance,
+		"wallets":    bson.M{balance.Currency: balance},
+		"created_at": time.Now(),
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("seeding user: %v", err)
+	}
+	return userId
+}
+
+// seedTransaction creates a transaction for amount between two new users.
+func seedTransaction(t *testing.T, ctx context.Context, amount models.Money, status int) models.Transaction {
+	t.Helper()
+
+	seller := seedUser(t, ctx, models.NewMoney(0, amount.Currency))
+	buyer := seedUser(t, ctx, models.NewMoney(0, amount.Currency))
+	currency := amount.Currency
+	fee := models.NewMoney(0, amount.Currency)
+	now := time.Now()
+
+	transaction := models.Transaction{
+		ID:               primitive.NewObjectID(),
+		User_id:          &seller,
+		Customer_id:      &buyer,
+		Status:           &status,
+		Currency:         &currency,
+		Payment_currency: &currency,
+		Fee:              &fee,
+		Amount_buyer:     &amount,
+		Amount_seller:    &amount,
+		Created_at:       now,
+		Updated_at:       now,
+	}
+	transaction.Transaction_id = transaction.ID.Hex()
+
+	if _, err := transactionCollection.InsertOne(ctx, transaction); err != nil {
+		t.Fatalf("seeding transaction: %v", err)
+	}
+	return transaction
+}
+
+// seedCardPayment records a card payment for the whole transaction.
+func seedCardPayment(t *testing.T, ctx context.Context, transaction models.Transaction, status int) models.Payment {
+	t.Helper()
+
+	method := "card"
+	now := time.Now()
+	payment := models.Payment{
+		ID:             primitive.NewObjectID(),
+		User_id:        transaction.Customer_id,
+		Transaction_id: &transaction.Transaction_id,
+		Status:         &status,
+		Amount:         transaction.Amount_buyer,
+		Method:         &method,
+		Created_at:     now,
+		Updated_at:     now,
+	}
+	payment.Payment_id = payment.ID.Hex()
+	if status == PaymentPaid {
+		reference := "pi_" + payment.Payment_id
+		payment.Provider_reference = &reference
+	}
+
+	if _, err := paymentCollection.InsertOne(ctx, payment); err != nil {
+		t.Fatalf("seeding payment: %v", err)
+	}
+	return payment
+}
+
+// seedPaidTransaction creates a processing transaction whose buyer paid amount
+// by card, with the payment held in escrow.
+func seedPaidTransaction(t *testing.T, ctx context.Context, amount models.Money) (models.Transaction, models.Payment) {
+	t.Helper()
+
+	transaction := seedTransaction(t, ctx, amount, TransactionProcessing)
+	payment := seedCardPayment(t, ctx, transaction, PaymentPaid)
+
+	_, err := transactionCollection.UpdateOne(ctx, bson.M{"transaction_id": transaction.Transaction_id}, bson.M{"$set": bson.M{"payment_id": payment.Payment_id}})
+	if err != nil {
+		t.Fatalf("linking payment: %v", err)
+	}
+	transaction.Payment_id = &payment.Payment_id
+
+	ref := LedgerRef{Transaction_id: &transaction.Transaction_id, Payment_id: &payment.Payment_id}
+	if err := PostLedger(ctx, EscrowEntries(AccountExternal, LedgerEscrowHold, amount, amount, ref)...); err != nil {
+		t.Fatalf("seeding escrow: %v", err)
+	}
+	return transaction, payment
+}
+
+func escrowHeld(t *testing.T, ctx context.Context, transaction models.Transaction) models.Money {
+	t.Helper()
+
+	held, err := EscrowHeld(ctx, transaction)
+	if err != nil {
+		t.Fatalf("reading escrow: %v", err)
+	}
+	return held
+}
+
+func transactionStatus(t *testing.T, ctx context.Context, transactionId string) int {
+	t.Helper()
+
+	var transaction models.Transaction
+	if err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": transactionId}).Decode(&transaction); err != nil {
+		t.Fatalf("reading transaction: %v", err)
+	}
+	return *transaction.Status
+}
+
+// auditRecord is the newest audit record of action on resourceId. It fails
+// the test if there is none.
+func auditRecord(t *testing.T, ctx context.Context, action string, resourceId string) models.AuditRecord {
+	t.Helper()
+
+	var record models.AuditRecord
+	err := auditCollection.FindOne(ctx, bson.M{"action": action, "resource_id": resourceId}, options.FindOne().SetSort(bson.M{"sequence": -1})).Decode(&record)
+	if err != nil {
+		t.Fatalf("reading %s audit of %s: %v", action, resourceId, err)
+	}
+	return record
+}
@@ -0,0 +1,41 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"user-athentication-golang/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var leaseCollection *mongo.Collection = database.OpenCollection(database.Client, "lease")
+
+// AcquireLease claims the named lease for holder until ttl from now. It
+// succeeds when the lease is free, expired or already held by holder, so
+// only one instance runs a job at a time.
+func AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	_, err := leaseCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id": name,
+			"$or": bson.A{
+				bson.M{"expires_at": bson.M{"$lt": now}},
+				bson.M{"holder": holder},
+			},
+		},
+		bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,385 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ledgerCollection *mongo.Collection = database.OpenCollection(database.Client, "ledger")
+
+const (
+	AccountEscrow     = "system:escrow"
+	AccountFeeRevenue = "system:fee_revenue"
+	AccountExternal   = "system:external"
+	AccountAdjustment = "system:adjustment"
+	AccountWithdrawal = "system:withdrawal_hold"
+	AccountFX         = "system:fx"
+)
+
+const (
+	LedgerEscrowHold        = "escrow_hold"
+	LedgerRelease           = "release"
+	LedgerFeeRevenue        = "fee_revenue"
+	LedgerWithdrawal        = "withdrawal"
+	LedgerWithdrawalHold    = "withdrawal_hold"
+	LedgerWithdrawalRelease = "withdrawal_release"
+	LedgerRefund            = "refund"
+	LedgerAdjustment        = "admin_adjustment"
+	LedgerOpeningBalance    = "opening_balance"
+	LedgerFXConversion      = "fx_conversion"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+var ErrEscrowOverdrawn = errors.New("escrow holds less than the amount being paid out of it")
+
+type LedgerRef struct {
+	Transaction_id *string
+	Payment_id     *string
+	Withdrawal_id  *string
+	Created_by     *string
+	Note           *string
+}
+
+// BalanceMismatch is a wallet that disagrees with the ledger. Fixed says a
+// carried-over balance was booked as an opening_balance journal; anything
+// else is left for someone to look into.
+type BalanceMismatch struct {
+	User_id string       `json:"user_id"`
+	Cached  models.Money `json:"cached"`
+	Ledger  models.Money `json:"ledger"`
+	Fixed   bool         `json:"fixed"`
+}
+
+func IsUserAccount(account string) bool {
+	return !strings.HasPrefix(account, "system:")
+}
+
+func LedgerEntry(account string, entryType string, amount models.Money, ref LedgerRef) models.LedgerEntry {
+	return models.LedgerEntry{
+		Account:        account,
+		Type:           entryType,
+		Amount:         amount,
+		Transaction_id: ref.Transaction_id,
+		Payment_id:     ref.Payment_id,
+		Withdrawal_id:  ref.Withdrawal_id,
+		Created_by:     ref.Created_by,
+		Note:           ref.Note,
+	}
+}
+
+// PostLedger writes one balanced journal and moves the cached balances of the
+// user accounts it touches. It must run inside a MongoDB transaction.
+func PostLedger(ctx context.Context, entries ...models.LedgerEntry) error {
+	if err := checkEscrowFloor(ctx, entries); err != nil {
+		return err
+	}
+	if err := insertLedgerEntries(ctx, entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !IsUserAccount(entry.Account) {
+			continue
+		}
+		if err := applyBalance(ctx, entry.Account, entry.Amount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkEscrowFloor is the escrow counterpart of the user balance floor: a
+// release or refund may not take more out of escrow than its transaction
+// holds.
+func checkEscrowFloor(ctx context.Context, entries []models.LedgerEntry) error {
+	outflows := map[string]models.Money{}
+	for _, entry := range entries {
+		if entry.Account != AccountEscrow || entry.Amount.Amount >= 0 {
+			continue
+		}
+		if entry.Type != LedgerRelease && entry.Type != LedgerRefund {
+			continue
+		}
+		if entry.Transaction_id == nil {
+			return fmt.Errorf("escrow %s entry has no transaction", entry.Type)
+		}
+
+		outflow, ok := outflows[*entry.Transaction_id]
+		if !ok {
+			outflow = models.NewMoney(0, entry.Amount.Currency)
+		}
+		if outflow.Currency != entry.Amount.Currency {
+			return ErrEscrowOverdrawn
+		}
+		outflows[*entry.Transaction_id] = outflow.Sub(entry.Amount)
+	}
+
+	for transactionId, outflow := range outflows {
+		held, err := EscrowHeld(ctx, models.Transaction{Transaction_id: transactionId})
+		if err != nil {
+			return err
+		}
+		if held.Currency != outflow.Currency || held.Amount < outflow.Amount {
+			return ErrEscrowOverdrawn
+		}
+	}
+	return nil
+}
+
+func insertLedgerEntries(ctx context.Context, entries []models.LedgerEntry) error {
+	if len(entries) < 2 {
+		return fmt.Errorf("ledger journal needs at least two entries, got %d", len(entries))
+	}
+
+	sums := map[string]int64{}
+	for _, entry := range entries {
+		sums[entry.Amount.Currency] += entry.Amount.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("ledger journal does not balance: %s off by %d", currency, sum)
+		}
+	}
+
+	journalId := primitive.NewObjectID().Hex()
+	now := time.Now()
+
+	documents := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		entry.ID = primitive.NewObjectID()
+		entry.Ledger_id = entry.ID.Hex()
+		entry.Journal_id = journalId
+		entry.Created_at = now
+		documents = append(documents, entry)
+	}
+
+	_, err := ledgerCollection.InsertMany(ctx, documents)
+	return err
+}
+
+// applyBalance moves the user's wallet in the amount's currency. The default
+// currency wallet is mirrored in the legacy balance field for older clients.
+// A wallet seeded from that legacy balance gets an opening_balance journal,
+// so the ledger accounts for the money it starts with.
+func applyBalance(ctx context.Context, userId string, amount models.Money) error {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return err
+	}
+
+	wallet := "wallets." + amount.Currency
+	isDefault := amount.Currency == models.DefaultCurrency
+
+	if _, ok := user.Wallets[amount.Currency]; !ok {
+		seed := models.NewMoney(0, amount.Currency)
+		if isDefault && user.Balance != nil && user.Balance.Currency == amount.Currency {
+			seed = *user.Balance
+		}
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": userId, wallet: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{wallet: seed}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 1 && seed.Amount != 0 {
+			if err := postOpeningBalance(ctx, userId, seed); err != nil {
+				return err
+			}
+		}
+	}
+
+	if isDefault && user.Balance == nil {
+		_, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": userId, "balance": nil},
+			bson.M{"$set": bson.M{"balance": models.NewMoney(0, amount.Currency)}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	filter := bson.M{"user_id": userId}
+	if amount.Amount < 0 {
+		filter[wallet+".amount"] = bson.M{"$gte": -amount.Amount}
+	}
+
+	increment := bson.M{wallet + ".amount": amount.Amount}
+	if isDefault {
+		increment["balance.amount"] = amount.Amount
+	}
+
+	result, err := userCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$inc": increment,
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if amount.Amount < 0 {
+			return ErrInsufficientBalance
+		}
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// postOpeningBalance books money a user held before the ledger existed. It
+// only writes the journal; the wallet already holds the amount.
+func postOpeningBalance(ctx context.Context, userId string, amount models.Money) error {
+	note := "balance carried over from before the ledger"
+	ref := LedgerRef{Note: &note}
+	return insertLedgerEntries(ctx, []models.LedgerEntry{
+		LedgerEntry(AccountAdjustment, LedgerOpeningBalance, amount.Neg(), ref),
+		LedgerEntry(userId, LedgerOpeningBalance, amount, ref),
+	})
+}
+
+// UserWallets returns the user's balance per currency, falling back to the
+// legacy balance field for users who have no wallets yet.
+func UserWallets(user models.User) map[string]models.Money {
+	wallets := map[string]models.Money{}
+	for currency, amount := range user.Wallets {
+		wallets[currency] = amount
+	}
+	if _, ok := wallets[models.DefaultCurrency]; !ok && user.Balance != nil {
+		wallets[user.Balance.Currency] = *user.Balance
+	}
+	return wallets
+}
+
+// LedgerBalances sums the ledger per account and currency.
+func LedgerBalances(ctx context.Context) (map[string]map[string]models.Money, error) {
+	cursor, err := ledgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"account": "$account", "currency": "$amount.currency"},
+			"total": bson.M{"$sum": "$amount.amount"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Key struct {
+			Account  string `bson:"account"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	balances := map[string]map[string]models.Money{}
+	for _, row := range rows {
+		if balances[row.Key.Account] == nil {
+			balances[row.Key.Account] = map[string]models.Money{}
+		}
+		balances[row.Key.Account][row.Key.Currency] = models.NewMoney(row.Total, row.Key.Currency)
+	}
+	return balances, nil
+}
+
+// ReconcileBalances compares every user's cached wallets with the ledger.
+// With fix, a wallet holding more than the ledger accounts for is taken to
+// carry money from before the ledger and gets an opening_balance journal for
+// the difference. Wallets are never rewritten, so a wallet holding less is
+// only reported. Each fix is audited on behalf of source in the transaction
+// that makes it.
+func ReconcileBalances(ctx context.Context, fix bool, source AuditSource) ([]BalanceMismatch, error) {
+	balances, err := LedgerBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := userCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	mismatches := []BalanceMismatch{}
+	for _, user := range users {
+		wallets := UserWallets(user)
+		currencies := map[string]bool{}
+		for currency := range wallets {
+			currencies[currency] = true
+		}
+		for currency := range balances[user.User_id] {
+			currencies[currency] = true
+		}
+
+		for currency := range currencies {
+			cached, hasWallet := wallets[currency]
+			if !hasWallet {
+				cached = models.NewMoney(0, currency)
+			}
+			ledger, hasEntries := balances[user.User_id][currency]
+			if !hasEntries {
+				ledger = models.NewMoney(0, currency)
+			}
+			if cached.Amount == ledger.Amount {
+				continue
+			}
+
+			mismatch := BalanceMismatch{User_id: user.User_id, Cached: cached, Ledger: ledger}
+			if !fix || cached.Amount < ledger.Amount {
+				mismatches = append(mismatches, mismatch)
+				continue
+			}
+
+			userId := user.User_id
+			carried := cached.Sub(ledger)
+			err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+				if err := postOpeningBalance(sessCtx, userId, carried); err != nil {
+					return err
+				}
+				// A balance only held in the legacy field becomes a wallet
+				// now, so applyBalance does not book it a second time.
+				if _, ok := user.Wallets[currency]; !ok {
+					wallet := "wallets." + currency
+					_, err := userCollection.UpdateOne(sessCtx, bson.M{"user_id": userId, wallet: bson.M{"$exists": false}}, bson.M{"$set": bson.M{wallet: cached}})
+					if err != nil {
+						return err
+					}
+				}
+				return WriteAudit(sessCtx, "ledger.reconciled", source, "user", userId, map[string]interface{}{
+					"currency":        currency,
+					"cached":          cached,
+					"ledger":          ledger,
+					"opening_balance": carried,
+				})
+			})
+			if err != nil {
+				return mismatches, err
+			}
+			mismatch.Fixed = true
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	return mismatches, nil
+}
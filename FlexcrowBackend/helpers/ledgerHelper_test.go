@@ -0,0 +1,129 @@
+package helper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// seedLegacyUser creates a user whose money is only in the pre-ledger
+// balance field.
+func seedLegacyUser(t *testing.T, ctx context.Context, balance models.Money) string {
+	t.Helper()
+
+	userId := primitive.NewObjectID().Hex()
+	_, err := userCollection.InsertOne(ctx, bson.M{
+		"_id":        primitive.NewObjectID(),
+		"user_id":    userId,
+		"balance":    balance,
+		"created_at": time.Now(),
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("seeding user: %v", err)
+	}
+	return userId
+}
+
+func adjustBalance(t *testing.T, ctx context.Context, userId string, amount models.Money) {
+	t.Helper()
+
+	err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		return PostLedger(sessCtx,
+			LedgerEntry(AccountAdjustment, LedgerAdjustment, amount.Neg(), LedgerRef{}),
+			LedgerEntry(userId, LedgerAdjustment, amount, LedgerRef{}),
+		)
+	})
+	if err != nil {
+		t.Fatalf("adjusting balance: %v", err)
+	}
+}
+
+func ledgerBalance(t *testing.T, ctx context.Context, userId string, currency string) int64 {
+	t.Helper()
+
+	balances, err := LedgerBalances(ctx)
+	if err != nil {
+		t.Fatalf("reading ledger: %v", err)
+	}
+	return balances[userId][currency].Amount
+}
+
+func reconcile(t *testing.T, ctx context.Context, userId string) (BalanceMismatch, bool) {
+	t.Helper()
+
+	mismatches, err := ReconcileBalances(ctx, true, testSource)
+	if err != nil {
+		t.Fatalf("ReconcileBalances: %v", err)
+	}
+	for _, mismatch := range mismatches {
+		if mismatch.User_id == userId {
+			return mismatch, true
+		}
+	}
+	return BalanceMismatch{}, false
+}
+
+func TestApplyBalanceBooksLegacyBalance(t *testing.T) {
+	ctx := requireDatabase(t)
+	userId := seedLegacyUser(t, ctx, models.NewMoney(5000, "THB"))
+
+	adjustBalance(t, ctx, userId, models.NewMoney(1000, "THB"))
+
+	if balance := walletAmount(t, ctx, userId, "THB"); balance != 6000 {
+		t.Errorf("wallet holds %d, want 6000", balance)
+	}
+	if balance := ledgerBalance(t, ctx, userId, "THB"); balance != 6000 {
+		t.Errorf("ledger holds %d, want the carried-over 5000 plus 1000", balance)
+	}
+	if mismatch, found := reconcile(t, ctx, userId); found {
+		t.Errorf("reconcile reported %+v", mismatch)
+	}
+}
+
+func TestReconcileBalancesKeepsCarriedOverFunds(t *testing.T) {
+	ctx := requireDatabase(t)
+	// A wallet seeded from the legacy balance before the seed was booked.
+	userId := seedUser(t, ctx, models.NewMoney(5000, "THB"))
+	adjustBalance(t, ctx, userId, models.NewMoney(1000, "THB"))
+
+	mismatch, found := reconcile(t, ctx, userId)
+	if !found || !mismatch.Fixed || mismatch.Cached.Amount != 6000 || mismatch.Ledger.Amount != 1000 {
+		t.Fatalf("reconcile reported %+v, want a fixed 6000 against 1000", mismatch)
+	}
+	if balance := walletAmount(t, ctx, userId, "THB"); balance != 6000 {
+		t.Errorf("wallet holds %d after reconciling, want 6000", balance)
+	}
+	if balance := ledgerBalance(t, ctx, userId, "THB"); balance != 6000 {
+		t.Errorf("ledger holds %d after reconciling, want 6000", balance)
+	}
+	if mismatch, found := reconcile(t, ctx, userId); found {
+		t.Errorf("second reconcile reported %+v", mismatch)
+	}
+}
+
+func TestReconcileBalancesOnlyReportsShortWallets(t *testing.T) {
+	ctx := requireDatabase(t)
+	userId := seedUser(t, ctx, models.NewMoney(0, "THB"))
+	err := insertLedgerEntries(ctx, []models.LedgerEntry{
+		LedgerEntry(AccountAdjustment, LedgerAdjustment, models.NewMoney(-1000, "THB"), LedgerRef{}),
+		LedgerEntry(userId, LedgerAdjustment, models.NewMoney(1000, "THB"), LedgerRef{}),
+	})
+	if err != nil {
+		t.Fatalf("seeding ledger: %v", err)
+	}
+
+	mismatch, found := reconcile(t, ctx, userId)
+	if !found || mismatch.Fixed {
+		t.Fatalf("reconcile reported %+v, want an unfixed mismatch", mismatch)
+	}
+	if balance := walletAmount(t, ctx, userId, "THB"); balance != 0 {
+		t.Errorf("wallet holds %d, want it left alone", balance)
+	}
+}
@@ -0,0 +1,202 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var loginAttemptCollection *mongo.Collection = database.OpenCollection(database.Client, "login_attempt")
+
+// A key gets a few free failures, then each further failure doubles how long
+// it is locked, up to a cap. Failures are forgotten a day after the last one.
+type loginPolicy struct {
+	free int
+	max  time.Duration
+}
+
+var (
+	accountLoginPolicy = loginPolicy{free: 5, max: 30 * time.Minute}
+	ipLoginPolicy      = loginPolicy{free: 20, max: time.Hour}
+)
+
+const loginFailureMemory = 24 * time.Hour
+
+// LoginLockedError says a login was refused without checking the password.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed logins; try again after %s", e.Until.Format(time.RFC3339))
+}
+
+// RetryAfter is the whole number of seconds left on the lock.
+func (e *LoginLockedError) RetryAfter() int {
+	seconds := int(time.Until(e.Until).Seconds()) + 1
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// Accounts are keyed by email rather than user id so that unknown addresses
+// are throttled the same way and the lock gives nothing away.
+func accountLoginKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (p loginPolicy) backoff(failures int) time.Duration {
+	if failures <= p.free {
+		return 0
+	}
+	delay := time.Second
+	for i := p.free + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.max {
+			return p.max
+		}
+	}
+	return delay
+}
+
+// CheckLoginAllowed refuses a login while the account or the client IP is
+// locked, returning a *LoginLockedError with the later of the two locks.
+func CheckLoginAllowed(ctx context.Context, email string, ip string) error {
+	cursor, err := loginAttemptCollection.Find(ctx, bson.M{
+		"_id":          bson.M{"$in": bson.A{accountLoginKey(email), ipLoginKey(ip)}},
+		"locked_until": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+
+	var attempts []struct {
+		Locked_until time.Time `bson:"locked_until"`
+	}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return err
+	}
+
+	var locked *LoginLockedError
+	for _, attempt := range attempts {
+		if locked == nil || attempt.Locked_until.After(locked.Until) {
+			locked = &LoginLockedError{Until: attempt.Locked_until}
+		}
+	}
+	if locked != nil {
+		return locked
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed login against the account and the IP,
+// locks either once it runs out of free attempts and stores a security event.
+func RecordLoginFailure(ctx context.Context, event models.SecurityEvent, reason string) error {
+	accountUntil, accountFailures, err := addLoginFailure(ctx, accountLoginKey(event.Email), accountLoginPolicy)
+	if err != nil {
+		return err
+	}
+	ipUntil, ipFailures, err := addLoginFailure(ctx, ipLoginKey(event.Ip_address), ipLoginPolicy)
+	if err != nil {
+		return err
+	}
+
+	event.Type = SecurityLoginFailed
+	event.Details = map[string]interface{}{
+		"reason":           reason,
+		"account_failures": accountFailures,
+		"ip_failures":      ipFailures,
+	}
+	if err := RecordSecurityEvent(ctx, event); err != nil {
+		return err
+	}
+
+	until := accountUntil
+	if ipUntil.After(until) {
+		until = ipUntil
+	}
+	if until.IsZero() {
+		return nil
+	}
+
+	event.Type = SecurityLoginLocked
+	event.Details = map[string]interface{}{"locked_until": until, "reason": reason}
+	return RecordSecurityEvent(ctx, event)
+}
+
+func addLoginFailure(ctx context.Context, key string, policy loginPolicy) (time.Time, int, error) {
+	now := time.Now()
+
+	_, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"_id": key, "last_failure_at": bson.M{"$lt": now.Add(-loginFailureMemory)}})
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var attempt struct {
+		Failures int `bson:"failures"`
+	}
+	err = loginAttemptCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"last_failure_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if IsDuplicateKeyError(err) {
+		return addLoginFailure(ctx, key, policy)
+	}
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	delay := policy.backoff(attempt.Failures)
+	if delay == 0 {
+		return time.Time{}, attempt.Failures, nil
+	}
+
+	until := now.Add(delay)
+	_, err = loginAttemptCollection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"locked_until": until}})
+	return until, attempt.Failures, err
+}
+
+// ClearLoginFailures forgets the failures of an account after it logs in.
+// The IP counter is left alone so one good account cannot reset it.
+func ClearLoginFailures(ctx context.Context, email string) error {
+	_, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"_id": accountLoginKey(email)})
+	return err
+}
+
+// UnlockAccount lifts an account lock early and records who did it.
+func UnlockAccount(ctx context.Context, user models.User, source AuditSource) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if err := ClearLoginFailures(sessCtx, *user.Email); err != nil {
+			return err
+		}
+
+		if err := RecordSecurityEvent(sessCtx, models.SecurityEvent{
+			Type:    SecurityAccountUnlocked,
+			User_id: &user.User_id,
+			Email:   *user.Email,
+			Details: map[string]interface{}{"unlocked_by": source.Actor},
+		}); err != nil {
+			return err
+		}
+
+		return WriteAudit(sessCtx, "user.unlocked", source, "user", user.User_id, nil)
+	})
+}
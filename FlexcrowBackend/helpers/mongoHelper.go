@@ -0,0 +1,42 @@
+package helper
+
+import (
+	"context"
+	"errors"
+
+	"user-athentication-golang/database"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func RunInTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) error) error {
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return err
+}
+
+func IsDuplicateKeyError(err error) bool {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == 11000 {
+				return true
+			}
+		}
+	}
+
+	var commandError mongo.CommandError
+	if errors.As(err, &commandError) {
+		return commandError.Code == 11000
+	}
+
+	return false
+}
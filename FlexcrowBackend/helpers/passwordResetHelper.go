@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"user-athentication-golang/mailer"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const PurposeResetPassword = "reset_password"
+
+const resetPasswordLifetime = time.Hour
+
+// SendPasswordReset mails a reset link when email belongs to an account and
+// does nothing otherwise, so callers answer the same way in both cases.
+func SendPasswordReset(ctx context.Context, email string) error {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	raw, err := IssueUserToken(ctx, user.User_id, PurposeResetPassword, *user.Email, resetPasswordLifetime)
+	if err != nil {
+		return err
+	}
+
+	link := AppURL() + "/auth/reset-password?token=" + url.QueryEscape(raw)
+	return mailer.Provider().Send(ctx, mailer.Message{
+		To:      *user.Email,
+		Subject: "Reset your Flexcrow password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. Open this link within %d minutes to choose a new one:\n\n%s\n\nIf it was not you, ignore this email; your password stays the same.\n",
+			*user.First_name, int(resetPasswordLifetime.Minutes()), link),
+	})
+}
+
+// ResetPassword spends a reset token on a new, already hashed, password. It
+// signs the user out everywhere and voids any other reset links. source
+// carries the request; the actor is the token's user.
+func ResetPassword(ctx context.Context, raw string, hashedPassword string, source AuditSource) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		token, err := ConsumeUserToken(sessCtx, PurposeResetPassword, raw)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result, err := userCollection.UpdateOne(
+			sessCtx,
+			bson.M{"user_id": token.User_id, "email": token.Email},
+			bson.M{"$set": bson.M{
+				"password":            hashedPassword,
+				"password_changed_at": now,
+				"updated_at":          now.Format(time.RFC3339),
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrInvalidUserToken
+		}
+
+		if err := ExpireUserTokens(sessCtx, token.User_id, PurposeResetPassword); err != nil {
+			return err
+		}
+		if _, err := RevokeUserSessions(sessCtx, token.User_id, SessionRevokedPasswordChange); err != nil {
+			return err
+		}
+
+		source.Actor = token.User_id
+		return WriteAudit(sessCtx, "user.password_reset", source, "user", token.User_id, nil)
+	})
+}
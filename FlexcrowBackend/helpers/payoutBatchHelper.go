@@ -0,0 +1,274 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+	"user-athentication-golang/payout"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var payoutBatchCollection *mongo.Collection = database.OpenCollection(database.Client, "payout_batch")
+
+const (
+	PayoutBatchOpen    = 1
+	PayoutBatchSettled = 2
+)
+
+const (
+	BatchItemPending = 1
+	BatchItemPaid    = 2
+	BatchItemFailed  = 3
+)
+
+const PayoutProviderBankBatch = "bank_batch"
+
+var ErrNothingToBatch = errors.New("there are no approved withdrawals waiting to be paid")
+
+type BatchResultSummary struct {
+	Paid      int      `json:"paid"`
+	Failed    int      `json:"failed"`
+	Skipped   int      `json:"skipped"`
+	Unmatched []string `json:"unmatched"`
+}
+
+// CreatePayoutBatch collects every approved withdrawal that no provider has
+// taken yet and moves them into a new batch, so they cannot be approved for
+// payout twice while the bank file is out.
+func CreatePayoutBatch(ctx context.Context, source AuditSource) (models.PayoutBatch, error) {
+	var batch models.PayoutBatch
+
+	cursor, err := withdrawalCollection.Find(ctx, bson.M{
+		"status":           WithdrawalApproved,
+		"payout_reference": bson.M{"$in": bson.A{nil, ""}},
+	})
+	if err != nil {
+		return batch, err
+	}
+	var withdrawals []models.Withdrawal
+	if err := cursor.All(ctx, &withdrawals); err != nil {
+		return batch, err
+	}
+	if len(withdrawals) == 0 {
+		return batch, ErrNothingToBatch
+	}
+
+	names, err := userNames(ctx, withdrawals)
+	if err != nil {
+		return batch, err
+	}
+
+	now := time.Now()
+	status := PayoutBatchOpen
+	batch = models.PayoutBatch{
+		ID:         primitive.NewObjectID(),
+		Status:     &status,
+		Created_by: &source.Actor,
+		Created_at: now,
+		Updated_at: now,
+	}
+	batch.Batch_id = batch.ID.Hex()
+
+	ids := bson.A{}
+	for _, withdrawal := range withdrawals {
+		batch.Items = append(batch.Items, models.PayoutBatchItem{
+			Withdrawal_id: withdrawal.Withdrawal_id,
+			User_id:       *withdrawal.User_id,
+			Name:          names[*withdrawal.User_id],
+			Method:        *withdrawal.Method,
+			Account:       *withdrawal.Account,
+			Amount:        *withdrawal.Amount,
+			Status:        BatchItemPending,
+		})
+		ids = append(ids, withdrawal.Withdrawal_id)
+	}
+
+	err = RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if _, err := payoutBatchCollection.InsertOne(sessCtx, batch); err != nil {
+			return err
+		}
+
+		result, err := withdrawalCollection.UpdateMany(
+			sessCtx,
+			bson.M{
+				"withdrawal_id":    bson.M{"$in": ids},
+				"status":           WithdrawalApproved,
+				"payout_reference": bson.M{"$in": bson.A{nil, ""}},
+			},
+			bson.M{"$set": bson.M{
+				"status":          WithdrawalInBatch,
+				"batch_id":        batch.Batch_id,
+				"payout_provider": PayoutProviderBankBatch,
+				"payout_failure":  nil,
+				"updated_at":      now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount != int64(len(ids)) {
+			return ErrWithdrawalConflict
+		}
+
+		return WriteAudit(sessCtx, "payout_batch.create", source, "payout_batch", batch.Batch_id, map[string]interface{}{
+			"withdrawals": len(ids),
+		})
+	})
+	return batch, err
+}
+
+func userNames(ctx context.Context, withdrawals []models.Withdrawal) (map[string]string, error) {
+	ids := bson.A{}
+	for _, withdrawal := range withdrawals {
+		ids = append(ids, *withdrawal.User_id)
+	}
+
+	cursor, err := userCollection.Find(ctx, bson.M{"user_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	for _, user := range users {
+		var parts []string
+		if user.First_name != nil {
+			parts = append(parts, *user.First_name)
+		}
+		if user.Last_name != nil {
+			parts = append(parts, *user.Last_name)
+		}
+		names[user.User_id] = strings.Join(parts, " ")
+	}
+	return names, nil
+}
+
+// ApplyBatchResult settles batch items from the bank's result file. Paid
+// items send the held funds out; failed items go back to approved with the
+// bank's reason so they can be batched again or rejected. Items that were
+// already settled by an earlier upload are skipped.
+func ApplyBatchResult(ctx context.Context, batch models.PayoutBatch, outcomes []payout.BatchOutcome, source AuditSource) (BatchResultSummary, error) {
+	summary := BatchResultSummary{Unmatched: []string{}}
+
+	items := map[string]models.PayoutBatchItem{}
+	for _, item := range batch.Items {
+		items[item.Withdrawal_id] = item
+	}
+
+	for _, outcome := range outcomes {
+		item, ok := items[outcome.End_to_end_id]
+		if !ok {
+			summary.Unmatched = append(summary.Unmatched, outcome.End_to_end_id)
+			continue
+		}
+		if item.Status != BatchItemPending {
+			summary.Skipped++
+			continue
+		}
+
+		if err := settleBatchItem(ctx, batch, item, outcome, source.Actor); err != nil {
+			return summary, err
+		}
+		item.Status = BatchItemFailed
+		if outcome.Paid {
+			item.Status = BatchItemPaid
+			summary.Paid++
+		} else {
+			summary.Failed++
+		}
+		items[item.Withdrawal_id] = item
+	}
+
+	err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		_, err := payoutBatchCollection.UpdateOne(
+			sessCtx,
+			bson.M{"batch_id": batch.Batch_id, "status": PayoutBatchOpen, "items.status": bson.M{"$ne": BatchItemPending}},
+			bson.M{"$set": bson.M{"status": PayoutBatchSettled, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+
+		return WriteAudit(sessCtx, "payout_batch.result", source, "payout_batch", batch.Batch_id, map[string]interface{}{
+			"paid":      summary.Paid,
+			"failed":    summary.Failed,
+			"skipped":   summary.Skipped,
+			"unmatched": len(summary.Unmatched),
+		})
+	})
+	return summary, err
+}
+
+func settleBatchItem(ctx context.Context, batch models.PayoutBatch, item models.PayoutBatchItem, outcome payout.BatchOutcome, actor string) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		var withdrawal models.Withdrawal
+		err := withdrawalCollection.FindOne(sessCtx, bson.M{
+			"withdrawal_id": item.Withdrawal_id,
+			"status":        WithdrawalInBatch,
+			"batch_id":      batch.Batch_id,
+		}).Decode(&withdrawal)
+		if err == mongo.ErrNoDocuments {
+			return ErrWithdrawalConflict
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		itemUpdate := bson.M{"items.$.settled_at": now}
+
+		if outcome.Paid {
+			reference := outcome.Reference
+			if reference == "" {
+				reference = batch.Batch_id + "/" + item.Withdrawal_id
+			}
+			itemUpdate["items.$.status"] = BatchItemPaid
+			itemUpdate["items.$.reference"] = reference
+
+			err = transitionWithdrawal(sessCtx, withdrawal, WithdrawalPaid, bson.M{"payout_reference": reference}, actor)
+		} else {
+			itemUpdate["items.$.status"] = BatchItemFailed
+			itemUpdate["items.$.failure"] = outcome.Reason
+
+			_, err = withdrawalCollection.UpdateOne(
+				sessCtx,
+				bson.M{"withdrawal_id": item.Withdrawal_id, "status": WithdrawalInBatch},
+				bson.M{"$set": bson.M{
+					"status":         WithdrawalApproved,
+					"batch_id":       nil,
+					"payout_failure": outcome.Reason,
+					"updated_at":     now,
+				}},
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := payoutBatchCollection.UpdateOne(
+			sessCtx,
+			bson.M{
+				"batch_id": batch.Batch_id,
+				"items":    bson.M{"$elemMatch": bson.M{"withdrawal_id": item.Withdrawal_id, "status": BatchItemPending}},
+			},
+			bson.M{"$set": itemUpdate},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrWithdrawalConflict
+		}
+		return nil
+	})
+}
@@ -0,0 +1,275 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+	"user-athentication-golang/policy"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var roleCollection *mongo.Collection = database.OpenCollection(database.Client, "role")
+
+const (
+	RoleSuperuser = "superuser"
+	RoleSupport   = "support"
+	RoleFinance   = "finance"
+	RoleModerator = "moderator"
+)
+
+// BuiltInRoles cannot be edited or deleted. Users whose user_type is ADMIN
+// always hold RoleSuperuser, which grants every permission.
+var BuiltInRoles = []models.Role{
+	{
+		Role_id:     RoleSuperuser,
+		Name:        "Superuser",
+		Description: "Every permission; held by all ADMIN users",
+		Permissions: allPermissions(),
+	},
+	{
+		Role_id:     RoleSupport,
+		Name:        "Support",
+		Description: "Helps users with their accounts, orders and disputes",
+		Permissions: []string{
+			policy.PermUsersView,
+			policy.PermUsersUnlock,
+			policy.PermTransactionsViewAll,
+			policy.PermTransactionsResolveDispute,
+			policy.PermWithdrawalsViewAll,
+			policy.PermSecurityEventsView,
+		},
+	},
+	{
+		Role_id:     RoleFinance,
+		Name:        "Finance",
+		Description: "Moves money: refunds, withdrawals, payouts, fees and balances",
+		Permissions: []string{
+			policy.PermUsersView,
+			policy.PermUsersEditBalance,
+			policy.PermTransactionsViewAll,
+			policy.PermTransactionsRefund,
+			policy.PermWithdrawalsViewAll,
+			policy.PermWithdrawalsApprove,
+			policy.PermWithdrawalsPayout,
+			policy.PermWithdrawalsManageRules,
+			policy.PermPayoutBatchesManage,
+			policy.PermLedgerViewAll,
+			policy.PermLedgerReconcile,
+			policy.PermFeesManage,
+			policy.PermExchangeRatesManage,
+		},
+	},
+	{
+		Role_id:     RoleModerator,
+		Name:        "Moderator",
+		Description: "Keeps listings and uploads clean",
+		Permissions: []string{
+			policy.PermUsersView,
+			policy.PermProductsManage,
+			policy.PermFilesViewAll,
+			policy.PermFilesDelete,
+		},
+	},
+}
+
+var ErrUnknownRole = errors.New("unknown role")
+var ErrUnknownPermission = errors.New("unknown permission")
+var ErrBuiltInRole = errors.New("built-in roles cannot be changed")
+var ErrPermissionDenied = errors.New("Unauthorized to access this resource")
+
+func allPermissions() []string {
+	permissions := make([]string, 0, len(policy.Permissions))
+	for permission := range policy.Permissions {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+func builtInRole(roleId string) (models.Role, bool) {
+	for _, role := range BuiltInRoles {
+		if role.Role_id == roleId {
+			role.Built_in = true
+			return role, true
+		}
+	}
+	return models.Role{}, false
+}
+
+func IsBuiltInRole(roleId string) bool {
+	_, ok := builtInRole(roleId)
+	return ok
+}
+
+// ValidatePermissions rejects permission names that are not in Permissions.
+func ValidatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if _, ok := policy.Permissions[permission]; !ok {
+			return ErrUnknownPermission
+		}
+	}
+	return nil
+}
+
+// Roles lists the built-in roles followed by the custom ones.
+func Roles(ctx context.Context) ([]models.Role, error) {
+	roles := []models.Role{}
+	for _, role := range BuiltInRoles {
+		role.Built_in = true
+		roles = append(roles, role)
+	}
+
+	cursor, err := roleCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return roles, err
+	}
+	var custom []models.Role
+	if err := cursor.All(ctx, &custom); err != nil {
+		return roles, err
+	}
+	return append(roles, custom...), nil
+}
+
+// FindRole looks a role up by id among the built-in and custom roles.
+func FindRole(ctx context.Context, roleId string) (models.Role, error) {
+	if role, ok := builtInRole(roleId); ok {
+		return role, nil
+	}
+
+	var role models.Role
+	err := roleCollection.FindOne(ctx, bson.M{"role_id": roleId}).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return role, ErrUnknownRole
+	}
+	return role, err
+}
+
+// UserRoles returns the roles a user holds, adding the superuser role for
+// ADMIN users.
+func UserRoles(user models.User) []string {
+	roles := append([]string{}, user.Roles...)
+	if user.User_type != nil && *user.User_type == "ADMIN" {
+		roles = append(roles, RoleSuperuser)
+	}
+	return roles
+}
+
+// RolePermissions merges the permissions of the given roles. Roles that no
+// longer exist grant nothing.
+func RolePermissions(ctx context.Context, roleIds []string) (map[string]bool, error) {
+	permissions := map[string]bool{}
+	for _, roleId := range roleIds {
+		role, err := FindRole(ctx, roleId)
+		if err == ErrUnknownRole {
+			continue
+		}
+		if err != nil {
+			return permissions, err
+		}
+		for _, permission := range role.Permissions {
+			permissions[permission] = true
+		}
+	}
+	return permissions, nil
+}
+
+// UserPermissions loads the permissions granted to a user by their roles.
+func UserPermissions(ctx context.Context, userId string) (map[string]bool, error) {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+	return RolePermissions(ctx, UserRoles(user))
+}
+
+// ActorPermissions returns the permissions of the signed-in user, loading
+// them once per request.
+func ActorPermissions(c *gin.Context) (map[string]bool, error) {
+	if cached, ok := c.Get("permissions"); ok {
+		return cached.(map[string]bool), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	permissions, err := UserPermissions(ctx, c.GetString("uid"))
+	if err != nil {
+		return nil, err
+	}
+	c.Set("permissions", permissions)
+	return permissions, nil
+}
+
+// HasPermission reports whether the signed-in user holds permission. A
+// failure to load the user's roles counts as not holding it.
+func HasPermission(c *gin.Context, permission string) bool {
+	permissions, err := ActorPermissions(c)
+	if err != nil {
+		log.Printf("loading permissions for user %s: %v", c.GetString("uid"), err)
+		return false
+	}
+	return permissions[permission]
+}
+
+// CheckPermission returns ErrPermissionDenied unless the signed-in user
+// holds permission.
+func CheckPermission(c *gin.Context, permission string) error {
+	if !HasPermission(c, permission) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// CanGrantRoles reports whether the signed-in user holds every permission the
+// given roles grant, so nobody can hand out more access than they have.
+func CanGrantRoles(ctx context.Context, c *gin.Context, roleIds []string) (bool, error) {
+	granted, err := RolePermissions(ctx, roleIds)
+	if err != nil {
+		return false, err
+	}
+	held, err := ActorPermissions(c)
+	if err != nil {
+		return false, err
+	}
+	for permission := range granted {
+		if !held[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// IsSuperuser reports whether the signed-in user holds every permission.
+func IsSuperuser(c *gin.Context) bool {
+	held, err := ActorPermissions(c)
+	if err != nil {
+		return false
+	}
+	for permission := range policy.Permissions {
+		if !held[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// CurrentActor describes the signed-in user for the policy package.
+func CurrentActor(c *gin.Context) policy.Actor {
+	permissions, err := ActorPermissions(c)
+	if err != nil {
+		log.Printf("loading permissions for user %s: %v", c.GetString("uid"), err)
+		permissions = map[string]bool{}
+	}
+	return policy.Actor{User_id: c.GetString("uid"), Permissions: permissions}
+}
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"user-athentication-golang/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var rateLimitCollection *mongo.Collection = database.OpenCollection(database.Client, "rate_limit")
+
+// AllowRate counts one hit against key in the current fixed window and
+// reports whether it is within limit. Counters live in MongoDB so every
+// instance shares them.
+func AllowRate(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	now := time.Now()
+	start := now.Truncate(window)
+
+	var counter struct {
+		Hits int `bson:"hits"`
+	}
+	err := rateLimitCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": fmt.Sprintf("%s:%d", key, start.Unix())},
+		bson.M{
+			"$inc":         bson.M{"hits": 1},
+			"$setOnInsert": bson.M{"key": key, "expires_at": start.Add(window)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if IsDuplicateKeyError(err) {
+		return AllowRate(ctx, key, limit, window)
+	}
+	if err != nil {
+		return false, err
+	}
+	return counter.Hits <= limit, nil
+}
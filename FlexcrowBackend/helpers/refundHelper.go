@@ -0,0 +1,337 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"user-athentication-golang/models"
+	"user-athentication-golang/refund"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RefundToCard    = "card"
+	RefundToBalance = "balance"
+)
+
+const (
+	MethodCardRefund    = "card_refund"
+	MethodBalanceRefund = "balance_refund"
+)
+
+var ErrRefundExceedsEscrow = errors.New("refund amount must be positive and no more than the amount held in escrow")
+var ErrNoRefundablePayment = errors.New("transaction has no captured card payment to refund")
+var ErrRefundFailed = errors.New("refund was declined by the payment provider and the funds were returned to escrow")
+
+type RefundRequest struct {
+	Amount      models.Money
+	Destination string
+	Source      AuditSource
+	Reason      string
+}
+
+// PendingRefund is a card refund that is booked but not yet sent to the
+// payment provider; pass it to SettleRefund once the booking commits.
+type PendingRefund struct {
+	Refund        models.Payment
+	Original      models.Payment
+	Escrow_amount models.Money
+	Reason        string
+	Source        AuditSource
+}
+
+func capturedPayment(ctx context.Context, transaction models.Transaction) (models.Payment, error) {
+	linked := bson.A{bson.M{"transaction_id": transaction.Transaction_id}}
+	if transaction.Payment_id != nil && *transaction.Payment_id != "" {
+		linked = append(linked, bson.M{"payment_id": *transaction.Payment_id})
+	}
+
+	var payment models.Payment
+	err := paymentCollection.FindOne(
+		ctx,
+		bson.M{
+			"$or":                linked,
+			"status":             bson.M{"$in": bson.A{PaymentPaid, PaymentRefunded}},
+			"refund_of":          nil,
+			"provider_reference": bson.M{"$nin": bson.A{nil, ""}},
+		},
+		options.FindOne().SetSort(bson.M{"created_at": -1}),
+	).Decode(&payment)
+	return payment, err
+}
+
+// ReserveRefund books a refund out of escrow inside sessCtx. The amount is in
+// the escrow currency; the buyer gets it back in the currency they paid, at the
+// transaction's frozen rate. Balance refunds
+// are final once the surrounding transaction commits. Card refunds also mark
+// the original payment as refunded up front, so the charge.refunded webhook
+// that follows sees nothing new to book; the returned PendingRefund must then
+// be settled with the provider.
+func ReserveRefund(sessCtx mongo.SessionContext, transaction models.Transaction, request RefundRequest) (models.Payment, *PendingRefund, error) {
+	var refundPayment models.Payment
+
+	held, err := EscrowHeld(sessCtx, transaction)
+	if err != nil {
+		return refundPayment, nil, err
+	}
+
+	amount := models.NewMoney(request.Amount.Amount, held.Currency)
+	if amount.Amount <= 0 || amount.Amount > held.Amount {
+		return refundPayment, nil, ErrRefundExceedsEscrow
+	}
+
+	original, err := capturedPayment(sessCtx, transaction)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return refundPayment, nil, err
+	}
+	hasCard := err == nil
+
+	destination := request.Destination
+	if destination == "" {
+		destination = RefundToBalance
+		if hasCard {
+			destination = RefundToCard
+		}
+	}
+
+	returned := ChargeAmount(transaction, amount)
+
+	refundable := MoneyOrZero(original.Amount).Sub(MoneyOrZero(original.Refunded_amount))
+	if destination == RefundToCard && (!hasCard || returned.Amount > refundable.Amount) {
+		return refundPayment, nil, ErrNoRefundablePayment
+	}
+
+	now := time.Now()
+	status, method := PaymentPaid, MethodBalanceRefund
+	if destination == RefundToCard {
+		status, method = PaymentPending, MethodCardRefund
+	}
+
+	refundPayment = models.Payment{
+		ID:             primitive.NewObjectID(),
+		User_id:        transaction.Customer_id,
+		Transaction_id: &transaction.Transaction_id,
+		Status:         &status,
+		Amount:         &returned,
+		Method:         &method,
+		Created_at:     now,
+		Updated_at:     now,
+	}
+	refundPayment.Payment_id = refundPayment.ID.Hex()
+	if hasCard {
+		refundPayment.Refund_of = &original.Payment_id
+	}
+
+	if _, err := paymentCollection.InsertOne(sessCtx, refundPayment); err != nil {
+		return refundPayment, nil, err
+	}
+
+	ref := LedgerRef{Transaction_id: &transaction.Transaction_id, Payment_id: &refundPayment.Payment_id, Created_by: &request.Source.Actor}
+	if request.Reason != "" {
+		ref.Note = &request.Reason
+	}
+
+	if destination == RefundToBalance {
+		err := PostLedger(sessCtx, EscrowEntries(*transaction.Customer_id, LedgerRefund, returned.Neg(), amount.Neg(), ref)...)
+		return refundPayment, nil, err
+	}
+
+	if err := addRefundedAmount(sessCtx, original, returned); err != nil {
+		return refundPayment, nil, err
+	}
+
+	err = PostLedger(sessCtx, EscrowEntries(AccountExternal, LedgerRefund, returned.Neg(), amount.Neg(), ref)...)
+	if err != nil {
+		return refundPayment, nil, err
+	}
+
+	return refundPayment, &PendingRefund{Refund: refundPayment, Original: original, Escrow_amount: amount, Reason: request.Reason, Source: request.Source}, nil
+}
+
+// SettleRefund sends a reserved card refund to the provider. If the provider
+// refuses, the booking is reversed so the money is back in escrow.
+func SettleRefund(ctx context.Context, refunder refund.Refunder, pending *PendingRefund) error {
+	if pending == nil {
+		return nil
+	}
+
+	result, err := refunder.Refund(ctx, refund.Request{
+		Provider_reference: *pending.Original.Provider_reference,
+		Amount:             *pending.Refund.Amount,
+		Idempotency_key:    pending.Refund.Payment_id,
+		Reason:             pending.Reason,
+	})
+	if err != nil {
+		if reverseErr := reverseRefund(ctx, pending, err); reverseErr != nil {
+			return fmt.Errorf("%v; reversing refund %s also failed: %v", err, pending.Refund.Payment_id, reverseErr)
+		}
+		return fmt.Errorf("%w: %v", ErrRefundFailed, err)
+	}
+
+	_, err = paymentCollection.UpdateOne(
+		ctx,
+		bson.M{"payment_id": pending.Refund.Payment_id},
+		bson.M{"$set": bson.M{
+			"status":             PaymentPaid,
+			"provider_reference": result.Reference,
+			"updated_at":         time.Now(),
+		}},
+	)
+	return err
+}
+
+// RefundTransaction books a refund out of escrow and audits entry with it,
+// adding the refund's payment_id to the details, then sends any card refund.
+func RefundTransaction(ctx context.Context, refunder refund.Refunder, transaction models.Transaction, request RefundRequest, entry AuditEntry) (models.Payment, error) {
+	var pending *PendingRefund
+	var refundPayment models.Payment
+
+	err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		var err error
+		refundPayment, pending, err = ReserveRefund(sessCtx, transaction, request)
+		if err != nil {
+			return err
+		}
+
+		if entry.Details == nil {
+			entry.Details = map[string]interface{}{}
+		}
+		entry.Details["payment_id"] = refundPayment.Payment_id
+		return AppendAudit(sessCtx, entry)
+	})
+	if err != nil {
+		return refundPayment, err
+	}
+
+	return refundPayment, SettleRefund(ctx, refunder, pending)
+}
+
+// CancelTransaction moves a transaction to canceled or rejected and returns
+// whatever escrow holds for it to the buyer. If the provider declines a card
+// refund the money goes back into escrow and the transaction keeps its old
+// status, so it can be cancelled again once the problem is fixed.
+func CancelTransaction(ctx context.Context, refunder refund.Refunder, transaction models.Transaction, update bson.M, request RefundRequest, entry AuditEntry) error {
+	var pending *PendingRefund
+
+	err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		result, err := transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": transaction.Status},
+			bson.M{"$set": update},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrStatusConflict
+		}
+		if err := AppendAudit(sessCtx, entry); err != nil {
+			return err
+		}
+
+		held, err := EscrowHeld(sessCtx, transaction)
+		if err != nil || held.IsZero() {
+			return err
+		}
+
+		request.Amount = held
+		_, pending, err = ReserveRefund(sessCtx, transaction, request)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = SettleRefund(ctx, refunder, pending)
+	if errors.Is(err, ErrRefundFailed) {
+		if restoreErr := restoreStatus(ctx, transaction, update["status"], entry.AuditSource); restoreErr != nil {
+			return fmt.Errorf("%w; restoring status of transaction %s also failed: %v", err, transaction.Transaction_id, restoreErr)
+		}
+	}
+	return err
+}
+
+// restoreStatus puts a transaction back to the status it had before a
+// cancellation whose refund was declined.
+func restoreStatus(ctx context.Context, transaction models.Transaction, canceled interface{}, source AuditSource) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		result, err := transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"transaction_id": transaction.Transaction_id, "status": canceled},
+			bson.M{"$set": bson.M{"status": transaction.Status, "updated_at": time.Now()}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			return err
+		}
+
+		changes := AuditDiff(bson.M{"status": canceled}, bson.M{"status": transaction.Status})
+		return AppendAudit(sessCtx, source.Entry("transaction.updated", "transaction", transaction.Transaction_id, changes, map[string]interface{}{
+			"reason": "refund declined",
+		}))
+	})
+}
+
+func addRefundedAmount(sessCtx mongo.SessionContext, original models.Payment, amount models.Money) error {
+	var current models.Payment
+	if err := paymentCollection.FindOne(sessCtx, bson.M{"payment_id": original.Payment_id}).Decode(&current); err != nil {
+		return err
+	}
+
+	total := MoneyOrZero(current.Amount)
+	refunded := models.NewMoney(0, total.Currency)
+	if current.Refunded_amount != nil {
+		refunded = *current.Refunded_amount
+	}
+	refunded = refunded.Add(amount)
+
+	status := PaymentPaid
+	if refunded.Amount >= total.Amount {
+		status = PaymentRefunded
+	}
+
+	_, err := paymentCollection.UpdateOne(
+		sessCtx,
+		bson.M{"payment_id": original.Payment_id},
+		bson.M{"$set": bson.M{
+			"refunded_amount": refunded,
+			"status":          status,
+			"updated_at":      time.Now(),
+		}},
+	)
+	return err
+}
+
+func reverseRefund(ctx context.Context, pending *PendingRefund, cause error) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		result, err := paymentCollection.UpdateOne(
+			sessCtx,
+			bson.M{"payment_id": pending.Refund.Payment_id, "status": PaymentPending},
+			bson.M{"$set": bson.M{"status": PaymentCanceled, "updated_at": time.Now()}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			return err
+		}
+
+		amount := *pending.Refund.Amount
+		if err := addRefundedAmount(sessCtx, pending.Original, amount.Neg()); err != nil {
+			return err
+		}
+
+		note := "refund declined by the payment provider"
+		ref := LedgerRef{Transaction_id: pending.Refund.Transaction_id, Payment_id: &pending.Refund.Payment_id, Note: &note}
+		if err := PostLedger(sessCtx, EscrowEntries(AccountExternal, LedgerRefund, amount, pending.Escrow_amount, ref)...); err != nil {
+			return err
+		}
+
+		return WriteAudit(sessCtx, "refund.declined", pending.Source, "payment", pending.Refund.Payment_id, map[string]interface{}{
+			"transaction_id": pending.Refund.Transaction_id,
+			"error":          cause.Error(),
+		})
+	})
+}
@@ -0,0 +1,185 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"user-athentication-golang/models"
+	"user-athentication-golang/refund"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRefundTransactionToCard(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, payment := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	refunder := refund.NewFake()
+
+	refundPayment, err := RefundTransaction(ctx, refunder, transaction, RefundRequest{
+		Amount:      models.NewMoney(4000, "THB"),
+		Destination: RefundToCard,
+		Reason:      "item damaged",
+	}, testSource.Entry("transaction.refunded", "transaction", transaction.Transaction_id, nil, nil))
+	if err != nil {
+		t.Fatalf("RefundTransaction: %v", err)
+	}
+
+	if len(refunder.Requests) != 1 {
+		t.Fatalf("provider got %d refunds, want 1", len(refunder.Requests))
+	}
+	sent := refunder.Requests[0]
+	if sent.Provider_reference != *payment.Provider_reference || sent.Amount != models.NewMoney(4000, "THB") || sent.Idempotency_key != refundPayment.Payment_id {
+		t.Errorf("provider got %+v", sent)
+	}
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 6000 {
+		t.Errorf("escrow holds %d, want 6000", held.Amount)
+	}
+
+	var settled models.Payment
+	if err := paymentCollection.FindOne(ctx, bson.M{"payment_id": refundPayment.Payment_id}).Decode(&settled); err != nil {
+		t.Fatalf("reading refund: %v", err)
+	}
+	if *settled.Status != PaymentPaid || settled.Provider_reference == nil || *settled.Provider_reference != "re_fake_1" {
+		t.Errorf("refund is status %d with reference %v, want paid with re_fake_1", *settled.Status, settled.Provider_reference)
+	}
+
+	record := auditRecord(t, ctx, "transaction.refunded", transaction.Transaction_id)
+	if record.Details["payment_id"] != refundPayment.Payment_id || record.Ip_address != testSource.Ip_address || record.Request_id != testSource.Request_id {
+		t.Errorf("refund audited as %+v", record)
+	}
+}
+
+func TestRefundTransactionDeclined(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, payment := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	refunder := refund.NewFake()
+	refunder.Err = errors.New("card_declined")
+
+	refundPayment, err := RefundTransaction(ctx, refunder, transaction, RefundRequest{
+		Amount:      models.NewMoney(10000, "THB"),
+		Destination: RefundToCard,
+	}, testSource.Entry("transaction.refunded", "transaction", transaction.Transaction_id, nil, nil))
+	if !errors.Is(err, ErrRefundFailed) {
+		t.Fatalf("RefundTransaction returned %v, want ErrRefundFailed", err)
+	}
+
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 10000 {
+		t.Errorf("escrow holds %d after a declined refund, want 10000", held.Amount)
+	}
+
+	var canceled, original models.Payment
+	if err := paymentCollection.FindOne(ctx, bson.M{"payment_id": refundPayment.Payment_id}).Decode(&canceled); err != nil {
+		t.Fatalf("reading refund: %v", err)
+	}
+	if *canceled.Status != PaymentCanceled {
+		t.Errorf("declined refund is status %d, want canceled", *canceled.Status)
+	}
+	if err := paymentCollection.FindOne(ctx, bson.M{"payment_id": payment.Payment_id}).Decode(&original); err != nil {
+		t.Fatalf("reading payment: %v", err)
+	}
+	if *original.Status != PaymentPaid || MoneyOrZero(original.Refunded_amount).Amount != 0 {
+		t.Errorf("original payment is status %d with %v refunded, want paid with nothing refunded", *original.Status, original.Refunded_amount)
+	}
+
+	if record := auditRecord(t, ctx, "refund.declined", refundPayment.Payment_id); record.Actor != testSource.Actor {
+		t.Errorf("declined refund audited by %q, want %q", record.Actor, testSource.Actor)
+	}
+}
+
+func TestRefundTransactionToBalance(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, _ := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	refunder := refund.NewFake()
+
+	_, err := RefundTransaction(ctx, refunder, transaction, RefundRequest{
+		Amount:      models.NewMoney(2500, "THB"),
+		Destination: RefundToBalance,
+	}, testSource.Entry("transaction.refunded", "transaction", transaction.Transaction_id, nil, nil))
+	if err != nil {
+		t.Fatalf("RefundTransaction: %v", err)
+	}
+
+	if len(refunder.Requests) != 0 {
+		t.Errorf("balance refund reached the provider: %+v", refunder.Requests)
+	}
+	var buyer models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": *transaction.Customer_id}).Decode(&buyer); err != nil {
+		t.Fatalf("reading buyer: %v", err)
+	}
+	if wallet := buyer.Wallets["THB"]; wallet.Amount != 2500 {
+		t.Errorf("buyer wallet holds %d, want 2500", wallet.Amount)
+	}
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 7500 {
+		t.Errorf("escrow holds %d, want 7500", held.Amount)
+	}
+}
+
+func TestRefundTransactionMoreThanEscrow(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, _ := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	refunder := refund.NewFake()
+
+	_, err := RefundTransaction(ctx, refunder, transaction, RefundRequest{
+		Amount:      models.NewMoney(10001, "THB"),
+		Destination: RefundToCard,
+	}, testSource.Entry("transaction.refunded", "transaction", transaction.Transaction_id, nil, nil))
+	if !errors.Is(err, ErrRefundExceedsEscrow) {
+		t.Fatalf("RefundTransaction returned %v, want ErrRefundExceedsEscrow", err)
+	}
+	if len(refunder.Requests) != 0 {
+		t.Errorf("provider got %d refunds, want none", len(refunder.Requests))
+	}
+}
+
+func TestCancelTransactionRefundsEscrow(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, _ := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	refunder := refund.NewFake()
+
+	err := CancelTransaction(ctx, refunder, transaction, bson.M{"status": TransactionCanceled}, RefundRequest{Source: testSource}, testSource.Entry("transaction.updated", "transaction", transaction.Transaction_id, nil, nil))
+	if err != nil {
+		t.Fatalf("CancelTransaction: %v", err)
+	}
+
+	if status := transactionStatus(t, ctx, transaction.Transaction_id); status != TransactionCanceled {
+		t.Errorf("transaction is status %d, want canceled", status)
+	}
+	if len(refunder.Requests) != 1 || refunder.Requests[0].Amount != models.NewMoney(10000, "THB") {
+		t.Errorf("provider got %+v, want one refund of the whole payment", refunder.Requests)
+	}
+	if held := escrowHeld(t, ctx, transaction); !held.IsZero() {
+		t.Errorf("escrow still holds %d", held.Amount)
+	}
+}
+
+func TestCancelTransactionDeclinedKeepsStatus(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, _ := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	refunder := refund.NewFake()
+	refunder.Err = errors.New("card_declined")
+
+	err := CancelTransaction(ctx, refunder, transaction, bson.M{"status": TransactionCanceled}, RefundRequest{Source: testSource}, testSource.Entry("transaction.updated", "transaction", transaction.Transaction_id, nil, nil))
+	if !errors.Is(err, ErrRefundFailed) {
+		t.Fatalf("CancelTransaction returned %v, want ErrRefundFailed", err)
+	}
+
+	if status := transactionStatus(t, ctx, transaction.Transaction_id); status != TransactionProcessing {
+		t.Errorf("transaction is status %d after a declined refund, want processing", status)
+	}
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 10000 {
+		t.Errorf("escrow holds %d after a declined refund, want 10000", held.Amount)
+	}
+	if record := auditRecord(t, ctx, "transaction.updated", transaction.Transaction_id); fmt.Sprint(record.Changes["status"].To) != fmt.Sprint(TransactionProcessing) {
+		t.Errorf("restoring the status audited as %+v", record.Changes)
+	}
+
+	// Once the provider recovers the same transaction can be cancelled again.
+	refunder.Err = nil
+	if err := CancelTransaction(ctx, refunder, transaction, bson.M{"status": TransactionCanceled}, RefundRequest{Source: testSource}, testSource.Entry("transaction.updated", "transaction", transaction.Transaction_id, nil, nil)); err != nil {
+		t.Fatalf("retrying CancelTransaction: %v", err)
+	}
+	if status := transactionStatus(t, ctx, transaction.Transaction_id); status != TransactionCanceled {
+		t.Errorf("transaction is status %d after the retry, want canceled", status)
+	}
+}
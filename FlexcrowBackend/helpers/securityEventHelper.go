@@ -0,0 +1,31 @@
+package helper
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var securityEventCollection *mongo.Collection = database.OpenCollection(database.Client, "security_event")
+
+const (
+	SecurityLoginFailed     = "login_failed"
+	SecurityLoginLocked     = "login_locked"
+	SecurityAccountUnlocked = "account_unlocked"
+)
+
+func RecordSecurityEvent(ctx context.Context, event models.SecurityEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.Security_event_id = event.ID.Hex()
+	event.Email = strings.ToLower(strings.TrimSpace(event.Email))
+	event.Created_at = time.Now()
+
+	_, err := securityEventCollection.InsertOne(ctx, event)
+	return err
+}
@@ -0,0 +1,276 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "session")
+
+const (
+	UserActive   = 1
+	UserDisabled = 2
+)
+
+const (
+	SessionRevokedReuse          = "refresh_token_reused"
+	SessionRevokedLogout         = "logout"
+	SessionRevokedByUser         = "revoked_by_user"
+	SessionRevokedPasswordChange = "password_changed"
+	SessionRevokedUserDisabled   = "user_disabled"
+)
+
+// lastSeenInterval limits how often a request refreshes last_seen_at, so
+// authenticating does not write to the session on every call.
+const lastSeenInterval = time.Minute
+
+var ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+var ErrRefreshTokenReused = errors.New("refresh token was already used; the session has been revoked")
+var ErrSessionRevoked = errors.New("session has been revoked")
+var ErrSessionNotFound = errors.New("session not found")
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenId(signedToken string) string {
+	claims, msg := parseToken(signedToken)
+	if msg != "" {
+		return ""
+	}
+	return claims.Id
+}
+
+// StartSession opens a new session for user and issues its first pair of
+// tokens. The tokens are also stored on the user as before.
+func StartSession(ctx context.Context, user models.User, userAgent string, ipAddress string) (token string, refreshToken string, err error) {
+	now := time.Now()
+	session := models.Session{
+		ID:           primitive.NewObjectID(),
+		User_id:      user.User_id,
+		User_agent:   userAgent,
+		Ip_address:   ipAddress,
+		Last_seen_at: now,
+		Expires_at:   now.Add(RefreshTokenLifetime),
+		Created_at:   now,
+		Updated_at:   now,
+	}
+	session.Session_id = session.ID.Hex()
+
+	token, refreshToken, err = GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, session.Session_id)
+	if err != nil {
+		return "", "", err
+	}
+	session.Token_id = tokenId(token)
+	session.Refresh_token_hash = hashToken(refreshToken)
+	session.Used_token_hashes = []string{}
+
+	if _, err := sessionCollection.InsertOne(ctx, session); err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// RotateRefreshToken exchanges the current refresh token of a session for a
+// new pair. Presenting a token the session has already rotated past means it
+// leaked, so the whole session is revoked and every token from it dies.
+func RotateRefreshToken(ctx context.Context, signedRefreshToken string) (token string, refreshToken string, err error) {
+	claims, msg := ValidateRefreshToken(signedRefreshToken)
+	if msg != "" {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", "", ErrInvalidRefreshToken
+		}
+		return "", "", err
+	}
+	if user.Status != nil && *user.Status == UserDisabled {
+		return "", "", ErrSessionRevoked
+	}
+
+	token, refreshToken, err = GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, claims.Session_id)
+	if err != nil {
+		return "", "", err
+	}
+
+	presented := hashToken(signedRefreshToken)
+	now := time.Now()
+
+	result, err := sessionCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"session_id":         claims.Session_id,
+			"user_id":            user.User_id,
+			"refresh_token_hash": presented,
+			"revoked_at":         nil,
+		},
+		bson.M{
+			"$set": bson.M{
+				"token_id":           tokenId(token),
+				"refresh_token_hash": hashToken(refreshToken),
+				"last_seen_at":       now,
+				"expires_at":         now.Add(RefreshTokenLifetime),
+				"updated_at":         now,
+			},
+			"$push": bson.M{"used_token_hashes": presented},
+		},
+	)
+	if err != nil {
+		return "", "", err
+	}
+	if result.MatchedCount == 0 {
+		return "", "", refreshFailure(ctx, claims, presented)
+	}
+	return token, refreshToken, nil
+}
+
+// refreshFailure works out why a refresh token matched no live session and
+// revokes the session when the token is one it has already rotated past.
+func refreshFailure(ctx context.Context, claims *SignedDetails, presented string) error {
+	var session models.Session
+	err := sessionCollection.FindOne(ctx, bson.M{"session_id": claims.Session_id, "user_id": claims.Uid}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.Revoked_at != nil {
+		return ErrSessionRevoked
+	}
+
+	for _, used := range session.Used_token_hashes {
+		if used != presented {
+			continue
+		}
+		err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if err := RevokeSession(sessCtx, session.Session_id, SessionRevokedReuse); err != nil {
+				return err
+			}
+			return WriteAudit(sessCtx, "session.refresh_token_reused", AuditSource{Actor: claims.Uid}, "session", session.Session_id, map[string]interface{}{
+				"user_id": claims.Uid,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+
+	return ErrInvalidRefreshToken
+}
+
+func RevokeSession(ctx context.Context, sessionId string, reason string) error {
+	now := time.Now()
+	_, err := sessionCollection.UpdateOne(
+		ctx,
+		bson.M{"session_id": sessionId, "revoked_at": nil},
+		bson.M{"$set": bson.M{
+			"revoked_at":     now,
+			"revoked_reason": reason,
+			"updated_at":     now,
+		}},
+	)
+	return err
+}
+
+// ValidateSession checks that an access token still belongs to a live session
+// and is the latest token issued for it.
+func ValidateSession(ctx context.Context, claims *SignedDetails) error {
+	now := time.Now()
+
+	var session models.Session
+	err := sessionCollection.FindOne(ctx, bson.M{
+		"session_id": claims.Session_id,
+		"user_id":    claims.Uid,
+	}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.Revoked_at != nil || session.Expires_at.Before(now) || session.Token_id != claims.Id {
+		return ErrSessionRevoked
+	}
+
+	if now.Sub(session.Last_seen_at) > lastSeenInterval {
+		_, err = sessionCollection.UpdateOne(
+			ctx,
+			bson.M{"session_id": session.Session_id},
+			bson.M{"$set": bson.M{"last_seen_at": now}},
+		)
+	}
+	return err
+}
+
+// UserSessions lists the sessions of a user that can still be used.
+func UserSessions(ctx context.Context, userId string) ([]models.Session, error) {
+	sessions := []models.Session{}
+
+	cursor, err := sessionCollection.Find(
+		ctx,
+		bson.M{"user_id": userId, "revoked_at": nil, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.M{"last_seen_at": -1}),
+	)
+	if err != nil {
+		return sessions, err
+	}
+	err = cursor.All(ctx, &sessions)
+	return sessions, err
+}
+
+// RevokeUserSession revokes one session, provided it belongs to userId.
+func RevokeUserSession(ctx context.Context, userId string, sessionId string, reason string) error {
+	count, err := sessionCollection.CountDocuments(ctx, bson.M{"session_id": sessionId, "user_id": userId})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+	return RevokeSession(ctx, sessionId, reason)
+}
+
+// RevokeUserSessions revokes every live session of a user and clears the
+// tokens stored on the user, returning how many sessions were revoked.
+func RevokeUserSessions(ctx context.Context, userId string, reason string) (int64, error) {
+	now := time.Now()
+
+	result, err := sessionCollection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{
+			"revoked_at":     now,
+			"revoked_reason": reason,
+			"updated_at":     now,
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.M{"$set": bson.M{"token": nil, "refresh_token": nil}},
+	)
+	return result.ModifiedCount, err
+}
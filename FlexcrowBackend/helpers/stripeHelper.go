@@ -0,0 +1,332 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+	"user-athentication-golang/refund"
+
+	"github.com/stripe/stripe-go/v72"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var paymentCollection *mongo.Collection = database.OpenCollection(database.Client, "payment")
+var stripeEventCollection *mongo.Collection = database.OpenCollection(database.Client, "stripe_event")
+
+const (
+	PaymentPending  = 1
+	PaymentPaid     = 2
+	PaymentCanceled = 3
+	PaymentRefunded = 4
+)
+
+var ErrEventProcessed = errors.New("stripe event already processed")
+var ErrPaymentNotFound = errors.New("payment referenced by stripe event not found")
+var ErrPaymentMismatch = errors.New("stripe charged a different amount or currency than the payment")
+
+// HandleStripeEvent books a Stripe webhook event. A checkout completed for a
+// transaction that no longer takes payment is refunded through refunder.
+func HandleStripeEvent(ctx context.Context, refunder refund.Refunder, event stripe.Event) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		record := models.StripeEvent{
+			ID:         event.ID,
+			Type:       event.Type,
+			Created_at: time.Now(),
+		}
+
+		var paymentId string
+		var err error
+
+		switch event.Type {
+		case "checkout.session.completed":
+			paymentId, err = confirmCheckoutPayment(sessCtx, refunder, event)
+		case "checkout.session.expired":
+			paymentId, err = expireCheckoutPayment(sessCtx, event)
+		case "charge.refunded":
+			paymentId, err = refundChargePayment(sessCtx, event)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if paymentId != "" {
+			record.Payment_id = &paymentId
+		}
+
+		// The event ID is the idempotency key: a redelivered event fails here and
+		// rolls back whatever the handler above changed.
+		if _, err := stripeEventCollection.InsertOne(sessCtx, record); err != nil {
+			if IsDuplicateKeyError(err) {
+				return ErrEventProcessed
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+func confirmCheckoutPayment(sessCtx mongo.SessionContext, refunder refund.Refunder, event stripe.Event) (string, error) {
+	var checkoutSession stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &checkoutSession); err != nil {
+		return "", err
+	}
+
+	// Delayed payment methods complete the session before the money arrives.
+	if checkoutSession.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		return checkoutSession.ClientReferenceID, nil
+	}
+
+	var payment models.Payment
+	err := paymentCollection.FindOne(sessCtx, bson.M{"payment_id": checkoutSession.ClientReferenceID}).Decode(&payment)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrPaymentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !checkoutMatchesPayment(checkoutSession, payment) {
+		return "", ErrPaymentMismatch
+	}
+
+	var reference string
+	if checkoutSession.PaymentIntent != nil {
+		reference = checkoutSession.PaymentIntent.ID
+	}
+	update := bson.M{
+		"status":     PaymentPaid,
+		"updated_at": time.Now(),
+	}
+	if reference != "" {
+		update["provider_reference"] = reference
+	}
+
+	result, err := paymentCollection.UpdateOne(
+		sessCtx,
+		bson.M{"payment_id": payment.Payment_id, "status": PaymentPending},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return "", err
+	}
+	if result.MatchedCount == 0 {
+		if payment.Status != nil && *payment.Status == PaymentPaid {
+			return payment.Payment_id, nil
+		}
+		// The payment was canceled, e.g. when its transaction expired, but
+		// the buyer finished checkout anyway.
+		return payment.Payment_id, refundOrphanedPayment(sessCtx, refunder, payment, reference)
+	}
+
+	linked, err := linkPayment(sessCtx, payment)
+	if err != nil {
+		return "", err
+	}
+	if !linked {
+		// The buyer paid twice or the transaction was closed; escrow only
+		// ever holds the payment an open transaction points at.
+		return payment.Payment_id, refundOrphanedPayment(sessCtx, refunder, payment, reference)
+	}
+
+	if payment.Amount != nil {
+		transaction, err := paymentTransaction(sessCtx, payment)
+		if err != nil {
+			return "", err
+		}
+
+		ref := LedgerRef{Transaction_id: payment.Transaction_id, Payment_id: &payment.Payment_id}
+		err = PostLedger(sessCtx, EscrowEntries(AccountExternal, LedgerEscrowHold, *payment.Amount, ListingAmount(transaction, *payment.Amount), ref)...)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return payment.Payment_id, nil
+}
+
+// checkoutMatchesPayment reports whether Stripe charged exactly the payment's
+// amount. Stripe amounts are in the minor unit, like Money, with lowercase
+// currency codes.
+func checkoutMatchesPayment(checkoutSession stripe.CheckoutSession, payment models.Payment) bool {
+	if payment.Amount == nil {
+		return false
+	}
+	return checkoutSession.AmountTotal == payment.Amount.Amount &&
+		strings.EqualFold(string(checkoutSession.Currency), payment.Amount.Currency)
+}
+
+// refundOrphanedPayment gives back a checkout charge that escrow does not
+// hold. If the refund fails the payment stays paid and is flagged in the
+// audit log for an admin to refund by hand.
+func refundOrphanedPayment(sessCtx mongo.SessionContext, refunder refund.Refunder, payment models.Payment, reference string) error {
+	update := bson.M{"updated_at": time.Now()}
+	details := map[string]interface{}{"transaction_id": payment.Transaction_id}
+	action := "payment.orphan_refunded"
+
+	_, err := refunder.Refund(sessCtx, refund.Request{
+		Provider_reference: reference,
+		Amount:             MoneyOrZero(payment.Amount),
+		Idempotency_key:    "orphan-" + payment.Payment_id,
+		Reason:             "transaction no longer accepts payment",
+	})
+	if err != nil {
+		log.Printf("payment %s was charged but escrow does not hold it, and the refund failed: %v; it must be refunded by hand", payment.Payment_id, err)
+		action = "payment.orphaned"
+		details["refund_error"] = err.Error()
+		update["status"] = PaymentPaid
+	} else {
+		// Booking the refund here keeps charge.refunded from taking it out
+		// of escrow, which never held it.
+		update["status"] = PaymentRefunded
+		update["refunded_amount"] = MoneyOrZero(payment.Amount)
+	}
+	if reference != "" {
+		update["provider_reference"] = reference
+	}
+
+	_, err = paymentCollection.UpdateOne(sessCtx, bson.M{"payment_id": payment.Payment_id}, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	return WriteAudit(sessCtx, action, AuditStripe, "payment", payment.Payment_id, details)
+}
+
+// linkPayment attaches a confirmed payment to its transaction. It reports
+// false when the transaction is no longer pending or processing or already
+// has a different payment.
+func linkPayment(sessCtx mongo.SessionContext, payment models.Payment) (bool, error) {
+	if payment.Transaction_id == nil || *payment.Transaction_id == "" {
+		return true, nil
+	}
+
+	result, err := transactionCollection.UpdateOne(
+		sessCtx,
+		bson.M{
+			"transaction_id": *payment.Transaction_id,
+			"status":         bson.M{"$in": bson.A{TransactionPending, TransactionProcessing}},
+			"payment_id":     bson.M{"$in": bson.A{nil, "", payment.Payment_id}},
+		},
+		bson.M{"$set": bson.M{
+			"payment_id": payment.Payment_id,
+			"updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func expireCheckoutPayment(sessCtx mongo.SessionContext, event stripe.Event) (string, error) {
+	var checkoutSession stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &checkoutSession); err != nil {
+		return "", err
+	}
+
+	_, err := paymentCollection.UpdateOne(
+		sessCtx,
+		bson.M{"payment_id": checkoutSession.ClientReferenceID, "status": PaymentPending},
+		bson.M{"$set": bson.M{
+			"status":     PaymentCanceled,
+			"updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return checkoutSession.ClientReferenceID, nil
+}
+
+func refundChargePayment(sessCtx mongo.SessionContext, event stripe.Event) (string, error) {
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		return "", err
+	}
+
+	if charge.PaymentIntent == nil {
+		return "", nil
+	}
+
+	var payment models.Payment
+	err := paymentCollection.FindOne(sessCtx, bson.M{"provider_reference": charge.PaymentIntent.ID}).Decode(&payment)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrPaymentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	previouslyRefunded := models.NewMoney(0, MoneyOrZero(payment.Amount).Currency)
+	if payment.Refunded_amount != nil {
+		previouslyRefunded = *payment.Refunded_amount
+	}
+
+	// Stripe reports amounts in the smallest currency unit, same as Money.
+	refunded := models.NewMoney(charge.AmountRefunded, previouslyRefunded.Currency)
+	delta := refunded.Sub(previouslyRefunded)
+	if delta.Amount <= 0 {
+		return payment.Payment_id, nil
+	}
+
+	update := bson.M{
+		"refunded_amount": refunded,
+		"updated_at":      time.Now(),
+	}
+	if charge.Refunded {
+		update["status"] = PaymentRefunded
+	}
+
+	_, err = paymentCollection.UpdateOne(
+		sessCtx,
+		bson.M{"payment_id": payment.Payment_id},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	transaction, err := paymentTransaction(sessCtx, payment)
+	if err != nil {
+		return "", err
+	}
+	if transaction.Transaction_id != "" && (transaction.Payment_id == nil || *transaction.Payment_id != payment.Payment_id) {
+		// An orphaned charge refunded by hand never reached escrow.
+		return payment.Payment_id, nil
+	}
+
+	ref := LedgerRef{Transaction_id: payment.Transaction_id, Payment_id: &payment.Payment_id}
+	err = PostLedger(sessCtx, EscrowEntries(AccountExternal, LedgerRefund, delta.Neg(), ListingAmount(transaction, delta).Neg(), ref)...)
+	if err != nil {
+		return "", err
+	}
+
+	return payment.Payment_id, nil
+}
+
+// paymentTransaction loads the transaction a payment is for, or returns an
+// empty one whose currencies follow the payment when there is none.
+func paymentTransaction(sessCtx mongo.SessionContext, payment models.Payment) (models.Transaction, error) {
+	currency := MoneyOrZero(payment.Amount).Currency
+	unlinked := models.Transaction{Currency: &currency}
+	if payment.Transaction_id == nil || *payment.Transaction_id == "" {
+		return unlinked, nil
+	}
+
+	var transaction models.Transaction
+	err := transactionCollection.FindOne(sessCtx, bson.M{"transaction_id": *payment.Transaction_id}).Decode(&transaction)
+	if err == mongo.ErrNoDocuments {
+		return unlinked, nil
+	}
+	return transaction, err
+}
@@ -0,0 +1,275 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"user-athentication-golang/checkout"
+	"user-athentication-golang/models"
+	"user-athentication-golang/refund"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// signedEvent signs payload the way Stripe does and parses it back through
+// the same check the webhook endpoint uses.
+func signedEvent(t *testing.T, payload []byte) stripe.Event {
+	t.Helper()
+
+	now := time.Now()
+	header := fmt.Sprintf("t=%d,v1=%x", now.Unix(), webhook.ComputeSignature(now, payload, testWebhookSecret))
+	event, err := webhook.ConstructEvent(payload, header, testWebhookSecret)
+	if err != nil {
+		t.Fatalf("constructing event: %v", err)
+	}
+	return event
+}
+
+func checkoutCompleted(t *testing.T, paymentId string, amount models.Money) stripe.Event {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":     "evt_" + primitive.NewObjectID().Hex(),
+		"object": "event",
+		"type":   "checkout.session.completed",
+		"data": map[string]interface{}{
+			"object": map[string]interface{}{
+				"id":                  "cs_" + paymentId,
+				"object":              "checkout.session",
+				"client_reference_id": paymentId,
+				"payment_status":      "paid",
+				"amount_total":        amount.Amount,
+				"currency":            "thb",
+				"payment_intent":      "pi_" + paymentId,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("encoding event: %v", err)
+	}
+	return signedEvent(t, payload)
+}
+
+func paymentStatus(t *testing.T, ctx context.Context, paymentId string) int {
+	t.Helper()
+
+	var payment models.Payment
+	if err := paymentCollection.FindOne(ctx, bson.M{"payment_id": paymentId}).Decode(&payment); err != nil {
+		t.Fatalf("reading payment: %v", err)
+	}
+	return *payment.Status
+}
+
+func TestCheckoutMatchesPayment(t *testing.T) {
+	amount := models.NewMoney(12345, "THB")
+	payment := models.Payment{Amount: &amount}
+
+	tests := []struct {
+		name     string
+		session  stripe.CheckoutSession
+		payment  models.Payment
+		expected bool
+	}{
+		{"same amount and currency", stripe.CheckoutSession{AmountTotal: 12345, Currency: "thb"}, payment, true},
+		{"currency case ignored", stripe.CheckoutSession{AmountTotal: 12345, Currency: "THB"}, payment, true},
+		{"less charged", stripe.CheckoutSession{AmountTotal: 12344, Currency: "thb"}, payment, false},
+		{"more charged", stripe.CheckoutSession{AmountTotal: 12346, Currency: "thb"}, payment, false},
+		{"other currency", stripe.CheckoutSession{AmountTotal: 12345, Currency: "usd"}, payment, false},
+		{"payment without amount", stripe.CheckoutSession{AmountTotal: 12345, Currency: "thb"}, models.Payment{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkoutMatchesPayment(test.session, test.payment); got != test.expected {
+				t.Errorf("checkoutMatchesPayment = %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestCheckoutCompletedHoldsPaymentInEscrow(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction := seedTransaction(t, ctx, models.NewMoney(10000, "THB"), TransactionPending)
+	payment := seedCardPayment(t, ctx, transaction, PaymentPending)
+
+	event := checkoutCompleted(t, payment.Payment_id, *payment.Amount)
+	if err := HandleStripeEvent(ctx, refund.NewFake(), event); err != nil {
+		t.Fatalf("HandleStripeEvent: %v", err)
+	}
+
+	if status := paymentStatus(t, ctx, payment.Payment_id); status != PaymentPaid {
+		t.Errorf("payment is status %d, want paid", status)
+	}
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 10000 {
+		t.Errorf("escrow holds %d, want 10000", held.Amount)
+	}
+
+	var linked models.Transaction
+	if err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": transaction.Transaction_id}).Decode(&linked); err != nil {
+		t.Fatalf("reading transaction: %v", err)
+	}
+	if linked.Payment_id == nil || *linked.Payment_id != payment.Payment_id {
+		t.Errorf("transaction points at payment %v, want %s", linked.Payment_id, payment.Payment_id)
+	}
+
+	// Stripe redelivers events; the second copy must not book anything.
+	if err := HandleStripeEvent(ctx, refund.NewFake(), event); err != ErrEventProcessed {
+		t.Fatalf("redelivered event returned %v, want ErrEventProcessed", err)
+	}
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 10000 {
+		t.Errorf("escrow holds %d after redelivery, want 10000", held.Amount)
+	}
+}
+
+func TestCheckoutCompletedWithWrongAmount(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction := seedTransaction(t, ctx, models.NewMoney(10000, "THB"), TransactionPending)
+	payment := seedCardPayment(t, ctx, transaction, PaymentPending)
+
+	event := checkoutCompleted(t, payment.Payment_id, models.NewMoney(100, "THB"))
+	if err := HandleStripeEvent(ctx, refund.NewFake(), event); !errors.Is(err, ErrPaymentMismatch) {
+		t.Fatalf("HandleStripeEvent returned %v, want ErrPaymentMismatch", err)
+	}
+
+	if status := paymentStatus(t, ctx, payment.Payment_id); status != PaymentPending {
+		t.Errorf("payment is status %d, want pending", status)
+	}
+	if held := escrowHeld(t, ctx, transaction); !held.IsZero() {
+		t.Errorf("escrow holds %d, want nothing", held.Amount)
+	}
+}
+
+func TestCheckoutCompletedForOrphanedPayment(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction, first := seedPaidTransaction(t, ctx, models.NewMoney(10000, "THB"))
+	second := seedCardPayment(t, ctx, transaction, PaymentPending)
+
+	refunder := refund.NewFake()
+	event := checkoutCompleted(t, second.Payment_id, *second.Amount)
+	if err := HandleStripeEvent(ctx, refunder, event); err != nil {
+		t.Fatalf("HandleStripeEvent: %v", err)
+	}
+
+	if len(refunder.Requests) != 1 || refunder.Requests[0].Provider_reference != "pi_"+second.Payment_id {
+		t.Errorf("provider got %+v, want the second charge refunded", refunder.Requests)
+	}
+	if status := paymentStatus(t, ctx, second.Payment_id); status != PaymentRefunded {
+		t.Errorf("second payment is status %d, want refunded", status)
+	}
+
+	if held := escrowHeld(t, ctx, transaction); held.Amount != 10000 {
+		t.Errorf("escrow holds %d, want only the first payment's 10000", held.Amount)
+	}
+
+	var linked models.Transaction
+	if err := transactionCollection.FindOne(ctx, bson.M{"transaction_id": transaction.Transaction_id}).Decode(&linked); err != nil {
+		t.Fatalf("reading transaction: %v", err)
+	}
+	if linked.Payment_id == nil || *linked.Payment_id != first.Payment_id {
+		t.Errorf("transaction points at payment %v, want %s", linked.Payment_id, first.Payment_id)
+	}
+}
+
+// seedCheckoutPayment records a pending card payment with an open checkout
+// session for the whole transaction.
+func seedCheckoutPayment(t *testing.T, ctx context.Context, transaction models.Transaction) models.Payment {
+	t.Helper()
+
+	payment := seedCardPayment(t, ctx, transaction, PaymentPending)
+	sessionId := "cs_" + payment.Payment_id
+	_, err := paymentCollection.UpdateOne(ctx, bson.M{"payment_id": payment.Payment_id}, bson.M{"$set": bson.M{"checkout_session": sessionId}})
+	if err != nil {
+		t.Fatalf("recording checkout session: %v", err)
+	}
+	payment.Checkout_session = &sessionId
+	return payment
+}
+
+func TestCheckoutCompletedAfterExpiryIsRefunded(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction := seedTransaction(t, ctx, models.NewMoney(10000, "THB"), TransactionPending)
+	payment := seedCheckoutPayment(t, ctx, transaction)
+
+	expirer := checkout.NewFake()
+	if err := ExpireTransaction(ctx, expirer, transaction, map[string]interface{}{}); err != nil {
+		t.Fatalf("ExpireTransaction: %v", err)
+	}
+	if len(expirer.Expired) != 1 || expirer.Expired[0] != *payment.Checkout_session {
+		t.Errorf("expired sessions %v, want %s", expirer.Expired, *payment.Checkout_session)
+	}
+
+	// A buyer already on the checkout page can still finish before Stripe
+	// closes it.
+	refunder := refund.NewFake()
+	if err := HandleStripeEvent(ctx, refunder, checkoutCompleted(t, payment.Payment_id, *payment.Amount)); err != nil {
+		t.Fatalf("HandleStripeEvent: %v", err)
+	}
+
+	if len(refunder.Requests) != 1 || refunder.Requests[0].Amount != *payment.Amount {
+		t.Errorf("provider got %+v, want the whole charge refunded", refunder.Requests)
+	}
+	if status := paymentStatus(t, ctx, payment.Payment_id); status != PaymentRefunded {
+		t.Errorf("payment is status %d, want refunded", status)
+	}
+	if status := transactionStatus(t, ctx, transaction.Transaction_id); status != TransactionCanceled {
+		t.Errorf("transaction is status %d, want it to stay canceled", status)
+	}
+	if held := escrowHeld(t, ctx, transaction); !held.IsZero() {
+		t.Errorf("escrow holds %d, want nothing", held.Amount)
+	}
+	auditRecord(t, ctx, "payment.orphan_refunded", payment.Payment_id)
+}
+
+func TestCheckoutCompletedAfterExpiryFlagsFailedRefund(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction := seedTransaction(t, ctx, models.NewMoney(10000, "THB"), TransactionPending)
+	payment := seedCheckoutPayment(t, ctx, transaction)
+	if err := ExpireTransaction(ctx, checkout.NewFake(), transaction, map[string]interface{}{}); err != nil {
+		t.Fatalf("ExpireTransaction: %v", err)
+	}
+
+	refunder := refund.NewFake()
+	refunder.Err = errors.New("api_connection_error")
+	if err := HandleStripeEvent(ctx, refunder, checkoutCompleted(t, payment.Payment_id, *payment.Amount)); err != nil {
+		t.Fatalf("HandleStripeEvent: %v", err)
+	}
+
+	if status := paymentStatus(t, ctx, payment.Payment_id); status != PaymentPaid {
+		t.Errorf("payment is status %d, want paid until an admin refunds it", status)
+	}
+	if held := escrowHeld(t, ctx, transaction); !held.IsZero() {
+		t.Errorf("escrow holds %d, want nothing", held.Amount)
+	}
+	record := auditRecord(t, ctx, "payment.orphaned", payment.Payment_id)
+	if record.Actor != AuditActorStripe {
+		t.Errorf("orphaned payment audited as %q, want %q", record.Actor, AuditActorStripe)
+	}
+}
+
+func TestExpireTransactionLeavesCompletedCheckout(t *testing.T) {
+	ctx := requireDatabase(t)
+	transaction := seedTransaction(t, ctx, models.NewMoney(10000, "THB"), TransactionPending)
+	payment := seedCheckoutPayment(t, ctx, transaction)
+
+	expirer := checkout.NewFake()
+	expirer.Completed[*payment.Checkout_session] = true
+	if err := ExpireTransaction(ctx, expirer, transaction, map[string]interface{}{}); err != ErrStatusConflict {
+		t.Fatalf("ExpireTransaction returned %v, want ErrStatusConflict", err)
+	}
+
+	if status := transactionStatus(t, ctx, transaction.Transaction_id); status != TransactionPending {
+		t.Errorf("transaction is status %d, want pending", status)
+	}
+	if status := paymentStatus(t, ctx, payment.Payment_id); status != PaymentPending {
+		t.Errorf("payment is status %d, want pending", status)
+	}
+}
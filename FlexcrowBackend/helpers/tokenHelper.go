@@ -1,7 +1,6 @@
 package helper
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,10 +9,8 @@ import (
 	"user-athentication-golang/database"
 
 	jwt "github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SignedDetails struct {
@@ -22,28 +19,51 @@ type SignedDetails struct {
 	Last_name  string
 	Uid        string
 	User_type  string
+	Session_id string
+	Token_type string
 	jwt.StandardClaims
 }
 
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// A challenge token proves the password was right and is only good for
+	// finishing a two-factor login.
+	TokenTypeChallenge = "challenge"
+)
+
+const ChallengeTokenLifetime = 5 * time.Minute
+
+const RefreshTokenLifetime = 168 * time.Hour
+
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 
 var SECRET_KEY string = os.Getenv("SECRET_KEY")
 
-func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string) (signedToken string, signedRefreshToken string, err error) {
+func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string, sessionId string) (signedToken string, signedRefreshToken string, err error) {
 	claims := &SignedDetails{
 		Email:      email,
 		First_name: firstName,
 		Last_name:  lastName,
 		Uid:        uid,
 		User_type:  userType,
+		Session_id: sessionId,
+		Token_type: TokenTypeAccess,
 		StandardClaims: jwt.StandardClaims{
+			Id:        primitive.NewObjectID().Hex(),
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
 		},
 	}
 
+	// The refresh token only names the user and session. Both tokens carry an
+	// id so every rotated token is distinct, even within the same second.
 	refreshClaims := &SignedDetails{
+		Uid:        uid,
+		Session_id: sessionId,
+		Token_type: TokenTypeRefresh,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(168)).Unix(),
+			Id:        primitive.NewObjectID().Hex(),
+			ExpiresAt: time.Now().Local().Add(RefreshTokenLifetime).Unix(),
 		},
 	}
 
@@ -59,6 +79,59 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 }
 
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
+	claims, msg = parseToken(signedToken)
+	if msg != "" {
+		return
+	}
+
+	// Refresh tokens from before rotation carried no claims at all, so an
+	// empty uid is rejected along with any refresh or challenge token.
+	if (claims.Token_type != TokenTypeAccess && claims.Token_type != "") || claims.Uid == "" {
+		return nil, "the token is invalid"
+	}
+
+	return claims, msg
+}
+
+func ValidateRefreshToken(signedToken string) (claims *SignedDetails, msg string) {
+	claims, msg = parseToken(signedToken)
+	if msg != "" {
+		return
+	}
+
+	if claims.Token_type != TokenTypeRefresh || claims.Uid == "" || claims.Session_id == "" {
+		return nil, "the token is invalid"
+	}
+
+	return claims, msg
+}
+
+func GenerateChallengeToken(uid string) (string, error) {
+	claims := &SignedDetails{
+		Uid:        uid,
+		Token_type: TokenTypeChallenge,
+		StandardClaims: jwt.StandardClaims{
+			Id:        primitive.NewObjectID().Hex(),
+			ExpiresAt: time.Now().Local().Add(ChallengeTokenLifetime).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+}
+
+func ValidateChallengeToken(signedToken string) (claims *SignedDetails, msg string) {
+	claims, msg = parseToken(signedToken)
+	if msg != "" {
+		return
+	}
+
+	if claims.Token_type != TokenTypeChallenge || claims.Uid == "" {
+		return nil, "the token is invalid"
+	}
+
+	return claims, msg
+}
+
+func parseToken(signedToken string) (claims *SignedDetails, msg string) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&SignedDetails{},
@@ -75,50 +148,13 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	claims, ok := token.Claims.(*SignedDetails)
 	if !ok {
 		msg = fmt.Sprintf("the token is invalid")
-		msg = err.Error()
 		return
 	}
 
 	if claims.ExpiresAt < time.Now().Local().Unix() {
 		msg = fmt.Sprintf("token is expired")
-		msg = err.Error()
 		return
 	}
 
 	return claims, msg
 }
-
-func UpdateAllTokens(signedToken string, signedRefreshToken string, userId string) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-	var updateObj primitive.D
-
-	updateObj = append(updateObj, bson.E{"token", signedToken})
-	updateObj = append(updateObj, bson.E{"refresh_token", signedRefreshToken})
-
-	Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{"updated_at", Updated_at})
-
-	upsert := true
-	filter := bson.M{"user_id": userId}
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	_, err := userCollection.UpdateOne(
-		ctx,
-		filter,
-		bson.D{
-			{"$set", updateObj},
-		},
-		&opt,
-	)
-	defer cancel()
-
-	if err != nil {
-		log.Panic(err)
-		return
-	}
-
-	return
-}
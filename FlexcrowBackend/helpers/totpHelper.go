@@ -0,0 +1,267 @@
+package helper
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"user-athentication-golang/models"
+	"user-athentication-golang/totp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const TotpIssuer = "Flexcrow"
+
+const recoveryCodeCount = 10
+
+// Guessing six digits is only hopeless if attempts are capped.
+const (
+	totpAttemptLimit  = 5
+	totpAttemptWindow = 5 * time.Minute
+)
+
+var ErrTotpRequired = errors.New("a code from your authenticator app is required")
+var ErrInvalidTotpCode = errors.New("the code is invalid or has already been used")
+var ErrTotpNotEnabled = errors.New("two-factor authentication is not enabled")
+var ErrTotpAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTotpNotStarted = errors.New("start two-factor setup before confirming it")
+var ErrTotpAttempts = errors.New("too many two-factor attempts; wait a few minutes and try again")
+
+// BeginTotpEnrollment stores a new pending secret for user. It only takes
+// effect once a code from it is confirmed with EnableTotp.
+func BeginTotpEnrollment(ctx context.Context, user models.User) (secret string, uri string, err error) {
+	if user.Totp_enabled {
+		return "", "", ErrTotpAlreadyEnabled
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": user.User_id},
+		bson.M{"$set": bson.M{"totp_pending_secret": secret}},
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.ProvisioningURI(secret, TotpIssuer, *user.Email), nil
+}
+
+// EnableTotp confirms the pending secret with a code from it, switches 2FA on
+// and returns a fresh set of recovery codes to show the user once.
+func EnableTotp(ctx context.Context, user models.User, code string, source AuditSource) ([]string, error) {
+	if user.Totp_enabled {
+		return nil, ErrTotpAlreadyEnabled
+	}
+	if user.Totp_pending_secret == nil {
+		return nil, ErrTotpNotStarted
+	}
+	if err := allowTotpAttempt(ctx, user.User_id); err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Match(*user.Totp_pending_secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTotpCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		result, err := userCollection.UpdateOne(
+			sessCtx,
+			bson.M{"user_id": user.User_id, "totp_enabled": bson.M{"$ne": true}, "totp_pending_secret": *user.Totp_pending_secret},
+			bson.M{
+				"$set": bson.M{
+					"totp_enabled":        true,
+					"totp_secret":         *user.Totp_pending_secret,
+					"totp_last_step":      step,
+					"totp_recovery_codes": hashes,
+				},
+				"$unset": bson.M{"totp_pending_secret": ""},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrTotpNotStarted
+		}
+
+		return WriteAudit(sessCtx, "user.totp_enabled", source, "user", user.User_id, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTotp switches 2FA off after checking a code or a recovery code.
+func DisableTotp(ctx context.Context, user models.User, code string, source AuditSource) error {
+	if err := VerifySecondFactor(ctx, user, code, source); err != nil {
+		return err
+	}
+
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		_, err := userCollection.UpdateOne(
+			sessCtx,
+			bson.M{"user_id": user.User_id},
+			bson.M{
+				"$set":   bson.M{"totp_enabled": false},
+				"$unset": bson.M{"totp_secret": "", "totp_pending_secret": "", "totp_recovery_codes": "", "totp_last_step": ""},
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		return WriteAudit(sessCtx, "user.totp_disabled", source, "user", user.User_id, nil)
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a
+// fresh authenticator code.
+func RegenerateRecoveryCodes(ctx context.Context, user models.User, code string) ([]string, error) {
+	if err := VerifyTotp(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": user.User_id},
+		bson.M{"$set": bson.M{"totp_recovery_codes": hashes}},
+	)
+	return codes, err
+}
+
+// VerifyTotp accepts a code from the authenticator app only once: the step
+// it matched must be later than the last step accepted for the user.
+func VerifyTotp(ctx context.Context, user models.User, code string) error {
+	if !user.Totp_enabled || user.Totp_secret == nil {
+		return ErrTotpNotEnabled
+	}
+	if strings.TrimSpace(code) == "" {
+		return ErrTotpRequired
+	}
+	if err := allowTotpAttempt(ctx, user.User_id); err != nil {
+		return err
+	}
+
+	step, ok := totp.Match(*user.Totp_secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTotpCode
+	}
+
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": user.User_id, "totp_last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidTotpCode
+	}
+	return nil
+}
+
+// VerifySecondFactor accepts either an authenticator code or one of the
+// user's recovery codes, which is used up.
+func VerifySecondFactor(ctx context.Context, user models.User, code string, source AuditSource) error {
+	if !user.Totp_enabled {
+		return ErrTotpNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return VerifyTotp(ctx, user, code)
+	}
+	if code == "" {
+		return ErrTotpRequired
+	}
+	if err := allowTotpAttempt(ctx, user.User_id); err != nil {
+		return err
+	}
+
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		result, err := userCollection.UpdateOne(
+			sessCtx,
+			bson.M{"user_id": user.User_id, "totp_recovery_codes": hashRecoveryCode(code)},
+			bson.M{"$pull": bson.M{"totp_recovery_codes": hashRecoveryCode(code)}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrInvalidTotpCode
+		}
+
+		return WriteAudit(sessCtx, "user.recovery_code_used", source, "user", user.User_id, nil)
+	})
+}
+
+// RequireFreshTotp guards sensitive actions: users with 2FA must send a code
+// that has not been used before. Users without 2FA pass straight through.
+func RequireFreshTotp(ctx context.Context, userId string, code string) error {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return err
+	}
+	if !user.Totp_enabled {
+		return nil
+	}
+	return VerifyTotp(ctx, user, code)
+}
+
+func allowTotpAttempt(ctx context.Context, userId string) error {
+	allowed, err := AllowRate(ctx, "totp:"+userId, totpAttemptLimit, totpAttemptWindow)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrTotpAttempts
+	}
+	return nil
+}
+
+// Recovery codes are ten random characters shown as xxxxx-xxxxx. They carry
+// enough entropy that a plain SHA-256 is a safe way to store them.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		for j := range raw {
+			raw[j] = recoveryAlphabet[int(raw[j])%len(recoveryAlphabet)]
+		}
+		code := fmt.Sprintf("%s-%s", raw[:5], raw[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
@@ -0,0 +1,137 @@
+package helper
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"user-athentication-golang/models"
+	"user-athentication-golang/totp"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d of each", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	format := regexp.MustCompile("^[" + recoveryAlphabet + "]{5}-[" + recoveryAlphabet + "]{5}$")
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q appears twice", code)
+		}
+		seen[code] = true
+		if hashes[i] != hashRecoveryCode(code) {
+			t.Errorf("hash %d does not match code %q", i, code)
+		}
+		if hashes[i] == code {
+			t.Errorf("code %q is stored in plain text", code)
+		}
+	}
+}
+
+func TestHashRecoveryCodeIgnoresFormatting(t *testing.T) {
+	expected := hashRecoveryCode("abcde-fghjk")
+	for _, typed := range []string{"abcdefghjk", "ABCDE-FGHJK", "  abcde-fghjk\n"} {
+		if hashRecoveryCode(typed) != expected {
+			t.Errorf("%q hashes differently from abcde-fghjk", typed)
+		}
+	}
+	if hashRecoveryCode("abcde-fghjm") == expected {
+		t.Error("different codes hash the same")
+	}
+}
+
+// seedTotpUser creates a user with 2FA switched on and returns them with
+// their recovery codes.
+func seedTotpUser(t *testing.T, ctx context.Context) (models.User, []string) {
+	t.Helper()
+
+	userId := seedUser(t, ctx, models.NewMoney(0, models.DefaultCurrency))
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("generating secret: %v", err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generating recovery codes: %v", err)
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{"$set": bson.M{
+		"totp_enabled":        true,
+		"totp_secret":         secret,
+		"totp_last_step":      0,
+		"totp_recovery_codes": hashes,
+	}})
+	if err != nil {
+		t.Fatalf("enabling 2FA: %v", err)
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		t.Fatalf("reading user: %v", err)
+	}
+	return user, codes
+}
+
+func TestRecoveryCodeWorksOnce(t *testing.T) {
+	ctx := requireDatabase(t)
+	user, codes := seedTotpUser(t, ctx)
+
+	if err := VerifySecondFactor(ctx, user, codes[0], testSource); err != nil {
+		t.Fatalf("first use of a recovery code: %v", err)
+	}
+	if err := VerifySecondFactor(ctx, user, codes[0], testSource); err != ErrInvalidTotpCode {
+		t.Errorf("second use of a recovery code returned %v, want ErrInvalidTotpCode", err)
+	}
+
+	// The other codes are untouched.
+	if err := VerifySecondFactor(ctx, user, strings.ToUpper(codes[1]), testSource); err != nil {
+		t.Errorf("another recovery code: %v", err)
+	}
+
+	count, err := auditCollection.CountDocuments(ctx, bson.M{"action": "user.recovery_code_used", "resource_id": user.User_id})
+	if err != nil {
+		t.Fatalf("counting audit records: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("%d recovery code uses audited, want 2", count)
+	}
+}
+
+func TestRecoveryCodeFromAnotherUser(t *testing.T) {
+	ctx := requireDatabase(t)
+	user, _ := seedTotpUser(t, ctx)
+	_, otherCodes := seedTotpUser(t, ctx)
+
+	if err := VerifySecondFactor(ctx, user, otherCodes[0], testSource); err != ErrInvalidTotpCode {
+		t.Errorf("another user's recovery code returned %v, want ErrInvalidTotpCode", err)
+	}
+}
+
+func TestTotpCodeWorksOnce(t *testing.T) {
+	ctx := requireDatabase(t)
+	user, _ := seedTotpUser(t, ctx)
+
+	code, err := totp.Code(*user.Totp_secret, time.Now())
+	if err != nil {
+		t.Fatalf("generating code: %v", err)
+	}
+	if err := VerifySecondFactor(ctx, user, code, testSource); err != nil {
+		t.Fatalf("first use of a code: %v", err)
+	}
+	if err := VerifySecondFactor(ctx, user, code, testSource); err != ErrInvalidTotpCode {
+		t.Errorf("replayed code returned %v, want ErrInvalidTotpCode", err)
+	}
+}
@@ -0,0 +1,133 @@
+package helper
+
+import (
+	"fmt"
+)
+
+const (
+	TransactionPending    = 1
+	TransactionProcessing = 2
+	TransactionCompleted  = 3
+	TransactionCanceled   = 4
+	TransactionRejected   = 5
+	TransactionDisputed   = 6
+)
+
+const (
+	RoleSeller = "SELLER"
+	RoleBuyer  = "BUYER"
+	RoleAdmin  = "ADMIN"
+)
+
+type TransitionError struct {
+	Code    string
+	Message string
+}
+
+func (e *TransitionError) Error() string {
+	return e.Message
+}
+
+type transactionTransition struct {
+	From  int
+	To    int
+	Roles []string
+	// Paid transitions need money held in escrow for the transaction.
+	Paid bool
+}
+
+// The buyer accepts an offer before paying for it, so only completing needs
+// funded escrow. Once accepted, a buyer who wants out opens a dispute.
+var transactionTransitions = []transactionTransition{
+	{TransactionPending, TransactionProcessing, []string{RoleBuyer, RoleAdmin}, false},
+	{TransactionProcessing, TransactionCompleted, []string{RoleBuyer, RoleAdmin}, true},
+
+	{TransactionPending, TransactionCanceled, []string{RoleSeller, RoleAdmin}, false},
+	{TransactionProcessing, TransactionCanceled, []string{RoleSeller, RoleAdmin}, false},
+
+	{TransactionPending, TransactionRejected, []string{RoleBuyer, RoleAdmin}, false},
+
+	{TransactionPending, TransactionDisputed, []string{RoleBuyer, RoleSeller, RoleAdmin}, false},
+	{TransactionProcessing, TransactionDisputed, []string{RoleBuyer, RoleSeller, RoleAdmin}, false},
+
+	{TransactionDisputed, TransactionCompleted, []string{RoleAdmin}, false},
+	{TransactionDisputed, TransactionCanceled, []string{RoleAdmin}, false},
+}
+
+func TransactionStatusName(status int) string {
+	switch status {
+	case TransactionPending:
+		return "pending"
+	case TransactionProcessing:
+		return "processing"
+	case TransactionCompleted:
+		return "completed"
+	case TransactionCanceled:
+		return "canceled"
+	case TransactionRejected:
+		return "rejected"
+	case TransactionDisputed:
+		return "disputed"
+	}
+	return "unknown"
+}
+
+// TransactionRole names the part uid plays in a transaction. privileged
+// callers, such as staff holding transactions.manage, act as RoleAdmin.
+func TransactionRole(privileged bool, uid string, sellerId string, customerId string) string {
+	if privileged {
+		return RoleAdmin
+	}
+	if uid == sellerId {
+		return RoleSeller
+	}
+	if uid == customerId {
+		return RoleBuyer
+	}
+	return ""
+}
+
+// CheckTransactionTransition reports whether role may move a transaction
+// from one status to another. paid says whether escrow holds money for it.
+func CheckTransactionTransition(from int, to int, role string, paid bool) error {
+	if from == to {
+		return nil
+	}
+
+	if TransactionStatusName(to) == "unknown" {
+		return &TransitionError{
+			Code:    "invalid_status",
+			Message: fmt.Sprintf("unknown transaction status %d", to),
+		}
+	}
+
+	for _, transition := range transactionTransitions {
+		if transition.From != from || transition.To != to {
+			continue
+		}
+		for _, allowed := range transition.Roles {
+			if allowed != role {
+				continue
+			}
+			if transition.Paid && !paid {
+				return &TransitionError{
+					Code: "transaction_not_paid",
+					Message: fmt.Sprintf("a transaction must be paid before it can move from %s to %s",
+						TransactionStatusName(from), TransactionStatusName(to)),
+				}
+			}
+			return nil
+		}
+		return &TransitionError{
+			Code: "transition_not_allowed",
+			Message: fmt.Sprintf("role %s may not move a transaction from %s to %s",
+				role, TransactionStatusName(from), TransactionStatusName(to)),
+		}
+	}
+
+	return &TransitionError{
+		Code: "invalid_transition",
+		Message: fmt.Sprintf("a transaction cannot move from %s to %s",
+			TransactionStatusName(from), TransactionStatusName(to)),
+	}
+}
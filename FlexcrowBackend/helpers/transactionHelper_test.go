@@ -0,0 +1,42 @@
+package helper
+
+import "testing"
+
+func TestCheckTransactionTransition(t *testing.T) {
+	cases := []struct {
+		name     string
+		from, to int
+		role     string
+		paid     bool
+		wantCode string
+	}{
+		{"buyer accepts before paying", TransactionPending, TransactionProcessing, RoleBuyer, false, ""},
+		{"seller cannot accept", TransactionPending, TransactionProcessing, RoleSeller, false, "transition_not_allowed"},
+		{"buyer completes a paid transaction", TransactionProcessing, TransactionCompleted, RoleBuyer, true, ""},
+		{"unpaid transaction cannot complete", TransactionProcessing, TransactionCompleted, RoleBuyer, false, "transaction_not_paid"},
+		{"buyer rejects an offer", TransactionPending, TransactionRejected, RoleBuyer, false, ""},
+		{"buyer cannot reject once processing", TransactionProcessing, TransactionRejected, RoleBuyer, true, "invalid_transition"},
+		{"admin cannot reject once processing", TransactionProcessing, TransactionRejected, RoleAdmin, true, "invalid_transition"},
+		{"buyer disputes a paid transaction", TransactionProcessing, TransactionDisputed, RoleBuyer, true, ""},
+		{"seller cancels while processing", TransactionProcessing, TransactionCanceled, RoleSeller, true, ""},
+		{"buyer cannot cancel", TransactionProcessing, TransactionCanceled, RoleBuyer, true, "transition_not_allowed"},
+		{"unknown status", TransactionPending, 99, RoleAdmin, false, "invalid_status"},
+		{"no change", TransactionCompleted, TransactionCompleted, RoleBuyer, false, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckTransactionTransition(tc.from, tc.to, tc.role, tc.paid)
+			if tc.wantCode == "" {
+				if err != nil {
+					t.Fatalf("got %v, want allowed", err)
+				}
+				return
+			}
+			transitionErr, ok := err.(*TransitionError)
+			if !ok || transitionErr.Code != tc.wantCode {
+				t.Fatalf("got %v, want %s", err, tc.wantCode)
+			}
+		})
+	}
+}
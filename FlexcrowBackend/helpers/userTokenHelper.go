@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var userTokenCollection *mongo.Collection = database.OpenCollection(database.Client, "user_token")
+
+var ErrInvalidUserToken = errors.New("token is invalid, expired or already used")
+
+// IssueUserToken creates a fresh token for purpose and returns the secret to
+// send. Any earlier unused token for the same user and purpose stops working.
+func IssueUserToken(ctx context.Context, userId string, purpose string, email string, ttl time.Duration) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := ExpireUserTokens(ctx, userId, purpose); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	token := models.UserToken{
+		ID:         primitive.NewObjectID(),
+		User_id:    userId,
+		Purpose:    purpose,
+		Email:      email,
+		Token_hash: hashToken(raw),
+		Expires_at: now.Add(ttl),
+		Created_at: now,
+	}
+	if _, err := userTokenCollection.InsertOne(ctx, token); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeUserToken marks a token used and returns it. It fails for unknown,
+// expired or already used tokens, so each secret works exactly once.
+func ConsumeUserToken(ctx context.Context, purpose string, raw string) (models.UserToken, error) {
+	var token models.UserToken
+	now := time.Now()
+
+	err := userTokenCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"purpose":    purpose,
+			"token_hash": hashToken(raw),
+			"used_at":    nil,
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return token, ErrInvalidUserToken
+	}
+	return token, err
+}
+
+// ExpireUserTokens stops every unused token of a user for purpose.
+func ExpireUserTokens(ctx context.Context, userId string, purpose string) error {
+	_, err := userTokenCollection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userId, "purpose": purpose, "used_at": nil},
+		bson.M{"$set": bson.M{"expires_at": time.Now()}},
+	)
+	return err
+}
@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const MethodBalance = "balance"
+
+var ErrTransactionPaid = errors.New("transaction already has a payment")
+var ErrConcurrentUpdate = errors.New("balance or transaction changed while paying, please retry")
+
+// PayFromBalance debits the buyer's balance into escrow, records a paid
+// Payment and attaches it to the transaction, all in one MongoDB transaction.
+func PayFromBalance(ctx context.Context, transaction models.Transaction, payment models.Payment) error {
+	err := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if _, err := paymentCollection.InsertOne(sessCtx, payment); err != nil {
+			return err
+		}
+
+		ref := LedgerRef{Transaction_id: &transaction.Transaction_id, Payment_id: &payment.Payment_id, Created_by: payment.User_id}
+		err := PostLedger(sessCtx, EscrowEntries(*payment.User_id, LedgerEscrowHold, *payment.Amount, ListingAmount(transaction, *payment.Amount), ref)...)
+		if err != nil {
+			return err
+		}
+
+		result, err := transactionCollection.UpdateOne(
+			sessCtx,
+			bson.M{
+				"transaction_id": transaction.Transaction_id,
+				"status":         transaction.Status,
+				"payment_id":     bson.M{"$in": bson.A{nil, ""}},
+			},
+			bson.M{"$set": bson.M{
+				"payment_id": payment.Payment_id,
+				"updated_at": time.Now(),
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrTransactionPaid
+		}
+		return nil
+	})
+
+	// A write conflict that outlived the driver's retries means another debit
+	// or payment kept winning the race.
+	var labeled interface{ HasErrorLabel(string) bool }
+	if errors.As(err, &labeled) && labeled.HasErrorLabel("TransientTransactionError") {
+		return ErrConcurrentUpdate
+	}
+	return err
+}
@@ -0,0 +1,302 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+	"user-athentication-golang/payout"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var withdrawalCollection *mongo.Collection = database.OpenCollection(database.Client, "withdrawal")
+
+const (
+	WithdrawalRequested = 1
+	WithdrawalPaid      = 2
+	WithdrawalRejected  = 3
+	WithdrawalApproved  = 4
+	WithdrawalInBatch   = 5
+)
+
+const RoleOwner = "OWNER"
+
+var ErrWithdrawalConflict = errors.New("withdrawal status changed while updating")
+var ErrPayoutReferenceRequired = errors.New("a payout reference is required to mark a withdrawal paid")
+var ErrPayoutFailed = errors.New("payout provider declined the withdrawal; it was rejected and the funds returned to the user's balance")
+var ErrPayoutUnconfirmed = errors.New("payout provider did not confirm the payout; the withdrawal stays approved and can be retried")
+var ErrPayoutDispatched = errors.New("withdrawal was already sent to the payout provider; mark it paid once the money arrives")
+var ErrWithdrawalNotApproved = errors.New("only approved withdrawals can be paid out")
+
+type withdrawalTransition struct {
+	From  int
+	To    int
+	Roles []string
+}
+
+// The owner may only take back a request nobody has looked at yet.
+var withdrawalTransitions = []withdrawalTransition{
+	{WithdrawalRequested, WithdrawalApproved, []string{RoleAdmin}},
+	{WithdrawalRequested, WithdrawalRejected, []string{RoleAdmin, RoleOwner}},
+	{WithdrawalApproved, WithdrawalPaid, []string{RoleAdmin}},
+	{WithdrawalApproved, WithdrawalRejected, []string{RoleAdmin}},
+}
+
+func WithdrawalStatusName(status int) string {
+	switch status {
+	case WithdrawalRequested:
+		return "requested"
+	case WithdrawalPaid:
+		return "paid"
+	case WithdrawalRejected:
+		return "rejected"
+	case WithdrawalApproved:
+		return "approved"
+	case WithdrawalInBatch:
+		return "in_batch"
+	}
+	return "unknown"
+}
+
+func CheckWithdrawalTransition(from int, to int, role string) error {
+	if from == to {
+		return nil
+	}
+
+	if WithdrawalStatusName(to) == "unknown" {
+		return &TransitionError{
+			Code:    "invalid_status",
+			Message: fmt.Sprintf("unknown withdrawal status %d", to),
+		}
+	}
+
+	for _, transition := range withdrawalTransitions {
+		if transition.From != from || transition.To != to {
+			continue
+		}
+		for _, allowed := range transition.Roles {
+			if allowed == role {
+				return nil
+			}
+		}
+		return &TransitionError{
+			Code: "transition_not_allowed",
+			Message: fmt.Sprintf("role %s may not move a withdrawal from %s to %s",
+				role, WithdrawalStatusName(from), WithdrawalStatusName(to)),
+		}
+	}
+
+	return &TransitionError{
+		Code: "invalid_transition",
+		Message: fmt.Sprintf("a withdrawal cannot move from %s to %s",
+			WithdrawalStatusName(from), WithdrawalStatusName(to)),
+	}
+}
+
+// RequestWithdrawal checks the withdrawal rules, stores the withdrawal and
+// moves its amount out of the user's balance into the withdrawal hold
+// account. The check runs in the same transaction as the balance debit, so two
+// concurrent requests cannot both slip under a cap.
+func RequestWithdrawal(ctx context.Context, withdrawal models.Withdrawal, entry AuditEntry) error {
+	rules, err := CurrentWithdrawalRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		var user models.User
+		if err := userCollection.FindOne(sessCtx, bson.M{"user_id": *withdrawal.User_id}).Decode(&user); err != nil {
+			return err
+		}
+		if err := CheckWithdrawalRules(sessCtx, rules, user, withdrawal, time.Now()); err != nil {
+			return err
+		}
+
+		if _, err := withdrawalCollection.InsertOne(sessCtx, withdrawal); err != nil {
+			return err
+		}
+
+		ref := LedgerRef{Withdrawal_id: &withdrawal.Withdrawal_id, Created_by: withdrawal.User_id}
+		err := PostLedger(sessCtx,
+			LedgerEntry(*withdrawal.User_id, LedgerWithdrawalHold, withdrawal.Amount.Neg(), ref),
+			LedgerEntry(AccountWithdrawal, LedgerWithdrawalHold, *withdrawal.Amount, ref),
+		)
+		if err != nil {
+			return err
+		}
+		return AppendAudit(sessCtx, entry)
+	})
+}
+
+// TransitionWithdrawal applies a status change together with the balance
+// movement it implies: paying sends the held funds out, rejecting returns them
+// to the user. entry is audited in the same transaction and its actor is
+// recorded as the reviewer.
+func TransitionWithdrawal(ctx context.Context, withdrawal models.Withdrawal, to int, update bson.M, entry AuditEntry) error {
+	return RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if err := transitionWithdrawal(sessCtx, withdrawal, to, update, entry.Actor); err != nil {
+			return err
+		}
+		return AppendAudit(sessCtx, entry)
+	})
+}
+
+func transitionWithdrawal(sessCtx mongo.SessionContext, withdrawal models.Withdrawal, to int, update bson.M, actor string) error {
+	update["status"] = to
+	update["reviewed_by"] = actor
+	update["updated_at"] = time.Now()
+
+	result, err := withdrawalCollection.UpdateOne(
+		sessCtx,
+		bson.M{"withdrawal_id": withdrawal.Withdrawal_id, "status": withdrawal.Status},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWithdrawalConflict
+	}
+
+	if to != WithdrawalPaid && to != WithdrawalRejected {
+		return nil
+	}
+
+	// Withdrawals requested before holds existed were paid straight out to
+	// the external account, so that is where a rejection takes them back from.
+	holdAccount := AccountWithdrawal
+	held, err := ledgerCollection.CountDocuments(sessCtx, bson.M{
+		"withdrawal_id": withdrawal.Withdrawal_id,
+		"account":       AccountWithdrawal,
+	})
+	if err != nil {
+		return err
+	}
+	if held == 0 {
+		holdAccount = AccountExternal
+	}
+
+	amount := *withdrawal.Amount
+	ref := LedgerRef{Withdrawal_id: &withdrawal.Withdrawal_id, Created_by: &actor}
+
+	if to == WithdrawalRejected {
+		return PostLedger(sessCtx,
+			LedgerEntry(holdAccount, LedgerWithdrawalRelease, amount.Neg(), ref),
+			LedgerEntry(*withdrawal.User_id, LedgerWithdrawalRelease, amount, ref),
+		)
+	}
+
+	if holdAccount == AccountExternal {
+		return nil
+	}
+	return PostLedger(sessCtx,
+		LedgerEntry(AccountWithdrawal, LedgerWithdrawal, amount.Neg(), ref),
+		LedgerEntry(AccountExternal, LedgerWithdrawal, amount, ref),
+	)
+}
+
+// DispatchPayout hands an approved withdrawal to the payout provider. A
+// provider that pays immediately moves it to paid; otherwise the reference is
+// recorded and an admin marks it paid once the money has arrived. A payout
+// the provider declines rejects the withdrawal, so the held funds go back to
+// the user's balance. Any other failure may hide money that left, so the
+// withdrawal stays approved with the failure recorded, and a retry reuses the
+// provider's idempotency key. Each outcome is audited on behalf of source.
+func DispatchPayout(ctx context.Context, provider payout.PayoutProvider, withdrawal models.Withdrawal, source AuditSource) (models.Withdrawal, error) {
+	if withdrawal.Status == nil || *withdrawal.Status != WithdrawalApproved {
+		return withdrawal, ErrWithdrawalNotApproved
+	}
+	if withdrawal.Payout_reference != nil && *withdrawal.Payout_reference != "" {
+		return withdrawal, ErrPayoutDispatched
+	}
+
+	name := provider.Name()
+	withdrawal.Payout_provider = &name
+
+	result, err := provider.Payout(ctx, payout.Request{
+		Withdrawal_id: withdrawal.Withdrawal_id,
+		User_id:       *withdrawal.User_id,
+		Amount:        *withdrawal.Amount,
+		Method:        *withdrawal.Method,
+		Account:       *withdrawal.Account,
+	})
+	if err != nil && !errors.Is(err, payout.ErrDeclined) {
+		failure := err.Error()
+		update := bson.M{"payout_provider": name, "payout_failure": failure}
+		entry := source.Entry("withdrawal.payout_failed", "withdrawal", withdrawal.Withdrawal_id, AuditDiff(withdrawal, update), nil)
+		recordErr := RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if err := setPayoutFields(sessCtx, withdrawal, update); err != nil {
+				return err
+			}
+			return AppendAudit(sessCtx, entry)
+		})
+		if recordErr != nil {
+			return withdrawal, fmt.Errorf("%v; recording the failure also failed: %v", err, recordErr)
+		}
+		withdrawal.Payout_failure = &failure
+		return withdrawal, fmt.Errorf("%w: %v", ErrPayoutUnconfirmed, err)
+	}
+	if err != nil {
+		failure := err.Error()
+		reason := "payout declined: " + failure
+		update := bson.M{"status": WithdrawalRejected, "payout_provider": name, "payout_failure": failure, "reject_reason": reason}
+		entry := source.Entry("withdrawal.payout_failed", "withdrawal", withdrawal.Withdrawal_id, AuditDiff(withdrawal, update), nil)
+		if rejectErr := TransitionWithdrawal(ctx, withdrawal, WithdrawalRejected, update, entry); rejectErr != nil {
+			return withdrawal, fmt.Errorf("%v; returning the funds also failed: %v", err, rejectErr)
+		}
+		status := WithdrawalRejected
+		withdrawal.Status = &status
+		withdrawal.Payout_failure = &failure
+		withdrawal.Reject_reason = &reason
+		return withdrawal, fmt.Errorf("%w: %v", ErrPayoutFailed, err)
+	}
+
+	withdrawal.Payout_failure = nil
+	withdrawal.Payout_reference = &result.Reference
+	update := bson.M{
+		"payout_provider":  name,
+		"payout_reference": result.Reference,
+		"payout_failure":   nil,
+	}
+
+	if result.Status != payout.StatusPaid {
+		entry := source.Entry("withdrawal.payout_dispatched", "withdrawal", withdrawal.Withdrawal_id, AuditDiff(withdrawal, update), nil)
+		return withdrawal, RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if err := setPayoutFields(sessCtx, withdrawal, update); err != nil {
+				return err
+			}
+			return AppendAudit(sessCtx, entry)
+		})
+	}
+
+	update["status"] = WithdrawalPaid
+	entry := source.Entry("withdrawal.payout_dispatched", "withdrawal", withdrawal.Withdrawal_id, AuditDiff(withdrawal, update), nil)
+	if err := TransitionWithdrawal(ctx, withdrawal, WithdrawalPaid, update, entry); err != nil {
+		return withdrawal, err
+	}
+	status := WithdrawalPaid
+	withdrawal.Status = &status
+	return withdrawal, nil
+}
+
+func setPayoutFields(sessCtx mongo.SessionContext, withdrawal models.Withdrawal, update bson.M) error {
+	update["updated_at"] = time.Now()
+
+	result, err := withdrawalCollection.UpdateOne(
+		sessCtx,
+		bson.M{"withdrawal_id": withdrawal.Withdrawal_id, "status": WithdrawalApproved, "payout_reference": nil},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWithdrawalConflict
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"user-athentication-golang/models"
+	"user-athentication-golang/payout"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// seedApprovedWithdrawal gives a new user a balance and an approved
+// withdrawal of amount out of it, held the way RequestWithdrawal holds it.
+func seedApprovedWithdrawal(t *testing.T, ctx context.Context, balance models.Money, amount models.Money) models.Withdrawal {
+	t.Helper()
+
+	userId := seedUser(t, ctx, balance)
+	status, method, account := WithdrawalApproved, "bank_transfer", "123-4-56789-0"
+	now := time.Now()
+
+	withdrawal := models.Withdrawal{
+		ID:         primitive.NewObjectID(),
+		User_id:    &userId,
+		Status:     &status,
+		Amount:     &amount,
+		Method:     &method,
+		Account:    &account,
+		Created_at: now,
+		Updated_at: now,
+	}
+	withdrawal.Withdrawal_id = withdrawal.ID.Hex()
+
+	if _, err := withdrawalCollection.InsertOne(ctx, withdrawal); err != nil {
+		t.Fatalf("seeding withdrawal: %v", err)
+	}
+
+	ref := LedgerRef{Withdrawal_id: &withdrawal.Withdrawal_id, Created_by: &userId}
+	err := PostLedger(ctx,
+		LedgerEntry(userId, LedgerWithdrawalHold, amount.Neg(), ref),
+		LedgerEntry(AccountWithdrawal, LedgerWithdrawalHold, amount, ref),
+	)
+	if err != nil {
+		t.Fatalf("seeding hold: %v", err)
+	}
+	return withdrawal
+}
+
+func walletAmount(t *testing.T, ctx context.Context, userId string, currency string) int64 {
+	t.Helper()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		t.Fatalf("reading user: %v", err)
+	}
+	return UserWallets(user)[currency].Amount
+}
+
+// withdrawalHeld sums what the hold account still holds for a withdrawal.
+func withdrawalHeld(t *testing.T, ctx context.Context, withdrawalId string) int64 {
+	t.Helper()
+
+	cursor, err := ledgerCollection.Find(ctx, bson.M{"account": AccountWithdrawal, "withdrawal_id": withdrawalId})
+	if err != nil {
+		t.Fatalf("reading ledger: %v", err)
+	}
+	var entries []models.LedgerEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		t.Fatalf("reading ledger: %v", err)
+	}
+
+	var held int64
+	for _, entry := range entries {
+		held += entry.Amount.Amount
+	}
+	return held
+}
+
+func storedWithdrawal(t *testing.T, ctx context.Context, withdrawalId string) models.Withdrawal {
+	t.Helper()
+
+	var withdrawal models.Withdrawal
+	if err := withdrawalCollection.FindOne(ctx, bson.M{"withdrawal_id": withdrawalId}).Decode(&withdrawal); err != nil {
+		t.Fatalf("reading withdrawal: %v", err)
+	}
+	return withdrawal
+}
+
+func TestDispatchPayoutRequiresApproval(t *testing.T) {
+	provider := payout.NewFake()
+	status := WithdrawalRequested
+
+	_, err := DispatchPayout(context.Background(), provider, models.Withdrawal{Withdrawal_id: "w1", Status: &status}, testSource)
+	if err != ErrWithdrawalNotApproved {
+		t.Errorf("DispatchPayout returned %v, want ErrWithdrawalNotApproved", err)
+	}
+	if len(provider.Requests) != 0 {
+		t.Errorf("provider got %d payouts, want none", len(provider.Requests))
+	}
+}
+
+func TestDispatchPayoutPaid(t *testing.T) {
+	ctx := requireDatabase(t)
+	withdrawal := seedApprovedWithdrawal(t, ctx, models.NewMoney(10000, "THB"), models.NewMoney(4000, "THB"))
+	provider := payout.NewFake()
+
+	paid, err := DispatchPayout(ctx, provider, withdrawal, testSource)
+	if err != nil {
+		t.Fatalf("DispatchPayout: %v", err)
+	}
+
+	if len(provider.Requests) != 1 {
+		t.Fatalf("provider got %d payouts, want 1", len(provider.Requests))
+	}
+	sent := provider.Requests[0]
+	if sent.Withdrawal_id != withdrawal.Withdrawal_id || sent.Amount != *withdrawal.Amount || sent.Account != *withdrawal.Account {
+		t.Errorf("provider got %+v", sent)
+	}
+
+	stored := storedWithdrawal(t, ctx, withdrawal.Withdrawal_id)
+	if *stored.Status != WithdrawalPaid || *paid.Status != WithdrawalPaid {
+		t.Errorf("withdrawal is status %d, want paid", *stored.Status)
+	}
+	if stored.Payout_reference == nil || *stored.Payout_reference != "po_fake_1" {
+		t.Errorf("payout reference is %v, want po_fake_1", stored.Payout_reference)
+	}
+	if held := withdrawalHeld(t, ctx, withdrawal.Withdrawal_id); held != 0 {
+		t.Errorf("hold still has %d", held)
+	}
+	if balance := walletAmount(t, ctx, *withdrawal.User_id, "THB"); balance != 6000 {
+		t.Errorf("balance is %d, want 6000", balance)
+	}
+}
+
+func TestDispatchPayoutQueued(t *testing.T) {
+	ctx := requireDatabase(t)
+	withdrawal := seedApprovedWithdrawal(t, ctx, models.NewMoney(10000, "THB"), models.NewMoney(4000, "THB"))
+	provider := payout.NewFake()
+	provider.Status = payout.StatusPending
+
+	if _, err := DispatchPayout(ctx, provider, withdrawal, testSource); err != nil {
+		t.Fatalf("DispatchPayout: %v", err)
+	}
+
+	stored := storedWithdrawal(t, ctx, withdrawal.Withdrawal_id)
+	if *stored.Status != WithdrawalApproved {
+		t.Errorf("withdrawal is status %d, want it to stay approved until the provider settles", *stored.Status)
+	}
+	if stored.Payout_reference == nil || *stored.Payout_reference != "po_fake_1" {
+		t.Errorf("payout reference is %v, want po_fake_1", stored.Payout_reference)
+	}
+	if held := withdrawalHeld(t, ctx, withdrawal.Withdrawal_id); held != 4000 {
+		t.Errorf("hold has %d, want 4000", held)
+	}
+}
+
+func TestDispatchPayoutFailureReturnsFunds(t *testing.T) {
+	ctx := requireDatabase(t)
+	withdrawal := seedApprovedWithdrawal(t, ctx, models.NewMoney(10000, "THB"), models.NewMoney(4000, "THB"))
+	provider := payout.NewFake()
+	provider.Err = fmt.Errorf("%w: account closed", payout.ErrDeclined)
+
+	rejected, err := DispatchPayout(ctx, provider, withdrawal, testSource)
+	if !errors.Is(err, ErrPayoutFailed) {
+		t.Fatalf("DispatchPayout returned %v, want ErrPayoutFailed", err)
+	}
+
+	stored := storedWithdrawal(t, ctx, withdrawal.Withdrawal_id)
+	if *stored.Status != WithdrawalRejected || *rejected.Status != WithdrawalRejected {
+		t.Errorf("withdrawal is status %d, want rejected", *stored.Status)
+	}
+	if stored.Payout_failure == nil || *stored.Payout_failure != provider.Err.Error() {
+		t.Errorf("payout failure is %v, want the provider's error", stored.Payout_failure)
+	}
+	if held := withdrawalHeld(t, ctx, withdrawal.Withdrawal_id); held != 0 {
+		t.Errorf("hold still has %d", held)
+	}
+	if balance := walletAmount(t, ctx, *withdrawal.User_id, "THB"); balance != 10000 {
+		t.Errorf("balance is %d, want the full 10000 back", balance)
+	}
+
+	record := auditRecord(t, ctx, "withdrawal.payout_failed", withdrawal.Withdrawal_id)
+	if record.Actor != testSource.Actor || record.Ip_address != testSource.Ip_address || record.Request_id != testSource.Request_id {
+		t.Errorf("payout failure audited as %+v", record)
+	}
+}
+
+func TestDispatchPayoutUnconfirmedKeepsWithdrawalApproved(t *testing.T) {
+	ctx := requireDatabase(t)
+	withdrawal := seedApprovedWithdrawal(t, ctx, models.NewMoney(10000, "THB"), models.NewMoney(4000, "THB"))
+	provider := payout.NewFake()
+	provider.Err = errors.New("read tcp: i/o timeout")
+
+	_, err := DispatchPayout(ctx, provider, withdrawal, testSource)
+	if !errors.Is(err, ErrPayoutUnconfirmed) {
+		t.Fatalf("DispatchPayout returned %v, want ErrPayoutUnconfirmed", err)
+	}
+
+	stored := storedWithdrawal(t, ctx, withdrawal.Withdrawal_id)
+	if *stored.Status != WithdrawalApproved {
+		t.Errorf("withdrawal is status %d, want it to stay approved", *stored.Status)
+	}
+	if stored.Payout_failure == nil || *stored.Payout_failure != "read tcp: i/o timeout" {
+		t.Errorf("payout failure is %v, want the provider's error", stored.Payout_failure)
+	}
+	if held := withdrawalHeld(t, ctx, withdrawal.Withdrawal_id); held != 4000 {
+		t.Errorf("hold has %d, want 4000", held)
+	}
+	auditRecord(t, ctx, "withdrawal.payout_failed", withdrawal.Withdrawal_id)
+
+	provider.Err = nil
+	paid, err := DispatchPayout(ctx, provider, stored, testSource)
+	if err != nil {
+		t.Fatalf("retrying DispatchPayout: %v", err)
+	}
+	if *paid.Status != WithdrawalPaid || paid.Payout_failure != nil {
+		t.Errorf("retry left %+v, want it paid with the failure cleared", paid)
+	}
+	if len(provider.Requests) != 1 || provider.Requests[0].Withdrawal_id != withdrawal.Withdrawal_id {
+		t.Errorf("retry sent %+v, want the same withdrawal again", provider.Requests)
+	}
+}
+
+func TestDispatchPayoutRefusesDispatchedWithdrawal(t *testing.T) {
+	ctx := requireDatabase(t)
+	withdrawal := seedApprovedWithdrawal(t, ctx, models.NewMoney(10000, "THB"), models.NewMoney(4000, "THB"))
+	provider := payout.NewFake()
+	provider.Status = payout.StatusPending
+
+	queued, err := DispatchPayout(ctx, provider, withdrawal, testSource)
+	if err != nil {
+		t.Fatalf("DispatchPayout: %v", err)
+	}
+
+	if _, err := DispatchPayout(ctx, provider, queued, testSource); err != ErrPayoutDispatched {
+		t.Errorf("second DispatchPayout returned %v, want ErrPayoutDispatched", err)
+	}
+	if len(provider.Requests) != 1 {
+		t.Errorf("provider got %d payouts, want 1", len(provider.Requests))
+	}
+}
@@ -0,0 +1,227 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"user-athentication-golang/database"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var withdrawalRulesCollection *mongo.Collection = database.OpenCollection(database.Client, "withdrawal_rules")
+
+// The rules are a single document so admins can change them without a deploy.
+const withdrawalRulesId = "current"
+
+// WithdrawalRuleError is a rule violation the client can act on; Details
+// carries the limit or the time the user can try again.
+type WithdrawalRuleError struct {
+	Code    string
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *WithdrawalRuleError) Error() string {
+	return e.Message
+}
+
+func DefaultWithdrawalRules() models.WithdrawalRules {
+	currency := models.DefaultCurrency
+	minAmount := models.MoneyFromFloat(100, currency)
+	maxAmount := models.MoneyFromFloat(50000, currency)
+	daily := models.MoneyFromFloat(100000, currency)
+	monthly := models.MoneyFromFloat(500000, currency)
+	cooldown := 24
+	block := true
+
+	return models.WithdrawalRules{
+		Limits: []models.WithdrawalLimit{{
+			Currency:      &currency,
+			Min_amount:    &minAmount,
+			Max_amount:    &maxAmount,
+			Daily_limit:   &daily,
+			Monthly_limit: &monthly,
+		}},
+		Change_cooldown_hours: &cooldown,
+		Block_open_disputes:   &block,
+	}
+}
+
+func CurrentWithdrawalRules(ctx context.Context) (models.WithdrawalRules, error) {
+	var rules models.WithdrawalRules
+	err := withdrawalRulesCollection.FindOne(ctx, bson.M{"_id": withdrawalRulesId}).Decode(&rules)
+	if err == mongo.ErrNoDocuments {
+		return DefaultWithdrawalRules(), nil
+	}
+	return rules, err
+}
+
+func SaveWithdrawalRules(ctx context.Context, rules models.WithdrawalRules, source AuditSource) (models.WithdrawalRules, error) {
+	for i, limit := range rules.Limits {
+		currency := strings.ToUpper(*limit.Currency)
+		rules.Limits[i].Currency = &currency
+		for _, amount := range []*models.Money{limit.Min_amount, limit.Max_amount, limit.Daily_limit, limit.Monthly_limit} {
+			if amount != nil {
+				*amount = models.MoneyFromFloat(amount.Float(), currency)
+			}
+		}
+	}
+	rules.Updated_by = &source.Actor
+	rules.Updated_at = time.Now()
+
+	return rules, RunInTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		_, err := withdrawalRulesCollection.ReplaceOne(
+			sessCtx,
+			bson.M{"_id": withdrawalRulesId},
+			rules,
+			options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+		return WriteAudit(sessCtx, "withdrawal_rules.update", source, "withdrawal_rules", withdrawalRulesId, map[string]interface{}{
+			"rules": rules,
+		})
+	})
+}
+
+func withdrawalLimitFor(rules models.WithdrawalRules, currency string) *models.WithdrawalLimit {
+	for i, limit := range rules.Limits {
+		if limit.Currency != nil && strings.EqualFold(*limit.Currency, currency) {
+			return &rules.Limits[i]
+		}
+	}
+	return nil
+}
+
+// withdrawnSince sums the user's withdrawals in a currency that are still
+// live, i.e. not rejected, from the given time on.
+func withdrawnSince(ctx context.Context, userId string, currency string, since time.Time) (models.Money, error) {
+	total := models.NewMoney(0, currency)
+
+	cursor, err := withdrawalCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id":         userId,
+			"amount.currency": total.Currency,
+			"status":          bson.M{"$ne": WithdrawalRejected},
+			"created_at":      bson.M{"$gte": since},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$amount.amount"}}}},
+	})
+	if err != nil {
+		return total, err
+	}
+
+	var rows []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return total, err
+	}
+	if len(rows) > 0 {
+		total.Amount = rows[0].Total
+	}
+	return total, nil
+}
+
+// CheckWithdrawalRules returns a *WithdrawalRuleError if the withdrawal breaks
+// one of the rules. Daily and monthly caps follow the server's calendar.
+func CheckWithdrawalRules(ctx context.Context, rules models.WithdrawalRules, user models.User, withdrawal models.Withdrawal, now time.Time) error {
+	amount := *withdrawal.Amount
+
+	if limit := withdrawalLimitFor(rules, amount.Currency); limit != nil {
+		if limit.Min_amount != nil && amount.Amount < limit.Min_amount.Amount {
+			return &WithdrawalRuleError{
+				Code:    "amount_below_minimum",
+				Message: fmt.Sprintf("the minimum withdrawal is %s %s", limit.Min_amount.String(), amount.Currency),
+				Details: map[string]interface{}{"limit": limit.Min_amount},
+			}
+		}
+		if limit.Max_amount != nil && amount.Amount > limit.Max_amount.Amount {
+			return &WithdrawalRuleError{
+				Code:    "amount_above_maximum",
+				Message: fmt.Sprintf("the maximum withdrawal is %s %s", limit.Max_amount.String(), amount.Currency),
+				Details: map[string]interface{}{"limit": limit.Max_amount},
+			}
+		}
+
+		windows := []struct {
+			code  string
+			name  string
+			limit *models.Money
+			since time.Time
+		}{
+			{"daily_limit_exceeded", "daily", limit.Daily_limit, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())},
+			{"monthly_limit_exceeded", "monthly", limit.Monthly_limit, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())},
+		}
+		for _, window := range windows {
+			if window.limit == nil {
+				continue
+			}
+			used, err := withdrawnSince(ctx, user.User_id, amount.Currency, window.since)
+			if err != nil {
+				return err
+			}
+			if used.Add(amount).Amount > window.limit.Amount {
+				remaining := window.limit.Sub(used)
+				if remaining.Amount < 0 {
+					remaining.Amount = 0
+				}
+				return &WithdrawalRuleError{
+					Code:    window.code,
+					Message: fmt.Sprintf("the %s withdrawal limit is %s %s", window.name, window.limit.String(), amount.Currency),
+					Details: map[string]interface{}{"limit": window.limit, "remaining": remaining},
+				}
+			}
+		}
+	}
+
+	if rules.Change_cooldown_hours != nil && *rules.Change_cooldown_hours > 0 {
+		cooldown := time.Duration(*rules.Change_cooldown_hours) * time.Hour
+		changes := []struct {
+			code string
+			what string
+			at   *time.Time
+		}{
+			{"password_change_cooldown", "password", user.Password_changed_at},
+			{"email_change_cooldown", "email address", user.Email_changed_at},
+		}
+		for _, change := range changes {
+			if change.at == nil {
+				continue
+			}
+			if until := change.at.Add(cooldown); now.Before(until) {
+				return &WithdrawalRuleError{
+					Code:    change.code,
+					Message: fmt.Sprintf("withdrawals are paused for %d hours after a %s change", *rules.Change_cooldown_hours, change.what),
+					Details: map[string]interface{}{"retry_after": until},
+				}
+			}
+		}
+	}
+
+	if rules.Block_open_disputes != nil && *rules.Block_open_disputes {
+		count, err := disputeCollection.CountDocuments(ctx, bson.M{
+			"status": DisputeOpen,
+			"$or":    bson.A{bson.M{"seller_id": user.User_id}, bson.M{"buyer_id": user.User_id}},
+		})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return &WithdrawalRuleError{
+				Code:    "open_dispute",
+				Message: "withdrawals are blocked while you have an open dispute",
+				Details: map[string]interface{}{"open_disputes": count},
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"user-athentication-golang/database"
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var transactionCollection *mongo.Collection = database.OpenCollection(database.Client, "transaction")
+
+// AutoRelease completes processing transactions whose buyer has not
+// confirmed or disputed delivery within the inspection window.
+func AutoRelease(ctx context.Context, window time.Duration) error {
+	cutoff := time.Now().Add(-window)
+
+	cursor, err := transactionCollection.Find(ctx, bson.M{
+		"status":       helper.TransactionProcessing,
+		"delivered_at": bson.M{"$ne": nil, "$lte": cutoff},
+	})
+	if err != nil {
+		return err
+	}
+
+	var transactions []models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		if err := autoReleaseTransaction(ctx, transaction, window); err != nil {
+			log.Printf("auto release %s: %v", transaction.Transaction_id, err)
+		}
+	}
+	return nil
+}
+
+func autoReleaseTransaction(ctx context.Context, transaction models.Transaction, window time.Duration) error {
+	open, err := helper.HasOpenDispute(ctx, transaction.Transaction_id)
+	if err != nil || open {
+		return err
+	}
+
+	held, err := helper.EscrowHeld(ctx, transaction)
+	if err != nil {
+		return err
+	}
+	if held.IsZero() {
+		log.Printf("auto release %s: skipped, nothing held in escrow", transaction.Transaction_id)
+		return nil
+	}
+
+	err = helper.AutoReleaseTransaction(ctx, transaction, map[string]interface{}{
+		"delivered_at":      transaction.Delivered_at,
+		"inspection_window": window.String(),
+	})
+	if err == helper.ErrStatusConflict {
+		// The buyer completed or disputed it in the meantime.
+		return nil
+	}
+	if err == helper.ErrTransactionNotPaid {
+		log.Printf("auto release %s: skipped, escrow holds less than the seller amount and fee", transaction.Transaction_id)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"user-athentication-golang/checkout"
+	helper "user-athentication-golang/helpers"
+	"user-athentication-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ExpirePending cancels transactions that have sat unpaid in pending for
+// longer than ttl.
+func ExpirePending(ctx context.Context, ttl time.Duration) error {
+	cutoff := time.Now().Add(-ttl)
+
+	cursor, err := transactionCollection.Find(ctx, bson.M{
+		"status":     helper.TransactionPending,
+		"created_at": bson.M{"$lte": cutoff},
+	})
+	if err != nil {
+		return err
+	}
+
+	var transactions []models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		err := helper.ExpireTransaction(ctx, checkout.Provider(), transaction, map[string]interface{}{
+			"created_at": transaction.Created_at,
+			"ttl":        ttl.String(),
+		})
+		if err != nil && err != helper.ErrStatusConflict {
+			log.Printf("expire transaction %s: %v", transaction.Transaction_id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	helper "user-athentication-golang/helpers"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var holder = fmt.Sprintf("%s-%d-%s", hostname(), os.Getpid(), primitive.NewObjectID().Hex())
+
+// Start launches the background jobs. Each job runs on every instance but
+// only the one holding the job's lease does the work for that interval.
+func Start() {
+	window := envDuration("AUTO_RELEASE_WINDOW", 72*time.Hour)
+	every("auto_release", envDuration("AUTO_RELEASE_INTERVAL", 10*time.Minute), func(ctx context.Context) error {
+		return AutoRelease(ctx, window)
+	})
+
+	ttl := envDuration("PENDING_TRANSACTION_TTL", 7*24*time.Hour)
+	every("expire_pending", envDuration("PENDING_EXPIRY_INTERVAL", time.Hour), func(ctx context.Context) error {
+		return ExpirePending(ctx, ttl)
+	})
+}
+
+func every(name string, interval time.Duration, job func(ctx context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			run(name, interval, job)
+			<-ticker.C
+		}
+	}()
+}
+
+func run(name string, interval time.Duration, job func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+
+	acquired, err := helper.AcquireLease(ctx, name, holder, interval)
+	if err != nil {
+		log.Printf("job %s: could not acquire lease: %v", name, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	if err := job(ctx); err != nil {
+		log.Printf("job %s: %v", name, err)
+	}
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// Fake keeps sent messages in memory. Set Err to make sending fail.
+type Fake struct {
+	mu   sync.Mutex
+	Sent []Message
+	Err  error
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) Send(ctx context.Context, message Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+
+	f.Sent = append(f.Sent, message)
+	return nil
+}
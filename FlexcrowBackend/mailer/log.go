@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Log is the development mailer. With a directory it writes each message to
+// its own .eml file there; without one it prints messages to the server log.
+type Log struct {
+	dir string
+}
+
+func NewLog(dir string) *Log {
+	return &Log{dir: dir}
+}
+
+func (l *Log) Send(ctx context.Context, message Message) error {
+	raw := render("flexcrow@localhost", message)
+
+	if l.dir == "" {
+		log.Printf("mail to %s:\n%s", message.To, raw)
+		return nil
+	}
+
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), filepath.Base(message.To))
+	return os.WriteFile(filepath.Join(l.dir, name), raw, 0o644)
+}
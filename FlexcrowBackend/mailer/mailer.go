@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var (
+	mu       sync.RWMutex
+	provider Mailer
+)
+
+// Provider returns the mailer chosen by MAILER: "smtp", "fake" or, by
+// default, "log", which writes messages to MAILER_DIR or the server log.
+func Provider() Mailer {
+	mu.RLock()
+	current := provider
+	mu.RUnlock()
+	if current != nil {
+		return current
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		switch os.Getenv("MAILER") {
+		case "smtp":
+			provider = NewSMTP(SMTPConfigFromEnv())
+		case "fake":
+			provider = NewFake()
+		default:
+			provider = NewLog(os.Getenv("MAILER_DIR"))
+		}
+	}
+	return provider
+}
+
+// SetProvider swaps the mailer, for tests and local development.
+func SetProvider(mailer Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = mailer
+}
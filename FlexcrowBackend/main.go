@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"user-athentication-golang/jobs"
+	"user-athentication-golang/middleware"
 	"user-athentication-golang/routes"
 
 	"github.com/gin-contrib/cors"
@@ -19,17 +21,21 @@ func main() {
 
 	router := gin.New()
 	router.Use(gin.Logger())
+	router.Use(middleware.RequestId())
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "token"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-Id"},
 		AllowCredentials: true,
 	}))
 
 	routes.AuthRoutes(router)
+	routes.WebhookRoutes(router)
 	routes.UserRoutes(router)
 
+	jobs.Start()
+
 	router.Run(":" + port)
 }
@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	helper "user-athentication-golang/helpers"
 
@@ -25,11 +27,24 @@ func Authentication() gin.HandlerFunc {
 			return
 		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := helper.ValidateSession(ctx, claims); err != nil {
+			if err == helper.ErrSessionRevoked || err == helper.ErrSessionNotFound {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "session_revoked"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking the session"})
+			}
+			c.Abort()
+			return
+		}
+
 		c.Set("email", claims.Email)
 		c.Set("first_name", claims.First_name)
 		c.Set("last_name", claims.Last_name)
 		c.Set("uid", claims.Uid)
 		c.Set("user_type", claims.User_type)
+		c.Set("session_id", claims.Session_id)
 
 		c.Next()
 
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	helper "user-athentication-golang/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission lets the request through only when the signed-in user
+// holds permission through one of their roles. It must run after
+// Authentication.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckPermission(c, permission); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "message": err.Error(), "permission": permission})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
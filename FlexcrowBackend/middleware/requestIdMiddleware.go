@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestId tags every request with an id, taken from the X-Request-Id
+// header when a proxy already set a sensible one, so audit records and logs
+// can be tied back to it. The id is echoed in the response.
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader("X-Request-Id")
+		if !requestIdPattern.MatchString(requestId) {
+			requestId = primitive.NewObjectID().Hex()
+		}
+		c.Set("request_id", requestId)
+		c.Header("X-Request-Id", requestId)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditRecord is one link of the audit chain. Hash covers every other field
+// exactly as stored, including Prev_hash, so editing or removing a record
+// breaks every hash after it.
+type AuditRecord struct {
+	ID            primitive.ObjectID     `bson:"_id"`
+	Audit_id      string                 `json:"audit_id"`
+	Sequence      int64                  `json:"sequence"`
+	Action        string                 `json:"action"`
+	Actor         string                 `json:"actor"`
+	Resource_type string                 `json:"resource_type"`
+	Resource_id   string                 `json:"resource_id"`
+	Changes       map[string]AuditChange `json:"changes"`
+	Details       map[string]interface{} `json:"details"`
+	Ip_address    string                 `json:"ip_address"`
+	Request_id    string                 `json:"request_id"`
+	Created_at    time.Time              `json:"created_at"`
+	Prev_hash     string                 `json:"prev_hash"`
+	Hash          string                 `json:"hash"`
+}
+
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
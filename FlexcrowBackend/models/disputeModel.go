@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DisputeMessage struct {
+	Message_id string    `json:"message_id"`
+	User_id    string    `json:"user_id"`
+	Role       string    `json:"role"`
+	Message    *string   `json:"message" validate:"required,max=2000"`
+	File_ids   []string  `json:"file_ids"`
+	Created_at time.Time `json:"created_at"`
+}
+
+type DisputeResolution struct {
+	Type         *string   `json:"type" validate:"required,eq=refund|eq=release|eq=split"`
+	Buyer_amount *Money    `json:"buyer_amount"`
+	Refund_to    *string   `json:"refund_to" validate:"omitempty,eq=card|eq=balance"`
+	Note         *string   `json:"note" validate:"omitempty,max=2000"`
+	Resolved_by  string    `json:"resolved_by"`
+	Resolved_at  time.Time `json:"resolved_at"`
+}
+
+type Dispute struct {
+	ID                primitive.ObjectID `bson:"_id"`
+	Dispute_id        string             `json:"dispute_id"`
+	Transaction_id    *string            `json:"transaction_id" validate:"required"`
+	Seller_id         *string            `json:"seller_id"`
+	Buyer_id          *string            `json:"buyer_id"`
+	Opened_by         *string            `json:"opened_by"`
+	Status            *int               `json:"status"`
+	Reason            *string            `json:"reason" validate:"required,max=2000"`
+	Evidence_file_ids []string           `json:"evidence_file_ids"`
+	Messages          []DisputeMessage   `json:"messages"`
+	Resolution        *DisputeResolution `json:"resolution"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExchangeRate says one unit of Base buys Rate units of Quote from
+// Effective_from on.
+type ExchangeRate struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Exchange_rate_id string             `json:"exchange_rate_id"`
+	Base             *string            `json:"base" validate:"required,len=3"`
+	Quote            *string            `json:"quote" validate:"required,len=3"`
+	Rate             *float64           `json:"rate" validate:"required,gt=0"`
+	Effective_from   *time.Time         `json:"effective_from"`
+	Created_by       *string            `json:"created_by"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+}
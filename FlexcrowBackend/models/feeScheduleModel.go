@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FeeTier struct {
+	Above *Money   `json:"above" validate:"required"`
+	Rate  *float64 `json:"rate" validate:"required,min=0,max=1"`
+}
+
+type FeeSchedule struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Fee_schedule_id string             `json:"fee_schedule_id"`
+	Name            *string            `json:"name" validate:"required,min=2,max=100"`
+	Tiers           []FeeTier          `json:"tiers" validate:"required,min=1,dive"`
+	Effective_from  *time.Time         `json:"effective_from" validate:"required"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+}
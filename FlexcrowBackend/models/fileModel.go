@@ -9,6 +9,7 @@ import (
 type File struct {
 	ID            primitive.ObjectID `bson:"_id"`
 	File_id       string             `json:"file_id"`
+	User_id       *string            `json:"user_id"`
 	Original_name string             `json:"original_name"`
 	Cloud_url     string             `json:"cloud_url"`
 	Cloud_id      string             `json:"cloud_id"`
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerEntry struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Ledger_id      string             `json:"ledger_id"`
+	Journal_id     string             `json:"journal_id"`
+	Account        string             `json:"account"`
+	Type           string             `json:"type"`
+	Amount         Money              `json:"amount"`
+	Transaction_id *string            `json:"transaction_id"`
+	Payment_id     *string            `json:"payment_id"`
+	Withdrawal_id  *string            `json:"withdrawal_id"`
+	Created_by     *string            `json:"created_by"`
+	Note           *string            `json:"note"`
+	Created_at     time.Time          `json:"created_at"`
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+const DefaultCurrency = "THB"
+
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true,
+	"KRW": true, "MGA": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// Money is an amount in the minor unit of its currency (satang for THB).
+// In JSON it is written as a plain number in major units so clients that
+// used the old float64 fields keep working; in BSON it is stored as
+// {amount, currency}.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+type moneyDocument struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+func CurrencyDigits(currency string) int {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return 0
+	}
+	return 2
+}
+
+func NewMoney(amount int64, currency string) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func MoneyFromFloat(value float64, currency string) Money {
+	m := NewMoney(0, currency)
+	m.Amount = int64(math.Round(value * math.Pow10(CurrencyDigits(m.Currency))))
+	return m
+}
+
+func ParseMoney(value string, currency string) (Money, error) {
+	m := NewMoney(0, currency)
+
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return m, fmt.Errorf("invalid money amount %q", value)
+	}
+
+	rat.Mul(rat, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(CurrencyDigits(m.Currency))), nil)))
+
+	// Round half away from zero to the nearest minor unit.
+	num, den := rat.Num(), rat.Denom()
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	if !quotient.IsInt64() {
+		return m, fmt.Errorf("money amount %q out of range", value)
+	}
+
+	m.Amount = quotient.Int64()
+	return m, nil
+}
+
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(CurrencyDigits(m.Currency))
+}
+
+func (m Money) String() string {
+	digits := CurrencyDigits(m.Currency)
+	if digits == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(math.Pow10(digits))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, digits, amount%scale)
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+func (m Money) MulRate(rate float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate)), Currency: m.Currency}
+}
+
+// Convert turns m into another currency at rate units of that currency per
+// unit of m's currency, rounding half away from zero to the minor unit.
+func (m Money) Convert(currency string, rate float64) Money {
+	to := NewMoney(0, currency)
+	if to.Currency == m.Currency {
+		return m
+	}
+
+	factor := new(big.Rat).SetFloat64(rate)
+	if factor == nil {
+		return to
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(CurrencyDigits(m.Currency))), nil)
+	major := new(big.Rat).SetFrac(big.NewInt(m.Amount), scale)
+	major.Mul(major, factor)
+
+	converted, err := ParseMoney(major.FloatString(CurrencyDigits(to.Currency)+6), to.Currency)
+	if err != nil {
+		return to
+	}
+	return converted
+}
+
+// WithCurrency reads an amount decoded from JSON, which assumes the default
+// currency, as the same number of major units in another currency.
+func (m Money) WithCurrency(currency string) Money {
+	return MoneyFromFloat(m.Float(), currency)
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return errors.New("money must be a number")
+	}
+
+	currency := m.Currency
+	parsed, err := ParseMoney(number.String(), currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(moneyDocument{Amount: m.Amount, Currency: NewMoney(0, m.Currency).Currency})
+}
+
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+
+	// Documents written before the money type stored plain floats in the
+	// default currency; read them so the migration can rewrite them.
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var document moneyDocument
+		if err := value.Unmarshal(&document); err != nil {
+			return err
+		}
+		*m = NewMoney(document.Amount, document.Currency)
+	case bsontype.Double:
+		*m = MoneyFromFloat(value.Double(), DefaultCurrency)
+	case bsontype.Int32:
+		*m = MoneyFromFloat(float64(value.Int32()), DefaultCurrency)
+	case bsontype.Int64:
+		*m = MoneyFromFloat(float64(value.Int64()), DefaultCurrency)
+	case bsontype.Decimal128:
+		parsed, err := ParseMoney(value.Decimal128().String(), DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Null, bsontype.Undefined:
+		*m = NewMoney(0, DefaultCurrency)
+	default:
+		return fmt.Errorf("cannot decode %s into money", t)
+	}
+
+	return nil
+}
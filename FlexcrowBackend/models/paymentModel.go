@@ -7,12 +7,17 @@ import (
 )
 
 type Payment struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Payment_id string             `json:"payment_id"`
-	User_id    *string            `json:"user_id"`
-	Status     *int               `json:"status" validate:"required,eq=1|eq=2|eq=3"`
-	Amount     *float64           `json:"amount" validate:"required"`
-	Method     *string            `json:"method" validate:"required,max=100"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
+	ID                 primitive.ObjectID `bson:"_id"`
+	Payment_id         string             `json:"payment_id"`
+	User_id            *string            `json:"user_id"`
+	Transaction_id     *string            `json:"transaction_id"`
+	Status             *int               `json:"status" validate:"required,eq=1|eq=2|eq=3|eq=4"`
+	Amount             *Money             `json:"amount" validate:"required"`
+	Refunded_amount    *Money             `json:"refunded_amount"`
+	Method             *string            `json:"method" validate:"required,max=100"`
+	Provider_reference *string            `json:"provider_reference"`
+	Checkout_session   *string            `json:"checkout_session"`
+	Refund_of          *string            `json:"refund_of"`
+	Created_at         time.Time          `json:"created_at"`
+	Updated_at         time.Time          `json:"updated_at"`
 }
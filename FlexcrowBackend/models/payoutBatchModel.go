@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PayoutBatchItem struct {
+	Withdrawal_id string     `json:"withdrawal_id"`
+	User_id       string     `json:"user_id"`
+	Name          string     `json:"name"`
+	Method        string     `json:"method"`
+	Account       string     `json:"account"`
+	Amount        Money      `json:"amount"`
+	Status        int        `json:"status"`
+	Reference     *string    `json:"reference"`
+	Failure       *string    `json:"failure"`
+	Settled_at    *time.Time `json:"settled_at"`
+}
+
+type PayoutBatch struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Batch_id   string             `json:"batch_id"`
+	Status     *int               `json:"status"`
+	Items      []PayoutBatchItem  `json:"items"`
+	Created_by *string            `json:"created_by"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+}
@@ -14,7 +14,8 @@ type Product struct {
 	Status      *int               `json:"status" validate:"required,eq=1|eq=2"`
 	Type        *int               `json:"type" validate:"required,eq=1|eq=2"`
 	Description *string            `json:"description" validate:"max=1000"`
-	Price       *float64           `json:"price" validate:"required"`
+	Price       *Money             `json:"price" validate:"required"`
+	Currency    *string            `json:"currency" validate:"omitempty,len=3"`
 	Image_id    []*string          `json:"image_id"`
 	Video_id    *string            `json:"video_id"`
 	Created_at  time.Time          `json:"created_at"`
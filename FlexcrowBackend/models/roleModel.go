@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role is a named set of permissions. Built-in roles are defined in code and
+// are only returned by the API; custom roles are stored in the role
+// collection.
+type Role struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Role_id     string             `json:"role_id" validate:"required,min=2,max=50"`
+	Name        string             `json:"name" validate:"required,min=2,max=100"`
+	Description string             `json:"description" validate:"max=500"`
+	Permissions []string           `json:"permissions" validate:"required"`
+	Built_in    bool               `json:"built_in"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
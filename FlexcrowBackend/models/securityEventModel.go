@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SecurityEvent struct {
+	ID                primitive.ObjectID     `bson:"_id"`
+	Security_event_id string                 `json:"security_event_id"`
+	Type              string                 `json:"type"`
+	User_id           *string                `json:"user_id"`
+	Email             string                 `json:"email"`
+	Ip_address        string                 `json:"ip_address"`
+	User_agent        string                 `json:"user_agent"`
+	Details           map[string]interface{} `json:"details"`
+	Created_at        time.Time              `json:"created_at"`
+}
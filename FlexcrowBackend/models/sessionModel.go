@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one login and every token rotated from it. Only the access
+// token named by Token_id and the refresh token matching Refresh_token_hash
+// are accepted; earlier refresh hashes are kept so a replayed token can be
+// recognised and the whole session revoked.
+type Session struct {
+	ID                 primitive.ObjectID `bson:"_id"`
+	Session_id         string             `json:"session_id"`
+	User_id            string             `json:"user_id"`
+	Token_id           string             `json:"token_id"`
+	Refresh_token_hash string             `json:"-"`
+	Used_token_hashes  []string           `json:"-"`
+	User_agent         string             `json:"user_agent"`
+	Ip_address         string             `json:"ip_address"`
+	Last_seen_at       time.Time          `json:"last_seen_at"`
+	Expires_at         time.Time          `json:"expires_at"`
+	Revoked_at         *time.Time         `json:"revoked_at"`
+	Revoked_reason     *string            `json:"revoked_reason"`
+	Created_at         time.Time          `json:"created_at"`
+	Updated_at         time.Time          `json:"updated_at"`
+}
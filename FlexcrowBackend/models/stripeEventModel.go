@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+type StripeEvent struct {
+	ID         string    `bson:"_id" json:"event_id"`
+	Type       string    `json:"type"`
+	Payment_id *string   `json:"payment_id"`
+	Created_at time.Time `json:"created_at"`
+}
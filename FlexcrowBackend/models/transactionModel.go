@@ -18,14 +18,23 @@ type Transaction struct {
 	Address_id        *string            `json:"address_id"`
 	Payment_id        *string            `json:"payment_id"`
 	Shipping          *string            `json:"shipping"`
-	Shipping_price    *float64           `json:"shipping_price"`
+	Shipping_price    *Money             `json:"shipping_price"`
 	Shipping_number   *string            `json:"shipping_number"`
 	Shipping_details  *string            `json:"shipping_details"`
 	Shipping_image_id *string            `json:"shipping_image_id"`
 	Delivered_at      *time.Time         `json:"delivered_at"`
 	Delivered_details *string            `json:"delivered_details"`
-	Fee               *float64           `json:"fee"`
+	Auto_released_at  *time.Time         `json:"auto_released_at"`
+	Cancel_reason     *string            `json:"cancel_reason"`
+	Currency          *string            `json:"currency"`
+	Payment_currency  *string            `json:"payment_currency" validate:"omitempty,len=3"`
+	Exchange_rate     *float64           `json:"exchange_rate"`
+	Amount_charged    *Money             `json:"amount_charged"`
+	Fee               *Money             `json:"fee"`
 	Fee_type          *int               `json:"fee_type" validate:"eq=1|eq=2|eq=3"`
+	Fee_schedule_id   *string            `json:"fee_schedule_id"`
+	Amount_buyer      *Money             `json:"amount_buyer"`
+	Amount_seller     *Money             `json:"amount_seller"`
 	Created_at        time.Time          `json:"created_at"`
 	Updated_at        time.Time          `json:"updated_at"`
 }
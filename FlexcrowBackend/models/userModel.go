@@ -7,21 +7,31 @@ import (
 )
 
 type User struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	User_id       string             `json:"user_id"`
-	Username      *string            `json:"username" validate:"required,min=5,max=50"`
-	Email         *string            `json:"email" validate:"email,required"`
-	Password      *string            `json:"password" validate:"required,min=6"`
-	User_type     *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
-	Status        *int               `json:"status" validate:"required,eq=1|eq=2"`
-	First_name    *string            `json:"first_name" validate:"required,min=2,max=100"`
-	Last_name     *string            `json:"last_name" validate:"required,min=2,max=100"`
-	Phone         *string            `json:"phone" validate:"required"`
-	Balance       *float64           `json:"balance"`
-	Image_id      *string            `json:"image_id"`
-	Address_id    *string            `json:"address_id"`
-	Token         *string            `json:"token"`
-	Refresh_token *string            `json:"refresh_token"`
-	Created_at    time.Time          `json:"created_at"`
-	Updated_at    time.Time          `json:"updated_at"`
+	ID                  primitive.ObjectID `bson:"_id"`
+	User_id             string             `json:"user_id"`
+	Username            *string            `json:"username" validate:"required,min=5,max=50"`
+	Email               *string            `json:"email" validate:"email,required"`
+	Password            *string            `json:"password" validate:"required,min=6"`
+	User_type           *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
+	Status              *int               `json:"status" validate:"required,eq=1|eq=2"`
+	Roles               []string           `json:"roles"`
+	First_name          *string            `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name           *string            `json:"last_name" validate:"required,min=2,max=100"`
+	Phone               *string            `json:"phone" validate:"required"`
+	Balance             *Money             `json:"balance"`
+	Wallets             map[string]Money   `json:"wallets"`
+	Image_id            *string            `json:"image_id"`
+	Address_id          *string            `json:"address_id"`
+	Token               *string            `json:"-"`
+	Refresh_token       *string            `json:"-"`
+	Password_changed_at *time.Time         `json:"password_changed_at"`
+	Email_changed_at    *time.Time         `json:"email_changed_at"`
+	Email_verified_at   *time.Time         `json:"email_verified_at"`
+	Totp_enabled        bool               `json:"totp_enabled"`
+	Totp_secret         *string            `json:"-"`
+	Totp_pending_secret *string            `json:"-"`
+	Totp_last_step      int64              `json:"-"`
+	Totp_recovery_codes []string           `json:"-"`
+	Created_at          time.Time          `json:"created_at"`
+	Updated_at          time.Time          `json:"updated_at"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserToken is a single-use secret mailed to a user. Only its hash is
+// stored; Email pins it to the address it was sent to.
+type UserToken struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	User_id    string             `json:"user_id"`
+	Purpose    string             `json:"purpose"`
+	Email      string             `json:"email"`
+	Token_hash string             `json:"-"`
+	Expires_at time.Time          `json:"expires_at"`
+	Used_at    *time.Time         `json:"used_at"`
+	Created_at time.Time          `json:"created_at"`
+}
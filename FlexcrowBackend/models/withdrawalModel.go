@@ -7,13 +7,21 @@ import (
 )
 
 type Withdrawal struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	Withdrawal_id string             `json:"withdrawal_id"`
-	User_id       *string            `json:"user_id"`
-	Status        *int               `json:"status" validate:"required,eq=1|eq=2|eq=3"`
-	Amount        *float64           `json:"amount" validate:"required"`
-	Method        *string            `json:"method" validate:"required,max=100"`
-	Account       *string            `json:"account" validate:"required,max=100"`
-	Created_at    time.Time          `json:"created_at"`
-	Updated_at    time.Time          `json:"updated_at"`
+	ID               primitive.ObjectID `bson:"_id"`
+	Withdrawal_id    string             `json:"withdrawal_id"`
+	User_id          *string            `json:"user_id"`
+	Status           *int               `json:"status" validate:"required,eq=1|eq=2|eq=3|eq=4|eq=5"`
+	Amount           *Money             `json:"amount" validate:"required"`
+	Currency         *string            `json:"currency" validate:"omitempty,len=3"`
+	Method           *string            `json:"method" validate:"required,max=100"`
+	Account          *string            `json:"account" validate:"required,max=100"`
+	Payout_reference *string            `json:"payout_reference" validate:"omitempty,max=200"`
+	Payout_provider  *string            `json:"payout_provider"`
+	Payout_failure   *string            `json:"payout_failure"`
+	Batch_id         *string            `json:"batch_id"`
+	Reject_reason    *string            `json:"reject_reason" validate:"omitempty,max=500"`
+	Reviewed_by      *string            `json:"reviewed_by"`
+	Totp_code        string             `json:"totp_code,omitempty" bson:"-"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// WithdrawalLimit holds the amount limits for one currency. A nil limit is
+// not enforced.
+type WithdrawalLimit struct {
+	Currency      *string `json:"currency" validate:"required,len=3"`
+	Min_amount    *Money  `json:"min_amount"`
+	Max_amount    *Money  `json:"max_amount"`
+	Daily_limit   *Money  `json:"daily_limit"`
+	Monthly_limit *Money  `json:"monthly_limit"`
+}
+
+type WithdrawalRules struct {
+	Limits                []WithdrawalLimit `json:"limits" validate:"dive"`
+	Change_cooldown_hours *int              `json:"change_cooldown_hours" validate:"omitempty,min=0"`
+	Block_open_disputes   *bool             `json:"block_open_disputes"`
+	Updated_by            *string           `json:"updated_by"`
+	Updated_at            time.Time         `json:"updated_at"`
+}
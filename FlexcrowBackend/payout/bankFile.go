@@ -0,0 +1,67 @@
+package payout
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BankFile appends approved withdrawals to a daily CSV that is uploaded to
+// the bank. The money has not moved yet, so payouts stay pending.
+type BankFile struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewBankFile(dir string) *BankFile {
+	if dir == "" {
+		dir = "payouts"
+	}
+	return &BankFile{dir: dir}
+}
+
+func (b *BankFile) Name() string {
+	return "bank_file"
+}
+
+func (b *BankFile) Payout(ctx context.Context, request Request) (Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := os.MkdirAll(b.dir, 0o750); err != nil {
+		return Result{}, err
+	}
+
+	name := fmt.Sprintf("payouts-%s.csv", time.Now().Format("2006-01-02"))
+	path := filepath.Join(b.dir, name)
+
+	_, statErr := os.Stat(path)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if os.IsNotExist(statErr) {
+		writer.Write([]string{"withdrawal_id", "user_id", "method", "account", "amount", "currency"})
+	}
+	writer.Write([]string{
+		request.Withdrawal_id,
+		request.User_id,
+		request.Method,
+		request.Account,
+		request.Amount.String(),
+		request.Amount.Currency,
+	})
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return Result{}, err
+	}
+
+	return Result{Reference: name + "#" + request.Withdrawal_id, Status: StatusPending}, nil
+}
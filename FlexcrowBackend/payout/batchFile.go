@@ -0,0 +1,346 @@
+package payout
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"user-athentication-golang/models"
+)
+
+// Debtor is the platform account the bank debits for a batch, taken from
+// PAYOUT_DEBTOR_NAME, PAYOUT_DEBTOR_ACCOUNT and PAYOUT_DEBTOR_BIC.
+type Debtor struct {
+	Name    string
+	Account string
+	Bic     string
+}
+
+func DebtorFromEnv() Debtor {
+	debtor := Debtor{
+		Name:    os.Getenv("PAYOUT_DEBTOR_NAME"),
+		Account: os.Getenv("PAYOUT_DEBTOR_ACCOUNT"),
+		Bic:     os.Getenv("PAYOUT_DEBTOR_BIC"),
+	}
+	if debtor.Name == "" {
+		debtor.Name = "Flexcrow"
+	}
+	return debtor
+}
+
+var batchCSVHeader = []string{"batch_id", "end_to_end_id", "user_id", "name", "method", "account", "amount", "currency"}
+
+// WriteBatchCSV writes one row per withdrawal. The withdrawal id is used as
+// the end-to-end id so the bank's result file can be matched back.
+func WriteBatchCSV(w io.Writer, batch models.PayoutBatch) error {
+	writer := csv.NewWriter(w)
+	writer.Write(batchCSVHeader)
+	for _, item := range batch.Items {
+		writer.Write([]string{
+			batch.Batch_id,
+			item.Withdrawal_id,
+			item.User_id,
+			item.Name,
+			item.Method,
+			item.Account,
+			item.Amount.String(),
+			item.Amount.Currency,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type painDocument struct {
+	XMLName xml.Name       `xml:"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03 Document"`
+	Initn   painInitiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type painInitiation struct {
+	GrpHdr painGroupHeader   `xml:"GrpHdr"`
+	PmtInf []painPaymentInfo `xml:"PmtInf"`
+}
+
+type painGroupHeader struct {
+	MsgId    string    `xml:"MsgId"`
+	CreDtTm  string    `xml:"CreDtTm"`
+	NbOfTxs  int       `xml:"NbOfTxs"`
+	CtrlSum  string    `xml:"CtrlSum"`
+	InitgPty painParty `xml:"InitgPty"`
+}
+
+type painParty struct {
+	Nm string `xml:"Nm"`
+}
+
+type painAccount struct {
+	Id struct {
+		Othr struct {
+			Id string `xml:"Id"`
+		} `xml:"Othr"`
+	} `xml:"Id"`
+}
+
+type painAgent struct {
+	FinInstnId struct {
+		BIC  string `xml:"BIC,omitempty"`
+		Othr *struct {
+			Id string `xml:"Id"`
+		} `xml:"Othr,omitempty"`
+	} `xml:"FinInstnId"`
+}
+
+type painPaymentInfo struct {
+	PmtInfId    string         `xml:"PmtInfId"`
+	PmtMtd      string         `xml:"PmtMtd"`
+	NbOfTxs     int            `xml:"NbOfTxs"`
+	CtrlSum     string         `xml:"CtrlSum"`
+	ReqdExctnDt string         `xml:"ReqdExctnDt"`
+	Dbtr        painParty      `xml:"Dbtr"`
+	DbtrAcct    painAccount    `xml:"DbtrAcct"`
+	DbtrAgt     painAgent      `xml:"DbtrAgt"`
+	ChrgBr      string         `xml:"ChrgBr"`
+	CdtTrfTxInf []painTransfer `xml:"CdtTrfTxInf"`
+}
+
+type painTransfer struct {
+	PmtId struct {
+		EndToEndId string `xml:"EndToEndId"`
+	} `xml:"PmtId"`
+	Amt struct {
+		InstdAmt struct {
+			Ccy   string `xml:"Ccy,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"InstdAmt"`
+	} `xml:"Amt"`
+	Cdtr     painParty   `xml:"Cdtr"`
+	CdtrAcct painAccount `xml:"CdtrAcct"`
+	RmtInf   struct {
+		Ustrd string `xml:"Ustrd"`
+	} `xml:"RmtInf"`
+}
+
+// WritePain001 writes the batch as an ISO 20022 pain.001.001.03 credit
+// transfer initiation with one payment information block per currency.
+func WritePain001(w io.Writer, batch models.PayoutBatch, debtor Debtor) error {
+	byCurrency := map[string][]models.PayoutBatchItem{}
+	for _, item := range batch.Items {
+		byCurrency[item.Amount.Currency] = append(byCurrency[item.Amount.Currency], item)
+	}
+	currencies := make([]string, 0, len(byCurrency))
+	for currency := range byCurrency {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	document := painDocument{}
+	header := &document.Initn.GrpHdr
+	header.MsgId = batch.Batch_id
+	header.CreDtTm = batch.Created_at.UTC().Format("2006-01-02T15:04:05")
+	header.NbOfTxs = len(batch.Items)
+	header.InitgPty.Nm = debtor.Name
+
+	var controlSum []models.Money
+	for _, currency := range currencies {
+		items := byCurrency[currency]
+		info := painPaymentInfo{
+			PmtInfId:    batch.Batch_id + "-" + currency,
+			PmtMtd:      "TRF",
+			NbOfTxs:     len(items),
+			ReqdExctnDt: batch.Created_at.UTC().Format("2006-01-02"),
+			Dbtr:        painParty{Nm: debtor.Name},
+			ChrgBr:      "SLEV",
+		}
+		info.DbtrAcct.Id.Othr.Id = debtor.Account
+		info.DbtrAgt.FinInstnId.BIC = debtor.Bic
+		if debtor.Bic == "" {
+			info.DbtrAgt.FinInstnId.Othr = &struct {
+				Id string `xml:"Id"`
+			}{Id: "NOTPROVIDED"}
+		}
+
+		sum := models.NewMoney(0, currency)
+		for _, item := range items {
+			var transfer painTransfer
+			transfer.PmtId.EndToEndId = item.Withdrawal_id
+			transfer.Amt.InstdAmt.Ccy = currency
+			transfer.Amt.InstdAmt.Value = item.Amount.String()
+			transfer.Cdtr.Nm = item.Name
+			transfer.CdtrAcct.Id.Othr.Id = item.Account
+			transfer.RmtInf.Ustrd = "Withdrawal " + item.Withdrawal_id
+			info.CdtTrfTxInf = append(info.CdtTrfTxInf, transfer)
+			sum = sum.Add(item.Amount)
+		}
+		info.CtrlSum = sum.String()
+		controlSum = append(controlSum, sum)
+
+		document.Initn.PmtInf = append(document.Initn.PmtInf, info)
+	}
+	header.CtrlSum = sumDecimals(controlSum)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(document)
+}
+
+// sumDecimals adds amounts in different currencies as plain decimals, which
+// is how pain.001 defines the group header control sum.
+func sumDecimals(amounts []models.Money) string {
+	total := models.NewMoney(0, "")
+	for _, amount := range amounts {
+		converted, _ := models.ParseMoney(amount.String(), total.Currency)
+		total = total.Add(converted)
+	}
+	return total.String()
+}
+
+// BatchOutcome is one line of the bank's result file.
+type BatchOutcome struct {
+	End_to_end_id string
+	Paid          bool
+	Reference     string
+	Reason        string
+}
+
+var ErrUnknownResultFormat = errors.New("result file is neither a pain.002 status report nor a CSV with end_to_end_id and status columns")
+
+// ParseBatchResult reads the bank's result file, either an ISO 20022 pain.002
+// payment status report or a CSV with end_to_end_id, status and optional
+// reference and reason columns.
+func ParseBatchResult(r io.Reader) ([]BatchOutcome, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "<") {
+		return parsePain002(data)
+	}
+	return parseResultCSV(string(data))
+}
+
+type pain002Document struct {
+	Report struct {
+		Transactions []struct {
+			StsId           string `xml:"StsId"`
+			OrgnlEndToEndId string `xml:"OrgnlEndToEndId"`
+			TxSts           string `xml:"TxSts"`
+			StsRsnInf       []struct {
+				Rsn struct {
+					Cd string `xml:"Cd"`
+				} `xml:"Rsn"`
+				AddtlInf []string `xml:"AddtlInf"`
+			} `xml:"StsRsnInf"`
+		} `xml:"OrgnlPmtInfAndSts>TxInfAndSts"`
+	} `xml:"CstmrPmtStsRpt"`
+}
+
+func parsePain002(data []byte) ([]BatchOutcome, error) {
+	var document pain002Document
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	var outcomes []BatchOutcome
+	for _, transaction := range document.Report.Transactions {
+		outcome := BatchOutcome{
+			End_to_end_id: transaction.OrgnlEndToEndId,
+			Reference:     transaction.StsId,
+		}
+		switch transaction.TxSts {
+		case "ACSC", "ACCC", "ACSP":
+			outcome.Paid = true
+		case "RJCT":
+			var reasons []string
+			for _, info := range transaction.StsRsnInf {
+				if info.Rsn.Cd != "" {
+					reasons = append(reasons, info.Rsn.Cd)
+				}
+				reasons = append(reasons, info.AddtlInf...)
+			}
+			outcome.Reason = strings.Join(reasons, " ")
+			if outcome.Reason == "" {
+				outcome.Reason = "rejected by bank"
+			}
+		default:
+			// Still in progress at the bank; wait for a later report.
+			continue
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	if len(outcomes) == 0 && len(document.Report.Transactions) == 0 {
+		return nil, ErrUnknownResultFormat
+	}
+	return outcomes, nil
+}
+
+func parseResultCSV(data string) ([]BatchOutcome, error) {
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrUnknownResultFormat
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	idColumn, ok := columns["end_to_end_id"]
+	if !ok {
+		idColumn, ok = columns["withdrawal_id"]
+	}
+	statusColumn, hasStatus := columns["status"]
+	if !ok || !hasStatus {
+		return nil, ErrUnknownResultFormat
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var outcomes []BatchOutcome
+	for line, row := range rows[1:] {
+		if idColumn >= len(row) || statusColumn >= len(row) {
+			return nil, fmt.Errorf("result file line %d is missing columns", line+2)
+		}
+		outcome := BatchOutcome{
+			End_to_end_id: strings.TrimSpace(row[idColumn]),
+			Reference:     field(row, "reference"),
+			Reason:        field(row, "reason"),
+		}
+		switch strings.ToLower(strings.TrimSpace(row[statusColumn])) {
+		case "paid", "success", "acsc", "accc":
+			outcome.Paid = true
+		case "failed", "rejected", "rjct":
+			if outcome.Reason == "" {
+				outcome.Reason = "rejected by bank"
+			}
+		default:
+			return nil, fmt.Errorf("result file line %d has unknown status %q", line+2, row[statusColumn])
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
+
+// BatchFileName is the download name for a batch in the given format.
+func BatchFileName(batch models.PayoutBatch, format string) string {
+	extension := "csv"
+	if format == "pain001" {
+		extension = "xml"
+	}
+	return fmt.Sprintf("payout-%s-%s.%s", batch.Batch_id, batch.Created_at.Format("20060102"), extension)
+}
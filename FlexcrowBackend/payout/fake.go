@@ -0,0 +1,36 @@
+package payout
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Fake pays out instantly in memory. Set Err to make payouts fail or Status
+// to StatusPending to mimic a provider that settles later.
+type Fake struct {
+	mu       sync.Mutex
+	Requests []Request
+	Err      error
+	Status   string
+}
+
+func NewFake() *Fake {
+	return &Fake{Status: StatusPaid}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Payout(ctx context.Context, request Request) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+
+	f.Requests = append(f.Requests, request)
+	return Result{Reference: fmt.Sprintf("po_fake_%d", len(f.Requests)), Status: f.Status}, nil
+}
@@ -0,0 +1,19 @@
+package payout
+
+import "context"
+
+// Manual leaves the transfer to an admin, who marks the withdrawal paid with
+// the reference of the transfer they made.
+type Manual struct{}
+
+func NewManual() *Manual {
+	return &Manual{}
+}
+
+func (m *Manual) Name() string {
+	return "manual"
+}
+
+func (m *Manual) Payout(ctx context.Context, request Request) (Result, error) {
+	return Result{Status: StatusPending}, nil
+}
@@ -0,0 +1,81 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"user-athentication-golang/models"
+)
+
+const (
+	StatusPaid    = "paid"
+	StatusPending = "pending"
+)
+
+// ErrDeclined marks a payout the provider definitely refused, so no money
+// left. Providers wrap it; any other error may hide a payout that went
+// through, and the withdrawal has to be retried rather than rejected.
+var ErrDeclined = errors.New("payout declined")
+
+// Request carries what a provider needs to send one withdrawal. Withdrawal_id
+// doubles as the idempotency key.
+type Request struct {
+	Withdrawal_id string
+	User_id       string
+	Amount        models.Money
+	Method        string
+	Account       string
+}
+
+// Result reports where the money went. StatusPaid means it has left; with
+// StatusPending the provider queued it and an admin confirms it later.
+type Result struct {
+	Reference string
+	Status    string
+}
+
+type PayoutProvider interface {
+	Name() string
+	Payout(ctx context.Context, request Request) (Result, error)
+}
+
+var (
+	mu       sync.RWMutex
+	provider PayoutProvider
+)
+
+// Provider returns the provider chosen by PAYOUT_PROVIDER: "bank_file",
+// "stripe_connect", "fake" or, by default, "manual".
+func Provider() PayoutProvider {
+	mu.RLock()
+	current := provider
+	mu.RUnlock()
+	if current != nil {
+		return current
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		switch os.Getenv("PAYOUT_PROVIDER") {
+		case "bank_file":
+			provider = NewBankFile(os.Getenv("PAYOUT_BANK_FILE_DIR"))
+		case "stripe_connect":
+			provider = NewStripeConnect(os.Getenv("STRIPE_SECRET_KEY"))
+		case "fake":
+			provider = NewFake()
+		default:
+			provider = NewManual()
+		}
+	}
+	return provider
+}
+
+// SetProvider swaps the payout provider, for tests and local development.
+func SetProvider(payoutProvider PayoutProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = payoutProvider
+}
@@ -0,0 +1,72 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/client"
+)
+
+// StripeConnect transfers the amount to the connected account stored in the
+// withdrawal's Account field.
+type StripeConnect struct {
+	api *client.API
+}
+
+func NewStripeConnect(secretKey string) *StripeConnect {
+	if secretKey == "" {
+		return &StripeConnect{}
+	}
+	return &StripeConnect{api: client.New(secretKey, nil)}
+}
+
+func (s *StripeConnect) Name() string {
+	return "stripe_connect"
+}
+
+func (s *StripeConnect) Payout(ctx context.Context, request Request) (Result, error) {
+	if s.api == nil {
+		return Result{}, errors.New("Stripe secret key not configured")
+	}
+	if !strings.HasPrefix(request.Account, "acct_") {
+		return Result{}, fmt.Errorf("%w: account is not a Stripe connected account", ErrDeclined)
+	}
+
+	params := &stripe.TransferParams{
+		Amount:        stripe.Int64(request.Amount.Amount),
+		Currency:      stripe.String(strings.ToLower(request.Amount.Currency)),
+		Destination:   stripe.String(request.Account),
+		TransferGroup: stripe.String(request.Withdrawal_id),
+	}
+	params.Context = ctx
+	params.SetIdempotencyKey("withdrawal-" + request.Withdrawal_id)
+
+	transfer, err := s.api.Transfers.New(params)
+	if err != nil {
+		if refused(err) {
+			return Result{}, fmt.Errorf("%w: %v", ErrDeclined, err)
+		}
+		return Result{}, err
+	}
+
+	return Result{Reference: transfer.ID, Status: StatusPaid}, nil
+}
+
+// refused reports whether Stripe answered and turned the transfer down.
+// Network errors, timeouts, rate limits, idempotency conflicts and server
+// errors leave the outcome unknown.
+func refused(err error) bool {
+	var stripeErr *stripe.Error
+	if !errors.As(err, &stripeErr) {
+		return false
+	}
+	switch stripeErr.HTTPStatusCode {
+	case http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return stripeErr.HTTPStatusCode >= 400 && stripeErr.HTTPStatusCode < 500
+}
@@ -0,0 +1,34 @@
+package payout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestRefused(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"invalid request", &stripe.Error{HTTPStatusCode: http.StatusBadRequest}, true},
+		{"card declined", &stripe.Error{HTTPStatusCode: http.StatusPaymentRequired}, true},
+		{"unknown account", fmt.Errorf("transfer: %w", &stripe.Error{HTTPStatusCode: http.StatusNotFound}), true},
+		{"idempotency conflict", &stripe.Error{HTTPStatusCode: http.StatusConflict}, false},
+		{"rate limited", &stripe.Error{HTTPStatusCode: http.StatusTooManyRequests}, false},
+		{"server error", &stripe.Error{HTTPStatusCode: http.StatusInternalServerError}, false},
+		{"network error", errors.New("read tcp: i/o timeout"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := refused(tc.err); got != tc.want {
+				t.Errorf("refused(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package policy
+
+const (
+	PermUsersView        = "users.view"
+	PermUsersCreate      = "users.create"
+	PermUsersEdit        = "users.edit"
+	PermUsersEditBalance = "users.edit_balance"
+	PermUsersDelete      = "users.delete"
+	PermUsersUnlock      = "users.unlock"
+	PermUsersAssignRoles = "users.assign_roles"
+
+	PermRolesManage = "roles.manage"
+
+	PermProductsManage  = "products.manage"
+	PermAddressesManage = "addresses.manage"
+	PermPaymentsManage  = "payments.manage"
+
+	PermTransactionsViewAll        = "transactions.view_all"
+	PermTransactionsManage         = "transactions.manage"
+	PermTransactionsDelete         = "transactions.delete"
+	PermTransactionsRefund         = "transactions.refund"
+	PermTransactionsResolveDispute = "transactions.resolve_dispute"
+
+	PermWithdrawalsViewAll     = "withdrawals.view_all"
+	PermWithdrawalsApprove     = "withdrawals.approve"
+	PermWithdrawalsPayout      = "withdrawals.payout"
+	PermWithdrawalsDelete      = "withdrawals.delete"
+	PermWithdrawalsManageRules = "withdrawals.manage_rules"
+	PermPayoutBatchesManage    = "payout_batches.manage"
+
+	PermLedgerViewAll   = "ledger.view_all"
+	PermLedgerReconcile = "ledger.reconcile"
+
+	PermFeesManage          = "fees.manage"
+	PermExchangeRatesManage = "exchange_rates.manage"
+
+	PermFilesViewAll = "files.view_all"
+	PermFilesDelete  = "files.delete"
+
+	PermSecurityEventsView = "security_events.view"
+	PermAuditView          = "audit.view"
+)
+
+// Permissions describes every permission a role may grant.
+var Permissions = map[string]string{
+	PermUsersView:        "List and view any user",
+	PermUsersCreate:      "Create users",
+	PermUsersEdit:        "Edit any user's profile, status and password",
+	PermUsersEditBalance: "Adjust user balances and wallets",
+	PermUsersDelete:      "Delete users",
+	PermUsersUnlock:      "Clear login lockouts",
+	PermUsersAssignRoles: "Assign roles to users",
+
+	PermRolesManage: "Create, edit and delete custom roles",
+
+	PermProductsManage:  "View, edit and delete any product",
+	PermAddressesManage: "View, edit and delete any address",
+	PermPaymentsManage:  "View, edit and delete any payment method",
+
+	PermTransactionsViewAll:        "List and view any transaction",
+	PermTransactionsManage:         "Create transactions for other users and move any transaction between statuses",
+	PermTransactionsDelete:         "Delete transactions",
+	PermTransactionsRefund:         "Refund transactions",
+	PermTransactionsResolveDispute: "View every dispute and resolve them",
+
+	PermWithdrawalsViewAll:     "List and view any withdrawal",
+	PermWithdrawalsApprove:     "Approve, reject and edit withdrawals, including for other users",
+	PermWithdrawalsPayout:      "Pay out approved withdrawals",
+	PermWithdrawalsDelete:      "Delete withdrawals",
+	PermWithdrawalsManageRules: "Change withdrawal limits and rules",
+	PermPayoutBatchesManage:    "Create, download and settle payout batches",
+
+	PermLedgerViewAll:   "View every ledger entry",
+	PermLedgerReconcile: "Reconcile balances against the ledger",
+
+	PermFeesManage:          "Manage fee schedules",
+	PermExchangeRatesManage: "Manage exchange rates",
+
+	PermFilesViewAll: "List every uploaded file",
+	PermFilesDelete:  "Delete files",
+
+	PermSecurityEventsView: "View security events",
+	PermAuditView:          "View the audit log",
+}
@@ -0,0 +1,210 @@
+// Package policy decides who may do what to which record. Can is a pure
+// function of an Actor, an action and a resource, so every rule can be
+// checked against a table of cases without a database or an HTTP request.
+package policy
+
+const (
+	// ActionList means listing every record rather than only the actor's own.
+	ActionList   = "list"
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	// ActionManage covers the fields only staff may set, such as status or
+	// the owner, and acting on behalf of another user.
+	ActionManage = "manage"
+	// ActionRemove is the owner-facing soft delete; ActionDelete removes the
+	// record for good.
+	ActionRemove = "remove"
+	ActionDelete = "delete"
+
+	ActionChangePassword = "change_password"
+	ActionEditBalance    = "edit_balance"
+	ActionChangeType     = "change_type"
+	ActionUnlock         = "unlock"
+	ActionAssignRoles    = "assign_roles"
+
+	ActionApprove = "approve"
+	ActionPayout  = "payout"
+
+	ActionPay     = "pay"
+	ActionRefund  = "refund"
+	ActionResolve = "resolve"
+)
+
+// Actor is the user asking, with the permissions their roles grant.
+type Actor struct {
+	User_id     string
+	Permissions map[string]bool
+}
+
+func (a Actor) Has(permission string) bool {
+	return a.Permissions[permission]
+}
+
+// IsSuperuser reports whether the actor holds every permission there is.
+func (a Actor) IsSuperuser() bool {
+	for permission := range Permissions {
+		if !a.Permissions[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// Resource is one of the record types below. Build them from models with
+// the constructors in resources.go.
+type Resource interface {
+	Kind() string
+}
+
+type rule func(actor Actor, resource Resource) bool
+
+// rules maps a resource kind and an action to the rule deciding it. An
+// action missing from the table is always denied.
+var rules = map[string]map[string]rule{
+	KindUser: {
+		ActionList:           permission(PermUsersView),
+		ActionRead:           anyOf(owner, permission(PermUsersView)),
+		ActionCreate:         permission(PermUsersCreate),
+		ActionUpdate:         anyOf(activeOwner, permission(PermUsersEdit)),
+		ActionManage:         permission(PermUsersEdit),
+		ActionChangePassword: anyOf(owner, permission(PermUsersEdit)),
+		ActionEditBalance:    permission(PermUsersEditBalance),
+		ActionChangeType:     superuser,
+		ActionUnlock:         permission(PermUsersUnlock),
+		ActionAssignRoles:    permission(PermUsersAssignRoles),
+		ActionDelete:         permission(PermUsersDelete),
+	},
+	KindProduct: {
+		ActionList:   permission(PermProductsManage),
+		ActionRead:   anyOf(activeOwner, party, permission(PermProductsManage)),
+		ActionCreate: anyOf(owner, permission(PermProductsManage)),
+		ActionUpdate: anyOf(activeOwner, permission(PermProductsManage)),
+		ActionManage: permission(PermProductsManage),
+		ActionRemove: anyOf(activeOwner, permission(PermProductsManage)),
+		ActionDelete: permission(PermProductsManage),
+	},
+	KindAddress: {
+		ActionList:   permission(PermAddressesManage),
+		ActionRead:   anyOf(activeOwner, party, permission(PermAddressesManage)),
+		ActionCreate: anyOf(owner, permission(PermAddressesManage)),
+		ActionUpdate: anyOf(activeOwner, permission(PermAddressesManage)),
+		ActionManage: permission(PermAddressesManage),
+		ActionRemove: anyOf(activeOwner, permission(PermAddressesManage)),
+		ActionDelete: permission(PermAddressesManage),
+	},
+	KindPayment: {
+		ActionList:   permission(PermPaymentsManage),
+		ActionRead:   anyOf(owner, permission(PermPaymentsManage)),
+		ActionCreate: anyOf(owner, permission(PermPaymentsManage)),
+		ActionUpdate: anyOf(activeOwner, permission(PermPaymentsManage)),
+		ActionManage: permission(PermPaymentsManage),
+		ActionDelete: permission(PermPaymentsManage),
+	},
+	KindWithdrawal: {
+		ActionList:    permission(PermWithdrawalsViewAll),
+		ActionRead:    anyOf(owner, permission(PermWithdrawalsViewAll)),
+		ActionCreate:  anyOf(owner, permission(PermWithdrawalsApprove)),
+		ActionUpdate:  anyOf(owner, permission(PermWithdrawalsApprove)),
+		ActionManage:  permission(PermWithdrawalsApprove),
+		ActionApprove: permission(PermWithdrawalsApprove),
+		ActionPayout:  permission(PermWithdrawalsPayout),
+		ActionDelete:  permission(PermWithdrawalsDelete),
+	},
+	KindTransaction: {
+		ActionList:    permission(PermTransactionsViewAll),
+		ActionRead:    anyOf(party, permission(PermTransactionsViewAll)),
+		ActionCreate:  anyOf(owner, permission(PermTransactionsManage)),
+		ActionUpdate:  anyOf(party, permission(PermTransactionsManage)),
+		ActionManage:  permission(PermTransactionsManage),
+		ActionPay:     buyer,
+		ActionRefund:  permission(PermTransactionsRefund),
+		ActionResolve: permission(PermTransactionsResolveDispute),
+		ActionDelete:  permission(PermTransactionsDelete),
+	},
+	KindFile: {
+		ActionList:   permission(PermFilesViewAll),
+		ActionRead:   anyOf(owner, party, public, permission(PermFilesViewAll)),
+		ActionCreate: signedIn,
+		ActionDelete: permission(PermFilesDelete),
+	},
+}
+
+// Can reports whether actor may perform action on resource. Signed-out
+// actors are never allowed anything.
+func Can(actor Actor, action string, resource Resource) bool {
+	if actor.User_id == "" || resource == nil {
+		return false
+	}
+	decide, ok := rules[resource.Kind()][action]
+	if !ok {
+		return false
+	}
+	return decide(actor, resource)
+}
+
+func permission(name string) rule {
+	return func(actor Actor, resource Resource) bool {
+		return actor.Has(name)
+	}
+}
+
+func anyOf(options ...rule) rule {
+	return func(actor Actor, resource Resource) bool {
+		for _, option := range options {
+			if option(actor, resource) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func signedIn(actor Actor, resource Resource) bool {
+	return actor.User_id != ""
+}
+
+func superuser(actor Actor, resource Resource) bool {
+	return actor.IsSuperuser()
+}
+
+func owner(actor Actor, resource Resource) bool {
+	if r, ok := resource.(owned); ok {
+		return r.ownerId() != "" && r.ownerId() == actor.User_id
+	}
+	return false
+}
+
+// activeOwner is owner, but only while the record has not been disabled or
+// removed.
+func activeOwner(actor Actor, resource Resource) bool {
+	if r, ok := resource.(owned); ok {
+		return owner(actor, resource) && r.isActive()
+	}
+	return false
+}
+
+func party(actor Actor, resource Resource) bool {
+	if r, ok := resource.(involving); ok {
+		for _, id := range r.partyIds() {
+			if id != "" && id == actor.User_id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func buyer(actor Actor, resource Resource) bool {
+	if r, ok := resource.(Transaction); ok {
+		return r.Buyer_id != "" && r.Buyer_id == actor.User_id
+	}
+	return false
+}
+
+func public(actor Actor, resource Resource) bool {
+	if r, ok := resource.(File); ok {
+		return r.Public
+	}
+	return false
+}
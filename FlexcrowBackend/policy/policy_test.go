@@ -0,0 +1,271 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func actorFor(userId string, permissions ...string) Actor {
+	actor := Actor{User_id: userId, Permissions: map[string]bool{}}
+	for _, permission := range permissions {
+		actor.Permissions[permission] = true
+	}
+	return actor
+}
+
+func staff(permissions ...string) Actor {
+	return actorFor("staff", permissions...)
+}
+
+func root() Actor {
+	actor := actorFor("root")
+	for permission := range Permissions {
+		actor.Permissions[permission] = true
+	}
+	return actor
+}
+
+// almostRoot holds every permission but one, so it is not a superuser.
+func almostRoot() Actor {
+	actor := root()
+	actor.User_id = "almost_root"
+	delete(actor.Permissions, PermAuditView)
+	return actor
+}
+
+var (
+	ownerUser = actorFor("owner")
+	buyerUser = actorFor("buyer")
+	stranger  = actorFor("stranger")
+	signedOut = Actor{Permissions: root().Permissions}
+)
+
+type policyCase struct {
+	name     string
+	actor    Actor
+	action   string
+	resource Resource
+	allowed  bool
+}
+
+// ownedListingCases covers products and addresses, which share their rules:
+// the buyer or seller on the other side of a transaction may read them.
+func ownedListingCases(kind string, active Resource, removed Resource, manage string) []policyCase {
+	return []policyCase{
+		{kind + " list by staff", staff(manage), ActionList, active, true},
+		{kind + " list by owner", ownerUser, ActionList, active, false},
+
+		{kind + " read by owner", ownerUser, ActionRead, active, true},
+		{kind + " read by party", buyerUser, ActionRead, active, true},
+		{kind + " read by party after removal", buyerUser, ActionRead, removed, true},
+		{kind + " read by owner after removal", ownerUser, ActionRead, removed, false},
+		{kind + " read by staff", staff(manage), ActionRead, removed, true},
+		{kind + " read by stranger", stranger, ActionRead, active, false},
+
+		{kind + " create by owner", ownerUser, ActionCreate, active, true},
+		{kind + " create for someone else", stranger, ActionCreate, active, false},
+		{kind + " create by staff", staff(manage), ActionCreate, active, true},
+
+		{kind + " update by owner", ownerUser, ActionUpdate, active, true},
+		{kind + " update by owner after removal", ownerUser, ActionUpdate, removed, false},
+		{kind + " update by party", buyerUser, ActionUpdate, active, false},
+		{kind + " update by staff", staff(manage), ActionUpdate, removed, true},
+
+		{kind + " manage by staff", staff(manage), ActionManage, active, true},
+		{kind + " manage by owner", ownerUser, ActionManage, active, false},
+
+		{kind + " remove by owner", ownerUser, ActionRemove, active, true},
+		{kind + " remove by owner twice", ownerUser, ActionRemove, removed, false},
+		{kind + " remove by party", buyerUser, ActionRemove, active, false},
+		{kind + " remove by staff", staff(manage), ActionRemove, active, true},
+
+		{kind + " delete by staff", staff(manage), ActionDelete, active, true},
+		{kind + " delete by owner", ownerUser, ActionDelete, active, false},
+	}
+}
+
+func policyCases() []policyCase {
+	activeUser := User{User_id: "owner", Active: true}
+	disabledUser := User{User_id: "owner", Active: false}
+
+	activePayment := Payment{Owner_id: "owner", Active: true}
+	inactivePayment := Payment{Owner_id: "owner", Active: false}
+
+	withdrawal := Withdrawal{Owner_id: "owner"}
+	transaction := Transaction{Seller_id: "owner", Buyer_id: "buyer"}
+
+	privateFile := File{Owner_id: "owner", Party_ids: []string{"buyer"}}
+	publicFile := File{Owner_id: "owner", Public: true}
+
+	cases := []policyCase{
+		{"user list by staff", staff(PermUsersView), ActionList, activeUser, true},
+		{"user list by user", ownerUser, ActionList, activeUser, false},
+		{"user read self", ownerUser, ActionRead, activeUser, true},
+		{"user read by staff", staff(PermUsersView), ActionRead, activeUser, true},
+		{"user read other", stranger, ActionRead, activeUser, false},
+		{"user create by staff", staff(PermUsersCreate), ActionCreate, activeUser, true},
+		{"user create by user", stranger, ActionCreate, activeUser, false},
+		{"user update self", ownerUser, ActionUpdate, activeUser, true},
+		{"user update self while disabled", ownerUser, ActionUpdate, disabledUser, false},
+		{"user update by staff", staff(PermUsersEdit), ActionUpdate, disabledUser, true},
+		{"user update other", stranger, ActionUpdate, activeUser, false},
+		{"user manage by staff", staff(PermUsersEdit), ActionManage, activeUser, true},
+		{"user manage self", ownerUser, ActionManage, activeUser, false},
+		{"user change own password", ownerUser, ActionChangePassword, activeUser, true},
+		{"user change password by staff", staff(PermUsersEdit), ActionChangePassword, activeUser, true},
+		{"user change other's password", stranger, ActionChangePassword, activeUser, false},
+		{"user edit balance by staff", staff(PermUsersEditBalance), ActionEditBalance, activeUser, true},
+		{"user edit balance with only edit", staff(PermUsersEdit), ActionEditBalance, activeUser, false},
+		{"user edit own balance", ownerUser, ActionEditBalance, activeUser, false},
+		{"user change type by superuser", root(), ActionChangeType, activeUser, true},
+		{"user change type missing one permission", almostRoot(), ActionChangeType, activeUser, false},
+		{"user change type by staff", staff(PermUsersEdit), ActionChangeType, activeUser, false},
+		{"user unlock by staff", staff(PermUsersUnlock), ActionUnlock, activeUser, true},
+		{"user unlock self", ownerUser, ActionUnlock, activeUser, false},
+		{"user assign roles by staff", staff(PermUsersAssignRoles), ActionAssignRoles, activeUser, true},
+		{"user assign roles with only roles.manage", staff(PermRolesManage), ActionAssignRoles, activeUser, false},
+		{"user delete by staff", staff(PermUsersDelete), ActionDelete, activeUser, true},
+		{"user delete self", ownerUser, ActionDelete, activeUser, false},
+		{"user remove is not a rule", root(), ActionRemove, activeUser, false},
+
+		{"payment list by staff", staff(PermPaymentsManage), ActionList, activePayment, true},
+		{"payment list by owner", ownerUser, ActionList, activePayment, false},
+		{"payment read by owner", ownerUser, ActionRead, inactivePayment, true},
+		{"payment read by staff", staff(PermPaymentsManage), ActionRead, activePayment, true},
+		{"payment read by stranger", stranger, ActionRead, activePayment, false},
+		{"payment create by owner", ownerUser, ActionCreate, activePayment, true},
+		{"payment create for someone else", stranger, ActionCreate, activePayment, false},
+		{"payment update by owner", ownerUser, ActionUpdate, activePayment, true},
+		{"payment update by owner once inactive", ownerUser, ActionUpdate, inactivePayment, false},
+		{"payment update by staff", staff(PermPaymentsManage), ActionUpdate, inactivePayment, true},
+		{"payment manage by staff", staff(PermPaymentsManage), ActionManage, activePayment, true},
+		{"payment manage by owner", ownerUser, ActionManage, activePayment, false},
+		{"payment delete by staff", staff(PermPaymentsManage), ActionDelete, activePayment, true},
+		{"payment delete by owner", ownerUser, ActionDelete, activePayment, false},
+		{"payment remove is not a rule", ownerUser, ActionRemove, activePayment, false},
+
+		{"withdrawal list by staff", staff(PermWithdrawalsViewAll), ActionList, withdrawal, true},
+		{"withdrawal list by owner", ownerUser, ActionList, withdrawal, false},
+		{"withdrawal read by owner", ownerUser, ActionRead, withdrawal, true},
+		{"withdrawal read by staff", staff(PermWithdrawalsViewAll), ActionRead, withdrawal, true},
+		{"withdrawal read by stranger", stranger, ActionRead, withdrawal, false},
+		{"withdrawal create by owner", ownerUser, ActionCreate, withdrawal, true},
+		{"withdrawal create by approver", staff(PermWithdrawalsApprove), ActionCreate, withdrawal, true},
+		{"withdrawal create for someone else", stranger, ActionCreate, withdrawal, false},
+		{"withdrawal update by owner", ownerUser, ActionUpdate, withdrawal, true},
+		{"withdrawal update by approver", staff(PermWithdrawalsApprove), ActionUpdate, withdrawal, true},
+		{"withdrawal update by viewer", staff(PermWithdrawalsViewAll), ActionUpdate, withdrawal, false},
+		{"withdrawal manage by approver", staff(PermWithdrawalsApprove), ActionManage, withdrawal, true},
+		{"withdrawal manage by owner", ownerUser, ActionManage, withdrawal, false},
+		{"withdrawal approve by approver", staff(PermWithdrawalsApprove), ActionApprove, withdrawal, true},
+		{"withdrawal approve by owner", ownerUser, ActionApprove, withdrawal, false},
+		{"withdrawal approve by payer", staff(PermWithdrawalsPayout), ActionApprove, withdrawal, false},
+		{"withdrawal payout by payer", staff(PermWithdrawalsPayout), ActionPayout, withdrawal, true},
+		{"withdrawal payout by approver", staff(PermWithdrawalsApprove), ActionPayout, withdrawal, false},
+		{"withdrawal delete by staff", staff(PermWithdrawalsDelete), ActionDelete, withdrawal, true},
+		{"withdrawal delete by owner", ownerUser, ActionDelete, withdrawal, false},
+
+		{"transaction list by staff", staff(PermTransactionsViewAll), ActionList, transaction, true},
+		{"transaction list by seller", ownerUser, ActionList, transaction, false},
+		{"transaction read by seller", ownerUser, ActionRead, transaction, true},
+		{"transaction read by buyer", buyerUser, ActionRead, transaction, true},
+		{"transaction read by staff", staff(PermTransactionsViewAll), ActionRead, transaction, true},
+		{"transaction read by stranger", stranger, ActionRead, transaction, false},
+		{"transaction create as seller", ownerUser, ActionCreate, transaction, true},
+		{"transaction create for another seller", buyerUser, ActionCreate, transaction, false},
+		{"transaction create by staff", staff(PermTransactionsManage), ActionCreate, transaction, true},
+		{"transaction update by seller", ownerUser, ActionUpdate, transaction, true},
+		{"transaction update by buyer", buyerUser, ActionUpdate, transaction, true},
+		{"transaction update by staff", staff(PermTransactionsManage), ActionUpdate, transaction, true},
+		{"transaction update by viewer", staff(PermTransactionsViewAll), ActionUpdate, transaction, false},
+		{"transaction update by stranger", stranger, ActionUpdate, transaction, false},
+		{"transaction manage by staff", staff(PermTransactionsManage), ActionManage, transaction, true},
+		{"transaction manage by seller", ownerUser, ActionManage, transaction, false},
+		{"transaction pay by buyer", buyerUser, ActionPay, transaction, true},
+		{"transaction pay by seller", ownerUser, ActionPay, transaction, false},
+		{"transaction pay by superuser", root(), ActionPay, transaction, false},
+		{"transaction pay with no buyer", actorFor(""), ActionPay, Transaction{Seller_id: "owner"}, false},
+		{"transaction refund by staff", staff(PermTransactionsRefund), ActionRefund, transaction, true},
+		{"transaction refund by seller", ownerUser, ActionRefund, transaction, false},
+		{"transaction resolve by staff", staff(PermTransactionsResolveDispute), ActionResolve, transaction, true},
+		{"transaction resolve by buyer", buyerUser, ActionResolve, transaction, false},
+		{"transaction delete by staff", staff(PermTransactionsDelete), ActionDelete, transaction, true},
+		{"transaction delete by seller", ownerUser, ActionDelete, transaction, false},
+
+		{"file list by staff", staff(PermFilesViewAll), ActionList, privateFile, true},
+		{"file list by owner", ownerUser, ActionList, privateFile, false},
+		{"file read by owner", ownerUser, ActionRead, privateFile, true},
+		{"file read by party", buyerUser, ActionRead, privateFile, true},
+		{"file read public", stranger, ActionRead, publicFile, true},
+		{"file read private", stranger, ActionRead, privateFile, false},
+		{"file read by staff", staff(PermFilesViewAll), ActionRead, privateFile, true},
+		{"file create", stranger, ActionCreate, File{}, true},
+		{"file create signed out", signedOut, ActionCreate, File{}, false},
+		{"file delete by staff", staff(PermFilesDelete), ActionDelete, privateFile, true},
+		{"file delete by owner", ownerUser, ActionDelete, privateFile, false},
+
+		{"signed out superuser", signedOut, ActionRead, publicFile, false},
+		{"nil resource", root(), ActionRead, nil, false},
+		{"unknown action", root(), "launch", transaction, false},
+	}
+
+	cases = append(cases, ownedListingCases("product",
+		Product{Owner_id: "owner", Active: true, Party_ids: []string{"buyer"}},
+		Product{Owner_id: "owner", Active: false, Party_ids: []string{"buyer"}},
+		PermProductsManage)...)
+	cases = append(cases, ownedListingCases("address",
+		Address{Owner_id: "owner", Active: true, Party_ids: []string{"buyer"}},
+		Address{Owner_id: "owner", Active: false, Party_ids: []string{"buyer"}},
+		PermAddressesManage)...)
+	return cases
+}
+
+func TestCan(t *testing.T) {
+	for _, test := range policyCases() {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Can(test.actor, test.action, test.resource); got != test.allowed {
+				t.Errorf("Can(%s, %s, %+v) = %v, want %v", test.actor.User_id, test.action, test.resource, got, test.allowed)
+			}
+		})
+	}
+}
+
+// TestEveryRuleIsCovered fails when a rule is added without cases that
+// show it both allowing and denying.
+func TestEveryRuleIsCovered(t *testing.T) {
+	covered := map[string]map[bool]bool{}
+	for _, test := range policyCases() {
+		if test.resource == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s %s", test.resource.Kind(), test.action)
+		if covered[key] == nil {
+			covered[key] = map[bool]bool{}
+		}
+		covered[key][test.allowed] = true
+	}
+
+	for kind, actions := range rules {
+		for action := range actions {
+			key := fmt.Sprintf("%s %s", kind, action)
+			if !covered[key][true] {
+				t.Errorf("no case allows %s", key)
+			}
+			if !covered[key][false] {
+				t.Errorf("no case denies %s", key)
+			}
+		}
+	}
+}
+
+func TestIsSuperuser(t *testing.T) {
+	if !root().IsSuperuser() {
+		t.Error("an actor with every permission is not a superuser")
+	}
+	if almostRoot().IsSuperuser() {
+		t.Error("an actor missing a permission is a superuser")
+	}
+	if (Actor{User_id: "nobody"}).IsSuperuser() {
+		t.Error("an actor with no permissions is a superuser")
+	}
+}
@@ -0,0 +1,137 @@
+package policy
+
+import "user-athentication-golang/models"
+
+const (
+	KindUser        = "user"
+	KindProduct     = "product"
+	KindAddress     = "address"
+	KindPayment     = "payment"
+	KindWithdrawal  = "withdrawal"
+	KindTransaction = "transaction"
+	KindFile        = "file"
+)
+
+// owned is a resource with a single owning user.
+type owned interface {
+	ownerId() string
+	isActive() bool
+}
+
+// involving is a resource other users take part in, such as the buyer of a
+// product or the seller shipping to an address.
+type involving interface {
+	partyIds() []string
+}
+
+type User struct {
+	User_id string
+	Active  bool
+}
+
+func (User) Kind() string          { return KindUser }
+func (r User) ownerId() string     { return r.User_id }
+func (r User) isActive() bool      { return r.Active }
+func UserOf(user models.User) User { return User{User_id: user.User_id, Active: active(user.Status)} }
+
+// Product lists in Party_ids the users holding a transaction for it.
+type Product struct {
+	Owner_id  string
+	Active    bool
+	Party_ids []string
+}
+
+func (Product) Kind() string         { return KindProduct }
+func (r Product) ownerId() string    { return r.Owner_id }
+func (r Product) isActive() bool     { return r.Active }
+func (r Product) partyIds() []string { return r.Party_ids }
+
+func ProductOf(product models.Product, partyIds ...string) Product {
+	return Product{Owner_id: value(product.User_id), Active: active(product.Status), Party_ids: partyIds}
+}
+
+// Address lists in Party_ids the sellers who ship to it.
+type Address struct {
+	Owner_id  string
+	Active    bool
+	Party_ids []string
+}
+
+func (Address) Kind() string         { return KindAddress }
+func (r Address) ownerId() string    { return r.Owner_id }
+func (r Address) isActive() bool     { return r.Active }
+func (r Address) partyIds() []string { return r.Party_ids }
+
+func AddressOf(address models.Address, partyIds ...string) Address {
+	return Address{Owner_id: value(address.User_id), Active: active(address.Status), Party_ids: partyIds}
+}
+
+type Payment struct {
+	Owner_id string
+	Active   bool
+}
+
+func (Payment) Kind() string      { return KindPayment }
+func (r Payment) ownerId() string { return r.Owner_id }
+func (r Payment) isActive() bool  { return r.Active }
+
+func PaymentOf(payment models.Payment) Payment {
+	return Payment{Owner_id: value(payment.User_id), Active: active(payment.Status)}
+}
+
+type Withdrawal struct {
+	Owner_id string
+}
+
+func (Withdrawal) Kind() string      { return KindWithdrawal }
+func (r Withdrawal) ownerId() string { return r.Owner_id }
+func (r Withdrawal) isActive() bool  { return true }
+
+func WithdrawalOf(withdrawal models.Withdrawal) Withdrawal {
+	return Withdrawal{Owner_id: value(withdrawal.User_id)}
+}
+
+// Transaction is owned by its seller; the buyer takes part in it.
+type Transaction struct {
+	Seller_id string
+	Buyer_id  string
+}
+
+func (Transaction) Kind() string         { return KindTransaction }
+func (r Transaction) ownerId() string    { return r.Seller_id }
+func (r Transaction) isActive() bool     { return true }
+func (r Transaction) partyIds() []string { return []string{r.Seller_id, r.Buyer_id} }
+
+func TransactionOf(transaction models.Transaction) Transaction {
+	return Transaction{Seller_id: value(transaction.User_id), Buyer_id: value(transaction.Customer_id)}
+}
+
+// File is Public when it is shown on a product or profile, and lists in
+// Party_ids the users of the transactions and disputes it is attached to.
+type File struct {
+	Owner_id  string
+	Public    bool
+	Party_ids []string
+}
+
+// FileOf treats files uploaded before uploads recorded their owner as
+// public, like product and profile images.
+func FileOf(file models.File, public bool, partyIds ...string) File {
+	return File{Owner_id: value(file.User_id), Public: public || file.User_id == nil, Party_ids: partyIds}
+}
+
+func (File) Kind() string         { return KindFile }
+func (r File) ownerId() string    { return r.Owner_id }
+func (r File) isActive() bool     { return true }
+func (r File) partyIds() []string { return r.Party_ids }
+
+func active(status *int) bool {
+	return status == nil || *status == 1
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,42 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Fake records refunds in memory instead of calling a processor. Set Err to
+// make the next refunds fail.
+type Fake struct {
+	mu       sync.Mutex
+	Requests []Request
+	Err      error
+	results  map[string]Result
+}
+
+func NewFake() *Fake {
+	return &Fake{results: map[string]Result{}}
+}
+
+func (f *Fake) Refund(ctx context.Context, request Request) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+	if request.Provider_reference == "" {
+		return Result{}, errors.New("payment has no provider reference")
+	}
+
+	if result, ok := f.results[request.Idempotency_key]; ok {
+		return result, nil
+	}
+
+	f.Requests = append(f.Requests, request)
+	result := Result{Reference: fmt.Sprintf("re_fake_%d", len(f.Requests)), Status: "succeeded"}
+	f.results[request.Idempotency_key] = result
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"user-athentication-golang/models"
+)
+
+func TestFakeRefundIsIdempotent(t *testing.T) {
+	fake := NewFake()
+	request := Request{Provider_reference: "pi_1", Amount: models.NewMoney(500, "THB"), Idempotency_key: "refund_1"}
+
+	first, err := fake.Refund(context.Background(), request)
+	if err != nil {
+		t.Fatalf("first refund: %v", err)
+	}
+	second, err := fake.Refund(context.Background(), request)
+	if err != nil {
+		t.Fatalf("retried refund: %v", err)
+	}
+
+	if first != second {
+		t.Errorf("retry returned %+v, want %+v", second, first)
+	}
+	if len(fake.Requests) != 1 {
+		t.Errorf("fake recorded %d refunds, want 1", len(fake.Requests))
+	}
+}
+
+func TestFakeRefundErrors(t *testing.T) {
+	fake := NewFake()
+
+	if _, err := fake.Refund(context.Background(), Request{Idempotency_key: "refund_1"}); err == nil {
+		t.Error("refund without a provider reference succeeded")
+	}
+
+	fake.Err = errors.New("card_declined")
+	if _, err := fake.Refund(context.Background(), Request{Provider_reference: "pi_1", Idempotency_key: "refund_2"}); err != fake.Err {
+		t.Errorf("refund returned %v, want %v", err, fake.Err)
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("fake recorded %d refunds, want none", len(fake.Requests))
+	}
+}
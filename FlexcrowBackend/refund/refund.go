@@ -0,0 +1,62 @@
+package refund
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"user-athentication-golang/models"
+)
+
+// Request asks the card processor to return part or all of a captured
+// payment. Idempotency_key is the refund Payment's ID, so retrying the same
+// refund never returns the money twice.
+type Request struct {
+	Provider_reference string
+	Amount             models.Money
+	Idempotency_key    string
+	Reason             string
+}
+
+type Result struct {
+	Reference string
+	Status    string
+}
+
+type Refunder interface {
+	Refund(ctx context.Context, request Request) (Result, error)
+}
+
+var (
+	mu       sync.RWMutex
+	provider Refunder
+)
+
+// Provider returns the configured refunder: Stripe unless REFUND_PROVIDER is
+// set to "fake".
+func Provider() Refunder {
+	mu.RLock()
+	current := provider
+	mu.RUnlock()
+	if current != nil {
+		return current
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		if os.Getenv("REFUND_PROVIDER") == "fake" {
+			provider = NewFake()
+		} else {
+			provider = NewStripe(os.Getenv("STRIPE_SECRET_KEY"))
+		}
+	}
+	return provider
+}
+
+// SetProvider swaps the refunder, for tests and local development.
+func SetProvider(refunder Refunder) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = refunder
+}
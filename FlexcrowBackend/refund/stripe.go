@@ -0,0 +1,46 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/client"
+)
+
+type Stripe struct {
+	api *client.API
+}
+
+func NewStripe(secretKey string) *Stripe {
+	if secretKey == "" {
+		return &Stripe{}
+	}
+	return &Stripe{api: client.New(secretKey, nil)}
+}
+
+func (s *Stripe) Refund(ctx context.Context, request Request) (Result, error) {
+	if s.api == nil {
+		return Result{}, errors.New("Stripe secret key not configured")
+	}
+
+	// Stripe only takes one of its own reason codes; ours goes in metadata.
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(request.Provider_reference),
+		Amount:        stripe.Int64(request.Amount.Amount),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	if request.Reason != "" {
+		params.AddMetadata("reason", request.Reason)
+	}
+	params.Context = ctx
+	params.SetIdempotencyKey(request.Idempotency_key)
+
+	refund, err := s.api.Refunds.New(params)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Reference: refund.ID, Status: strings.ToLower(string(refund.Status))}, nil
+}
@@ -9,4 +9,10 @@ import (
 func AuthRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("/users/signup", controller.SignUp())
 	incomingRoutes.POST("/users/login", controller.Login())
+	incomingRoutes.POST("/users/login/2fa", controller.LoginTotp())
+	incomingRoutes.POST("/users/refresh", controller.RefreshToken())
+	incomingRoutes.POST("/users/verify-email", controller.VerifyEmail())
+	incomingRoutes.POST("/users/verify-email/resend", controller.ResendVerificationEmail())
+	incomingRoutes.POST("/users/forgot-password", controller.ForgotPassword())
+	incomingRoutes.POST("/users/reset-password", controller.ResetPassword())
 }
@@ -4,6 +4,7 @@ import (
 	"user-athentication-golang/controllers"
 	controller "user-athentication-golang/controllers"
 	"user-athentication-golang/middleware"
+	"user-athentication-golang/policy"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,49 +16,101 @@ func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/auth/verify", controller.VerifyAdmin())
 	incomingRoutes.GET("/auth/data", controller.GetCurrentUserData())
 
-	incomingRoutes.GET("/users", controller.GetUsers())
+	incomingRoutes.POST("/users/logout", controller.Logout())
+	incomingRoutes.GET("/sessions", controller.GetSessions())
+	incomingRoutes.DELETE("/sessions/:session_id", controller.RevokeSession())
+	incomingRoutes.DELETE("/sessions", controller.RevokeAllSessions())
+
+	incomingRoutes.POST("/users/2fa/setup", controller.SetupTotp())
+	incomingRoutes.POST("/users/2fa/enable", controller.EnableTotp())
+	incomingRoutes.POST("/users/2fa/disable", controller.DisableTotp())
+	incomingRoutes.POST("/users/2fa/recovery-codes", controller.RegenerateRecoveryCodes())
+
+	incomingRoutes.GET("/users", middleware.RequirePermission(policy.PermUsersView), controller.GetUsers())
 	incomingRoutes.GET("/users/:user_id", controller.GetUser())
-	incomingRoutes.POST("/users", controller.CreateUser())
+	incomingRoutes.POST("/users", middleware.RequirePermission(policy.PermUsersCreate), controller.CreateUser())
 	incomingRoutes.PUT("/users/:user_id", controller.UpdateUser())
-	incomingRoutes.DELETE("/users/:user_id", controller.DeleteUser())
+	incomingRoutes.DELETE("/users/:user_id", middleware.RequirePermission(policy.PermUsersDelete), controller.DeleteUser())
+	incomingRoutes.POST("/users/:user_id/unlock", middleware.RequirePermission(policy.PermUsersUnlock), controller.UnlockUser())
+	incomingRoutes.PUT("/users/:user_id/roles", middleware.RequirePermission(policy.PermUsersAssignRoles), controller.SetUserRoles())
 	incomingRoutes.GET("/users/username", controller.GetUsernameByID())
 
+	incomingRoutes.GET("/roles", middleware.RequirePermission(policy.PermUsersView), controller.GetRoles())
+	incomingRoutes.POST("/roles", middleware.RequirePermission(policy.PermRolesManage), controller.CreateRole())
+	incomingRoutes.PUT("/roles/:role_id", middleware.RequirePermission(policy.PermRolesManage), controller.UpdateRole())
+	incomingRoutes.DELETE("/roles/:role_id", middleware.RequirePermission(policy.PermRolesManage), controller.DeleteRole())
+
 	incomingRoutes.GET("/products", controller.GetProducts())
 	incomingRoutes.GET("/products/:product_id", controller.GetProduct())
 	incomingRoutes.POST("/products", controller.CreateProduct())
 	incomingRoutes.PUT("/products/:product_id", controller.UpdateProduct())
-	incomingRoutes.DELETE("/products/:product_id", controller.DeleteProduct())
+	incomingRoutes.DELETE("/products/:product_id", middleware.RequirePermission(policy.PermProductsManage), controller.DeleteProduct())
 	incomingRoutes.POST("/products/remove/:product_id", controller.RemoveProduct())
 
 	incomingRoutes.GET("/addresses", controller.GetAddresses())
 	incomingRoutes.GET("/addresses/:address_id", controller.GetAddress())
 	incomingRoutes.POST("/addresses", controller.CreateAddress())
 	incomingRoutes.PUT("/addresses/:address_id", controller.UpdateAddress())
-	incomingRoutes.DELETE("/addresses/:address_id", controller.DeleteAddress())
+	incomingRoutes.DELETE("/addresses/:address_id", middleware.RequirePermission(policy.PermAddressesManage), controller.DeleteAddress())
 	incomingRoutes.POST("/addresses/remove/:address_id", controller.RemoveAddress())
 
 	incomingRoutes.GET("/payments", controller.GetPayments())
 	incomingRoutes.GET("/payments/:payment_id", controller.GetPayment())
 	incomingRoutes.POST("/payments", controller.CreatePayment())
 	incomingRoutes.PUT("/payments/:payment_id", controller.UpdatePayment())
-	incomingRoutes.DELETE("/payments/:payment_id", controller.DeletePayment())
+	incomingRoutes.DELETE("/payments/:payment_id", middleware.RequirePermission(policy.PermPaymentsManage), controller.DeletePayment())
 
 	incomingRoutes.GET("/withdrawals", controller.GetWithdrawals())
 	incomingRoutes.GET("/withdrawals/:withdrawal_id", controller.GetWithdrawal())
 	incomingRoutes.POST("/withdrawals", controller.CreateWithdrawal())
 	incomingRoutes.PUT("/withdrawals/:withdrawal_id", controller.UpdateWithdrawal())
-	incomingRoutes.DELETE("/withdrawals/:withdrawal_id", controller.DeleteWithdrawal())
+	incomingRoutes.POST("/withdrawals/:withdrawal_id/payout", middleware.RequirePermission(policy.PermWithdrawalsPayout), controller.PayoutWithdrawal())
+	incomingRoutes.DELETE("/withdrawals/:withdrawal_id", middleware.RequirePermission(policy.PermWithdrawalsDelete), controller.DeleteWithdrawal())
+	incomingRoutes.GET("/withdrawal-rules", controller.GetWithdrawalRules())
+	incomingRoutes.PUT("/withdrawal-rules", middleware.RequirePermission(policy.PermWithdrawalsManageRules), controller.UpdateWithdrawalRules())
+
+	incomingRoutes.GET("/payout-batches", middleware.RequirePermission(policy.PermPayoutBatchesManage), controller.GetPayoutBatches())
+	incomingRoutes.GET("/payout-batches/:batch_id", middleware.RequirePermission(policy.PermPayoutBatchesManage), controller.GetPayoutBatch())
+	incomingRoutes.POST("/payout-batches", middleware.RequirePermission(policy.PermPayoutBatchesManage), controller.CreatePayoutBatch())
+	incomingRoutes.GET("/payout-batches/:batch_id/file", middleware.RequirePermission(policy.PermPayoutBatchesManage), controller.DownloadPayoutBatch())
+	incomingRoutes.POST("/payout-batches/:batch_id/result", middleware.RequirePermission(policy.PermPayoutBatchesManage), controller.UploadPayoutBatchResult())
 
 	incomingRoutes.GET("/transactions", controller.GetTransactions())
 	incomingRoutes.GET("/transactions/:transaction_id", controller.GetTransaction())
 	incomingRoutes.POST("/transactions", controller.CreateTransaction())
 	incomingRoutes.PUT("/transactions/:transaction_id", controller.UpdateTransaction())
-	incomingRoutes.DELETE("/transactions/:transaction_id", controller.DeleteTransaction())
+	incomingRoutes.DELETE("/transactions/:transaction_id", middleware.RequirePermission(policy.PermTransactionsDelete), controller.DeleteTransaction())
+	incomingRoutes.POST("/transactions/:transaction_id/refund", middleware.RequirePermission(policy.PermTransactionsRefund), controller.RefundTransaction())
+
+	incomingRoutes.GET("/disputes", controller.GetDisputes())
+	incomingRoutes.GET("/disputes/:dispute_id", controller.GetDispute())
+	incomingRoutes.POST("/disputes", controller.CreateDispute())
+	incomingRoutes.POST("/disputes/:dispute_id/messages", controller.AddDisputeMessage())
+	incomingRoutes.POST("/disputes/:dispute_id/resolve", middleware.RequirePermission(policy.PermTransactionsResolveDispute), controller.ResolveDispute())
+
+	incomingRoutes.GET("/security-events", middleware.RequirePermission(policy.PermSecurityEventsView), controller.GetSecurityEvents())
+	incomingRoutes.GET("/audit", middleware.RequirePermission(policy.PermAuditView), controller.GetAuditRecords())
+
+	incomingRoutes.GET("/ledger", controller.GetLedgerEntries())
+	incomingRoutes.POST("/ledger/reconcile", middleware.RequirePermission(policy.PermLedgerReconcile), controller.ReconcileBalances())
+
+	incomingRoutes.GET("/fee-schedules", middleware.RequirePermission(policy.PermFeesManage), controller.GetFeeSchedules())
+	incomingRoutes.GET("/fee-schedules/current", controller.GetCurrentFeeSchedule())
+	incomingRoutes.GET("/fee-schedules/:fee_schedule_id", controller.GetFeeSchedule())
+	incomingRoutes.POST("/fee-schedules", middleware.RequirePermission(policy.PermFeesManage), controller.CreateFeeSchedule())
+	incomingRoutes.PUT("/fee-schedules/:fee_schedule_id", middleware.RequirePermission(policy.PermFeesManage), controller.UpdateFeeSchedule())
+	incomingRoutes.DELETE("/fee-schedules/:fee_schedule_id", middleware.RequirePermission(policy.PermFeesManage), controller.DeleteFeeSchedule())
+
+	incomingRoutes.GET("/exchange-rates", controller.GetExchangeRates())
+	incomingRoutes.GET("/exchange-rates/current", controller.GetCurrentExchangeRate())
+	incomingRoutes.GET("/exchange-rates/:exchange_rate_id", controller.GetExchangeRate())
+	incomingRoutes.POST("/exchange-rates", middleware.RequirePermission(policy.PermExchangeRatesManage), controller.CreateExchangeRate())
+	incomingRoutes.DELETE("/exchange-rates/:exchange_rate_id", middleware.RequirePermission(policy.PermExchangeRatesManage), controller.DeleteExchangeRate())
 
 	incomingRoutes.POST("/upload", controllers.UploadFile())
-	incomingRoutes.GET("/files", controller.GetFiles())
+	incomingRoutes.GET("/files", middleware.RequirePermission(policy.PermFilesViewAll), controller.GetFiles())
 	incomingRoutes.GET("/files/:file_id", controllers.GetFile())
-	incomingRoutes.DELETE("/files/:file_id", controller.DeleteFile())
+	incomingRoutes.DELETE("/files/:file_id", middleware.RequirePermission(policy.PermFilesDelete), controller.DeleteFile())
 
 	incomingRoutes.PUT("/users/:user_id/password", controllers.UpdatePassword())
 
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	controller "user-athentication-golang/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WebhookRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/webhooks/stripe", controller.StripeWebhook())
+}
@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from RFC 6238 appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists eight-digit codes; authenticators show the last six.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := Code(rfcSecret, time.Unix(vector.unix, 0))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", vector.unix, err)
+		}
+		if code != vector.code {
+			t.Errorf("Code at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecret(t *testing.T) {
+	code, err := Code(strings.ToLower(rfcSecret), time.Unix(59, 0))
+	if err != nil || code != "287082" {
+		t.Errorf("Code = %q, %v, want 287082", code, err)
+	}
+}
+
+func TestCodeRejectsInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step := Step(at)
+
+	tests := []struct {
+		name  string
+		code  string
+		at    time.Time
+		step  int64
+		match bool
+	}{
+		{"current step", "050471", at, step, true},
+		{"spaces ignored", " 050 471 ", at, step, true},
+		{"one step behind", "050471", at.Add(Period * time.Second), step, true},
+		{"one step ahead", "050471", at.Add(-Period * time.Second), step, true},
+		{"two steps behind", "050471", at.Add(2 * Period * time.Second), 0, false},
+		{"two steps ahead", "050471", at.Add(-2 * Period * time.Second), 0, false},
+		{"wrong code", "050472", at, 0, false},
+		{"too short", "05047", at, 0, false},
+		{"too long", "0504710", at, 0, false},
+		{"empty", "", at, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Match(rfcSecret, test.code, test.at)
+			if ok != test.match || step != test.step {
+				t.Errorf("Match = %d, %v, want %d, %v", step, ok, test.step, test.match)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not unpadded base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret is %d bytes, want 20", len(key))
+	}
+
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if other == secret {
+		t.Error("two generated secrets are the same")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI(rfcSecret, "Flexcrow", "buyer@example.com"))
+	if err != nil {
+		t.Fatalf("parsing URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Flexcrow:buyer@example.com" {
+		t.Errorf("URI is %s", uri)
+	}
+
+	query := uri.Query()
+	expected := map[string]string{"secret": rfcSecret, "issuer": "Flexcrow", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
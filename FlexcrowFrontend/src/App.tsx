@@ -13,6 +13,9 @@ import AuthLayout from './layout/AuthLayout';
 import Landing from './pages/Main/Landing';
 import SignIn from './pages/Authentication/SignIn';
 import SignUp from './pages/Authentication/SignUp';
+import VerifyEmail from './pages/Authentication/VerifyEmail';
+import ForgotPassword from './pages/Authentication/ForgotPassword';
+import ResetPassword from './pages/Authentication/ResetPassword';
 import About from './pages/Main/About';
 import Contact from './pages/Main/Contact';
 import Terms from './pages/Main/Terms';
@@ -101,23 +104,53 @@ function App() {
         navigate('/auth/signin');
       }
     } else {
-      fetch(`${config.API_URL}/auth/verify`, {
+      const verify = (token: string) => fetch(`${config.API_URL}/auth/verify`, {
         method: 'GET',
         headers: {
           'Content-Type': 'application/json',
-          'token': authToken || ''
+          'token': token
         }
-      })
+      });
+
+      const refresh = async () => {
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (!refreshToken) return null;
+
+        const response = await fetch(`${config.API_URL}/users/refresh`, {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json'
+          },
+          body: JSON.stringify({ refresh_token: refreshToken })
+        });
+        if (!response.ok) {
+          localStorage.removeItem('token');
+          localStorage.removeItem('refresh_token');
+          return null;
+        }
+
+        const data = await response.json();
+        localStorage.setItem('token', data.token);
+        localStorage.setItem('refresh_token', data.refresh_token);
+        return data.token as string;
+      };
+
+      verify(authToken)
+        .then(async (response) => {
+          if (response.ok) return response;
+          const token = await refresh();
+          return token ? verify(token) : response;
+        })
         .then((response) => response.json())
         .then((data) => {
           setUserType(data.user_type);
 
           if (data.user_type === 'USER') {
-            if (pathname.startsWith('/admin') || pathname.startsWith('/auth')) {
+            if (pathname.startsWith('/admin') || (pathname.startsWith('/auth') && pathname !== '/auth/verify-email')) {
               navigate('/member');
             }
           } else if (data.user_type === 'ADMIN') {
-            if (pathname.startsWith('/member') || pathname.startsWith('/auth')) {
+            if (pathname.startsWith('/member') || (pathname.startsWith('/auth') && pathname !== '/auth/verify-email')) {
               navigate('/admin');
             }
           } else {
@@ -139,7 +172,7 @@ function App() {
 
   let Layout;
 
-  if (pathname.startsWith('/auth')) {
+  if ((pathname.startsWith('/auth') && pathname !== '/auth/verify-email')) {
     Layout = AuthLayout;
   } else if (pathname.startsWith('/member') && userType === 'USER') {
     Layout = MemberLayout;
@@ -179,6 +212,33 @@ function App() {
             </>
           }
         />
+        <Route
+          path="/auth/verify-email"
+          element={
+            <>
+              <PageTitle title="Verify Email" />
+              <VerifyEmail />
+            </>
+          }
+        />
+        <Route
+          path="/auth/forgot-password"
+          element={
+            <>
+              <PageTitle title="Forgot Password" />
+              <ForgotPassword />
+            </>
+          }
+        />
+        <Route
+          path="/auth/reset-password"
+          element={
+            <>
+              <PageTitle title="Reset Password" />
+              <ResetPassword />
+            </>
+          }
+        />
         <Route
           path="/about"
           element={
@@ -1,6 +1,7 @@
 import { useState, useEffect } from 'react';
 import { Link } from 'react-router-dom';
 import ClickOutside from '../../ClickOutside';
+import config from '../../../config';
 
 const DropdownUser = () => {
   const [dropdownOpen, setDropdownOpen] = useState(false);
@@ -15,7 +16,20 @@ const DropdownUser = () => {
   });
 
   const handleLogout = () => {
+    const authToken = localStorage.getItem('token');
+    if (authToken) {
+      fetch(`${config.API_URL}/users/logout`, {
+        method: 'POST',
+        keepalive: true,
+        headers: {
+          'Content-Type': 'application/json',
+          'token': authToken
+        }
+      }).catch((error) => console.error('Error logging out:', error));
+    }
+
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     setCheckAuth(false);
     window.location.href = '/auth/signin';
   };
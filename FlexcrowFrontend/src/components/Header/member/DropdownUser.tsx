@@ -62,7 +62,20 @@ const DropdownUser = () => {
   }, []);
 
   const handleLogout = () => {
+    const authToken = localStorage.getItem('token');
+    if (authToken) {
+      fetch(`${config.API_URL}/users/logout`, {
+        method: 'POST',
+        keepalive: true,
+        headers: {
+          'Content-Type': 'application/json',
+          'token': authToken
+        }
+      }).catch((error) => console.error('Error logging out:', error));
+    }
+
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     setCheckAuth(false);
     window.location.href = '/auth/signin';
   };
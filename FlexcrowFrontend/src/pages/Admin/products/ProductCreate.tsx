@@ -11,6 +11,7 @@ interface ProductFormData {
   type: 1 | 2;
   description: string;
   price: string;
+  currency: string;
   image_id: string[];
   video_id: string;
 }
@@ -50,6 +51,7 @@ const ProductCreate = () => {
     type: 1,
     description: '',
     price: '',
+    currency: 'THB',
     image_id: [],
     video_id: ''
   });
@@ -276,7 +278,8 @@ const ProductCreate = () => {
 
     const dataToSubmit = {
       ...formData,
-      price: parseFloat(formData.price) || 0
+      price: parseFloat(formData.price) || 0,
+      currency: formData.currency
     };
 
     try {
@@ -385,6 +388,20 @@ const ProductCreate = () => {
             />
             {errors.price && <p className="text-red-500 text-sm mt-2">{errors.price}</p>}
           </div>
+          <div>
+            <label className="block mb-2">Currency</label>
+            <select
+              value={formData.currency}
+              onChange={e => setFormData({ ...formData, currency: e.target.value })}
+              className="w-full border p-2 rounded"
+            >
+              <option value="THB">THB</option>
+              <option value="USD">USD</option>
+              <option value="EUR">EUR</option>
+              <option value="JPY">JPY</option>
+              <option value="SGD">SGD</option>
+            </select>
+          </div>
 
           <div>
             <label className="block mb-2">Images</label>
@@ -10,6 +10,7 @@ interface ProductFormData {
   type: 1 | 2;
   description: string;
   price: string;
+  currency: string;
   image_id: string[];
   video_id: string;
 }
@@ -50,6 +51,7 @@ const ProductEdit = () => {
     type: 1,
     description: '',
     price: '',
+    currency: 'THB',
     image_id: [],
     video_id: ''
   });
@@ -286,6 +288,7 @@ const ProductEdit = () => {
             type: data.type,
             description: data.description,
             price: data.price,
+            currency: data.currency || 'THB',
             image_id: data.image_id || [],
             video_id: data.video_id || '',
           });
@@ -342,7 +345,8 @@ const ProductEdit = () => {
 
     const dataToSubmit = {
       ...formData,
-      price: parseFloat(formData.price) || 0
+      price: parseFloat(formData.price) || 0,
+      currency: formData.currency
     };
 
     try {
@@ -443,6 +447,20 @@ const ProductEdit = () => {
             />
             {errors.price && <p className="text-red-500 text-sm mt-2">{errors.price}</p>}
           </div>
+          <div>
+            <label className="block mb-2">Currency</label>
+            <select
+              value={formData.currency}
+              onChange={e => setFormData({ ...formData, currency: e.target.value })}
+              className="w-full border p-2 rounded"
+            >
+              <option value="THB">THB</option>
+              <option value="USD">USD</option>
+              <option value="EUR">EUR</option>
+              <option value="JPY">JPY</option>
+              <option value="SGD">SGD</option>
+            </select>
+          </div>
 
           <div>
             <label className="block mb-2">Images</label>
@@ -2,6 +2,7 @@ import React, { useEffect, useState } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
 import { format, formatDistanceToNow } from "date-fns";
 import { enUS } from "date-fns/locale";
+import { toast } from 'react-toastify';
 import config from '../../../config';
 
 interface User {
@@ -16,6 +17,7 @@ interface User {
   balance: GLfloat;
   address_id: string;
   image_id: string;
+  roles: string[] | null;
   created_at: string;
   updated_at: string;
 }
@@ -25,6 +27,13 @@ interface Address {
   name: string;
 }
 
+interface Role {
+  role_id: string;
+  name: string;
+  description: string;
+  built_in: boolean;
+}
+
 interface ImageData {
   id: string;
   url: string;
@@ -38,6 +47,8 @@ const UserView = () => {
   const [error, setError] = React.useState<string | null>(null);
   const [address, setAddress] = React.useState<Address | null>(null);
   const [image, setImage] = useState<ImageData | null>(null);
+  const [roles, setRoles] = useState<Role[]>([]);
+  const [selectedRoles, setSelectedRoles] = useState<string[]>([]);
 
   React.useEffect(() => {
     const fetchUser = async () => {
@@ -109,6 +120,75 @@ const UserView = () => {
     }
   }, [user]);
 
+  useEffect(() => {
+    const fetchRoles = async () => {
+      try {
+        const token = localStorage.getItem('token');
+        const response = await fetch(`${config.API_URL}/roles`, {
+          headers: {
+            'Content-Type': 'application/json',
+            'token': token || ''
+          }
+        });
+        if (!response.ok) return;
+        const data = await response.json();
+        setRoles(data.role_items || []);
+      } catch (err) {
+        console.error('Error fetching roles:', err);
+      }
+    };
+
+    fetchRoles();
+  }, []);
+
+  useEffect(() => {
+    setSelectedRoles(user?.roles || []);
+  }, [user]);
+
+  const toggleRole = (roleId: string) => {
+    setSelectedRoles((current) =>
+      current.includes(roleId) ? current.filter((id) => id !== roleId) : [...current, roleId]
+    );
+  };
+
+  const handleSaveRoles = async () => {
+    try {
+      const token = localStorage.getItem('token');
+      const response = await fetch(`${config.API_URL}/users/${user_id}/roles`, {
+        method: 'PUT',
+        headers: {
+          'Content-Type': 'application/json',
+          'token': token || ''
+        },
+        body: JSON.stringify({ roles: selectedRoles })
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.message || 'Failed to update roles');
+      }
+      toast.success('Roles updated.');
+    } catch (err) {
+      toast.error(err instanceof Error ? err.message : 'Failed to update roles');
+    }
+  };
+
+  const handleUnlock = async () => {
+    try {
+      const token = localStorage.getItem('token');
+      const response = await fetch(`${config.API_URL}/users/${user_id}/unlock`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          'token': token || ''
+        }
+      });
+      if (!response.ok) throw new Error('Failed to unlock user');
+      toast.success('Failed logins cleared; the user can sign in again.');
+    } catch (err) {
+      toast.error(err instanceof Error ? err.message : 'Failed to unlock user');
+    }
+  };
+
   const formatDate = (dateString: string) => {
     const date = new Date(dateString);
     return `${format(date, "dd MMMM yyyy | HH:mm", { locale: enUS })} (${formatDistanceToNow(date, { addSuffix: true, locale: enUS })})`;
@@ -146,6 +226,34 @@ const UserView = () => {
               ) : null}
             </p>
           </div>
+          <div>
+            <p className="font-medium text-gray-600 mb-1">Staff roles</p>
+            {user.user_type === 'ADMIN' && (
+              <p className="text-sm text-gray-500 mb-2">Admins are superusers and hold every permission.</p>
+            )}
+            {roles.filter((role) => role.role_id !== 'superuser').map((role) => (
+              <label key={role.role_id} className="flex items-start gap-2 mb-1">
+                <input
+                  type="checkbox"
+                  className="mt-1"
+                  checked={selectedRoles.includes(role.role_id)}
+                  onChange={() => toggleRole(role.role_id)}
+                />
+                <span>
+                  {role.name}
+                  <span className="block text-sm text-gray-500">{role.description}</span>
+                </span>
+              </label>
+            ))}
+            {roles.length > 0 && (
+              <button
+                onClick={handleSaveRoles}
+                className="mt-2 bg-blue-500 text-white px-3 py-1 rounded hover:bg-blue-600"
+              >
+                Save Roles
+              </button>
+            )}
+          </div>
           <div>
             <p className="font-medium text-gray-600 mb-1">Status</p>
             <p>
@@ -217,6 +325,12 @@ const UserView = () => {
           >
             Edit
           </button>
+          <button
+            onClick={handleUnlock}
+            className="bg-teal-600 text-white px-4 py-2 rounded hover:bg-teal-700"
+          >
+            Unlock Login
+          </button>
           <button
             onClick={() => navigate('/admin/users')}
             className="bg-gray-500 text-white px-4 py-2 rounded hover:bg-gray-600"
@@ -4,10 +4,12 @@ import { toast } from 'react-toastify';
 import config from '../../../config';
 
 interface WithdrawalFormData {
-  status: 1 | 2 | 3;
+  status: 1 | 2 | 3 | 4 | 5;
   amount: string;
   method: string;
   account: string;
+  payout_reference: string;
+  reject_reason: string;
 }
 
 const WithdrawalEdit = () => {
@@ -22,16 +24,23 @@ const WithdrawalEdit = () => {
     status: 1,
     amount: '',
     method: '',
-    account: ''
+    account: '',
+    payout_reference: '',
+    reject_reason: ''
   });
 
   const [errors, setErrors] = useState<{ [key: string]: string }>({});
+  const [payout, setPayout] = useState<{ status: number; provider: string; failure: string }>({ status: 1, provider: '', failure: '' });
 
   const validateForm = () => {
     const newErrors: { [key: string]: string } = {};
 
-    if (!formData.status || (formData.status !== 1 && formData.status !== 2 && formData.status !== 3)) {
-      newErrors.status = 'Status must be Pending or Completed or Canceled';
+    if (!formData.status || ![1, 2, 3, 4].includes(formData.status)) {
+      newErrors.status = 'Status must be Pending, Approved, Completed or Canceled';
+    }
+
+    if (formData.status === 2 && !formData.payout_reference) {
+      newErrors.payout_reference = 'Payout reference is required to complete a withdrawal';
     }
 
     if (!formData.method) newErrors.method = 'Method is required';
@@ -77,8 +86,11 @@ const WithdrawalEdit = () => {
             status: data.status,
             amount: data.amount,
             method: data.method,
-            account: data.account
+            account: data.account,
+            payout_reference: data.payout_reference || '',
+            reject_reason: data.reject_reason || ''
           });
+          setPayout({ status: data.status, provider: data.payout_provider || '', failure: data.payout_failure || '' });
 
         } catch (err) {
           setError(err instanceof Error ? err.message : 'Failed to load withdrawal');
@@ -127,6 +139,32 @@ const WithdrawalEdit = () => {
     }
   };
 
+  const handleRetryPayout = async () => {
+    try {
+      const token = localStorage.getItem('token');
+      const response = await fetch(`${config.API_URL}/withdrawals/${withdrawal_id}/payout`, {
+        method: "POST",
+        headers: {
+          'Content-Type': 'application/json',
+          'token': token || ''
+        }
+      });
+
+      const responseData = await response.json();
+
+      if (!response.ok) {
+        setPayout((prev) => ({ ...prev, failure: responseData.message || responseData.error }));
+        throw new Error(responseData.error || 'Failed to pay out withdrawal');
+      }
+
+      setPayout({ status: responseData.status, provider: responseData.payout_provider || '', failure: '' });
+      setFormData((prev) => ({ ...prev, status: responseData.status, payout_reference: responseData.payout_reference || '' }));
+      toast.success('Payout sent');
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to pay out withdrawal');
+    }
+  };
+
   if (loading) {
     return <div className="p-6">Loading...</div>;
   }
@@ -137,22 +175,63 @@ const WithdrawalEdit = () => {
         <h1 className="text-2xl font-bold mb-6">Edit Withdrawal</h1>
         {error && <div className="text-red-500 mb-4">{error}</div>}
         
+        {payout.status === 4 && (
+          <div className="mb-4">
+            {payout.provider && <p className="mb-2">Payout provider: {payout.provider}</p>}
+            {payout.failure && <p className="text-red-500 mb-2">Payout failed: {payout.failure}</p>}
+            <button
+              type="button"
+              onClick={handleRetryPayout}
+              className="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600"
+            >
+              Retry Payout
+            </button>
+          </div>
+        )}
+
         <form onSubmit={handleSubmit} className="space-y-5">
 
           <div>
             <label className="block mb-2">Status</label>
             <select
                 value={formData.status}
-                onChange={e => setFormData({ ...formData, status: Number(e.target.value) as 1 | 2 | 3 })}
+                onChange={e => setFormData({ ...formData, status: Number(e.target.value) as 1 | 2 | 3 | 4 | 5 })}
                 className="w-full border p-2 rounded"
             >
                 <option value="1">Pending</option>
+                <option value="4">Approved</option>
                 <option value="2">Completed</option>
                 <option value="3">Canceled</option>
+                <option value="5" disabled>In Batch</option>
             </select>
             {errors.status && <p className="text-red-500 text-sm mt-2">{errors.status}</p>}
           </div>
 
+          {formData.status === 2 && (
+          <div>
+            <label className="block mb-2">Payout Reference</label>
+            <input
+                type="text"
+                value={formData.payout_reference}
+                onChange={e => setFormData({ ...formData, payout_reference: e.target.value })}
+                className="w-full border p-2 rounded"
+            />
+            {errors.payout_reference && <p className="text-red-500 text-sm mt-2">{errors.payout_reference}</p>}
+          </div>
+          )}
+
+          {formData.status === 3 && (
+          <div>
+            <label className="block mb-2">Reason</label>
+            <input
+                type="text"
+                value={formData.reject_reason}
+                onChange={e => setFormData({ ...formData, reject_reason: e.target.value })}
+                className="w-full border p-2 rounded"
+            />
+          </div>
+          )}
+
           <div>
             <label className="block mb-2">Amount</label>
             <input
@@ -6,7 +6,7 @@ import config from '../../../config';
 interface Withdrawal {
   withdrawal_id: string;
   user_id: string;
-  status: 1 | 2 | 3;
+  status: 1 | 2 | 3 | 4 | 5;
   amount: GLfloat;
   method: string;
   account: string;
@@ -220,6 +220,10 @@ const WithdrawalIndex = () => {
                     <span className="bg-green-500 text-white py-1.5 px-3 rounded-full text-sm">Completed</span>
                   ) : withdrawal.status === 3 ? (
                     <span className="bg-red-500 text-white py-1.5 px-3 rounded-full text-sm">Canceled</span>
+                  ) : withdrawal.status === 4 ? (
+                    <span className="bg-blue-500 text-white py-1.5 px-3 rounded-full text-sm">Approved</span>
+                  ) : withdrawal.status === 5 ? (
+                    <span className="bg-indigo-500 text-white py-1.5 px-3 rounded-full text-sm">In Batch</span>
                   ) : null}
                 </td>
                 <td className="border-b border-[#eee] py-5 px-4 pl-6">฿{withdrawal.amount.toFixed(2)}</td>
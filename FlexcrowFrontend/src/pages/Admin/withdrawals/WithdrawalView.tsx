@@ -7,7 +7,7 @@ import config from '../../../config';
 interface Withdrawal {
   withdrawal_id: string;
   user_id: string;
-  status: 1 | 2 | 3;
+  status: 1 | 2 | 3 | 4 | 5;
   amount: GLfloat;
   method: string;
   account: string;
@@ -124,6 +124,10 @@ const WithdrawalView = () => {
                 <span className="text-green-500">Completed</span>
               ) : withdrawal.status === 3 ? (
                 <span className="text-red-500">Canceled</span>
+              ) : withdrawal.status === 4 ? (
+                <span className="text-blue-500">Approved</span>
+              ) : withdrawal.status === 5 ? (
+                <span className="text-indigo-500">In Batch</span>
               ) : null}
             </p>
           </div>
@@ -0,0 +1,74 @@
+import React, { useState } from 'react';
+import { Link } from 'react-router-dom';
+import { toast } from 'react-toastify';
+import config from '../../config';
+
+const ForgotPassword = () => {
+  const [email, setEmail] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [sent, setSent] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault();
+    setLoading(true);
+
+    try {
+      const response = await fetch(`${config.API_URL}/users/forgot-password`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ email })
+      });
+
+      const data = await response.json();
+
+      if (response.ok) {
+        setSent(true);
+      } else if (data.error === 'email_error') {
+        toast.error('Invalid email format');
+      } else {
+        toast.error(data.message || data.error || 'Something went wrong!');
+      }
+    } catch (err) {
+      toast.error('An error occurred. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 p-6">
+      <div className="w-full max-w-md bg-white rounded-lg shadow-md p-8">
+        <h1 className="text-2xl font-bold text-[#0d6577] mb-4">Forgot password</h1>
+        {sent ? (
+          <p className="text-gray-600 mb-6">If that address belongs to an account, we have sent a link to reset the password. It is valid for one hour.</p>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <p className="text-gray-600">Enter your email address and we will send you a link to choose a new password.</p>
+            <input
+              type="email"
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+              placeholder="Email"
+              className="w-full border border-gray-300 p-2 rounded-md focus:outline-none focus:ring-2 focus:ring-teal-500 focus:border-teal-500"
+              required
+            />
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-[#0d6577] text-white py-2 rounded-lg hover:bg-[#0d6577]/90 disabled:opacity-50"
+            >
+              {loading ? 'Sending...' : 'Send reset link'}
+            </button>
+          </form>
+        )}
+        <Link to="/auth/signin" className="block mt-6 text-sm font-medium text-[#0d6577] hover:text-[#0d6577]/80">
+          Back to sign in
+        </Link>
+      </div>
+    </div>
+  );
+};
+
+export default ForgotPassword;
@@ -0,0 +1,94 @@
+import React, { useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { toast } from 'react-toastify';
+import config from '../../config';
+
+const ResetPassword = () => {
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [loading, setLoading] = useState(false);
+  const navigate = useNavigate();
+
+  const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault();
+
+    if (password.length < 6) {
+      toast.error('Password must be at least 6 characters');
+      return;
+    }
+    if (password !== confirmPassword) {
+      toast.error('Passwords do not match');
+      return;
+    }
+
+    setLoading(true);
+
+    try {
+      const response = await fetch(`${config.API_URL}/users/reset-password`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ token: searchParams.get('token') || '', new_password: password })
+      });
+
+      const data = await response.json();
+
+      if (response.ok) {
+        localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
+        toast.success('Password reset. Please sign in with your new password.');
+        navigate('/auth/signin');
+      } else if (data.error === 'invalid_token') {
+        toast.error('This reset link is invalid or has expired.');
+      } else {
+        toast.error(data.error || 'Something went wrong!');
+      }
+    } catch (err) {
+      toast.error('An error occurred. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const inputClass = "w-full border border-gray-300 p-2 rounded-md focus:outline-none focus:ring-2 focus:ring-teal-500 focus:border-teal-500";
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 p-6">
+      <div className="w-full max-w-md bg-white rounded-lg shadow-md p-8">
+        <h1 className="text-2xl font-bold text-[#0d6577] mb-4">Choose a new password</h1>
+        <form onSubmit={handleSubmit} className="space-y-4">
+          <input
+            type="password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            placeholder="New password"
+            className={inputClass}
+            required
+          />
+          <input
+            type="password"
+            value={confirmPassword}
+            onChange={(e) => setConfirmPassword(e.target.value)}
+            placeholder="Confirm new password"
+            className={inputClass}
+            required
+          />
+          <button
+            type="submit"
+            disabled={loading}
+            className="w-full bg-[#0d6577] text-white py-2 rounded-lg hover:bg-[#0d6577]/90 disabled:opacity-50"
+          >
+            {loading ? 'Saving...' : 'Reset password'}
+          </button>
+        </form>
+        <Link to="/auth/signin" className="block mt-6 text-sm font-medium text-[#0d6577] hover:text-[#0d6577]/80">
+          Back to sign in
+        </Link>
+      </div>
+    </div>
+  );
+};
+
+export default ResetPassword;
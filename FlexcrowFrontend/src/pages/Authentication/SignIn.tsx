@@ -16,6 +16,8 @@ const SignIn = () => {
     password: ''
   });
   const [loading, setLoading] = useState(false);
+  const [challengeToken, setChallengeToken] = useState('');
+  const [totpCode, setTotpCode] = useState('');
   const navigate = useNavigate();
 
   useEffect(() => {
@@ -46,19 +48,45 @@ const SignIn = () => {
     setLoading(true);
 
     try {
-      const response = await fetch(`${config.API_URL}/users/login`, {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify(formData)
-      });
+      // With two-factor on, the password step returns a challenge token that
+      // is exchanged, together with a code, for the real tokens.
+      const response = challengeToken
+        ? await fetch(`${config.API_URL}/users/login/2fa`, {
+            method: 'POST',
+            headers: {
+              'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ challenge_token: challengeToken, code: totpCode })
+          })
+        : await fetch(`${config.API_URL}/users/login`, {
+            method: 'POST',
+            headers: {
+              'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(formData)
+          });
       
       const data = await response.json();
+
+      if (response.ok && data.two_factor_required) {
+        setChallengeToken(data.challenge_token);
+        return;
+      }
+
+      if (!response.ok && challengeToken) {
+        if (data.error === 'invalid_challenge_token') {
+          setChallengeToken('');
+          toast.error('The sign-in took too long. Please enter your password again.');
+        } else {
+          toast.error(data.message || 'Invalid code.');
+        }
+        return;
+      }
       
       if (response.ok) {
         if (data.token) {
           localStorage.setItem('token', data.token);
+          localStorage.setItem('refresh_token', data.refresh_token || '');
 
           const responseType = await fetch(`${config.API_URL}/auth/verify`, {
             method: 'GET',
@@ -80,6 +108,10 @@ const SignIn = () => {
         } else {
           toast.error('Invalid email or password.');
         }
+      } else if (response.status === 429) {
+        toast.error(`Too many failed sign-ins. Try again in ${Math.ceil((data.retry_after || 60) / 60)} minute(s).`);
+      } else if (data.error === 'account_disabled') {
+        toast.error('This account has been disabled.');
       } else {
         toast.error('Invalid email or password.');
       }
@@ -207,7 +239,7 @@ const SignIn = () => {
                 <label className="text-sm font-medium text-gray-700" htmlFor="password">
                   Password
                 </label>
-                <Link to="#" className="text-sm font-medium text-[#0d6577] hover:text-[#0d6577]/80">
+                <Link to="/auth/forgot-password" className="text-sm font-medium text-[#0d6577] hover:text-[#0d6577]/80">
                   Forgot Password?
                 </Link>
               </div>
@@ -238,6 +270,25 @@ const SignIn = () => {
               </div>
             </div>
 
+            {challengeToken && (
+              <div className="space-y-2">
+                <label className="text-sm font-medium text-gray-700" htmlFor="totp_code">
+                  Authenticator Code
+                </label>
+                <input
+                  id="totp_code"
+                  name="totp_code"
+                  type="text"
+                  required
+                  autoFocus
+                  placeholder="6-digit code or a recovery code"
+                  className="w-full rounded-lg border border-gray-300 bg-white py-3 px-4 text-gray-900 shadow-sm focus:border-[#0d6577] focus:outline-none focus:ring-1 focus:ring-[#0d6577] transition-colors"
+                  value={totpCode}
+                  onChange={(e) => setTotpCode(e.target.value)}
+                />
+              </div>
+            )}
+
             <button
               type="submit"
               disabled={loading}
@@ -245,7 +296,7 @@ const SignIn = () => {
             >
               {loading ? 'Signing In...' : (
                 <>
-                  Sign in <ArrowRight className="h-4 w-4" />
+                  {challengeToken ? 'Verify' : 'Sign in'} <ArrowRight className="h-4 w-4" />
                 </>
               )}
             </button>
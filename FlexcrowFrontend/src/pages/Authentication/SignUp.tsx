@@ -155,7 +155,7 @@ const SignUp = () => {
       const data = await response.json();
 
       if (response.ok) {
-        toast.success('Account created successfully');
+        toast.success('Account created. Check your email to verify your address.');
         navigate('/auth/signin');
       } else {
         if (data.error === 'email_error') {
@@ -0,0 +1,67 @@
+import { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import config from '../../config';
+
+type VerifyState = 'verifying' | 'verified' | 'failed';
+
+const VerifyEmail = () => {
+  const [searchParams] = useSearchParams();
+  const [state, setState] = useState<VerifyState>('verifying');
+  const [message, setMessage] = useState('');
+  const requested = useRef(false);
+
+  useEffect(() => {
+    // Tokens are single use, so never post the same one twice.
+    if (requested.current) return;
+    requested.current = true;
+
+    fetch(`${config.API_URL}/users/verify-email`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json'
+      },
+      body: JSON.stringify({ token: searchParams.get('token') || '' })
+    })
+      .then(async (response) => {
+        const data = await response.json();
+        if (response.ok) {
+          setState('verified');
+        } else {
+          setState('failed');
+          setMessage(data.message || 'This link is invalid or has expired.');
+        }
+      })
+      .catch((error) => {
+        console.error('Error verifying email:', error);
+        setState('failed');
+        setMessage('An error occurred. Please try again.');
+      });
+  }, [searchParams]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 p-6">
+      <div className="w-full max-w-md bg-white rounded-lg shadow-md p-8 text-center">
+        {state === 'verifying' && <p className="text-gray-600">Verifying your email address...</p>}
+        {state === 'verified' && (
+          <>
+            <h1 className="text-2xl font-bold text-[#0d6577] mb-4">Email verified</h1>
+            <p className="text-gray-600 mb-6">Your email address is confirmed. You can now list products, start transactions and withdraw funds.</p>
+          </>
+        )}
+        {state === 'failed' && (
+          <>
+            <h1 className="text-2xl font-bold text-red-500 mb-4">Verification failed</h1>
+            <p className="text-gray-600 mb-6">{message}</p>
+          </>
+        )}
+        {state !== 'verifying' && (
+          <Link to="/auth/signin" className="inline-block bg-[#0d6577] text-white px-6 py-2 rounded-lg hover:bg-[#0d6577]/90">
+            Continue
+          </Link>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default VerifyEmail;
@@ -1,6 +1,6 @@
 import React, { useState, useRef, useEffect } from 'react';
 import { toast } from 'react-toastify';
-import { Upload, X, Loader2, User, Mail, Phone, MapPin, Lock } from 'lucide-react';
+import { Upload, X, Loader2, User, Mail, Phone, MapPin, Lock, ShieldCheck } from 'lucide-react';
 import config from '../../config';
 
 interface UserFormData {
@@ -17,6 +17,12 @@ interface PasswordData {
   current_password: string;
   new_password: string;
   confirm_password: string;
+  totp_code: string;
+}
+
+interface TotpSetup {
+  secret: string;
+  provisioning_uri: string;
 }
 
 interface Address {
@@ -55,8 +61,14 @@ const UserSettings = () => {
     current_password: '',
     new_password: '',
     confirm_password: '',
+    totp_code: '',
   });
 
+  const [totpEnabled, setTotpEnabled] = useState(false);
+  const [totpSetup, setTotpSetup] = useState<TotpSetup | null>(null);
+  const [totpCode, setTotpCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+
   const [errors, setErrors] = useState<{ [key: string]: string }>({});
   const [passwordErrors, setPasswordErrors] = useState<{ [key: string]: string }>({});
   
@@ -234,6 +246,7 @@ const UserSettings = () => {
         });
 
         setUserID(data.user_id);
+        setTotpEnabled(!!data.totp_enabled);
 
         if (data.image_id) {
           const fileResponse = await fetch(`${config.API_URL}/files/${data.image_id}`, {
@@ -312,7 +325,8 @@ const UserSettings = () => {
         },
         body: JSON.stringify({
           current_password: passwordData.current_password,
-          new_password: passwordData.new_password
+          new_password: passwordData.new_password,
+          totp_code: passwordData.totp_code
         }),
       });
   
@@ -321,23 +335,67 @@ const UserSettings = () => {
       if (!response.ok) {
         if (responseData.error === 'invalid_password') {
           setPasswordErrors(prev => ({ ...prev, current_password: 'Current password is incorrect' }));
+        } else if (responseData.error === 'totp_required' || responseData.error === 'invalid_totp_code') {
+          setPasswordErrors(prev => ({ ...prev, totp_code: responseData.message }));
         } else {
           throw new Error(responseData.error || 'Failed to update password');
         }
         return;
       }
   
-      toast.success('Password updated successfully');
-      setPasswordData({
-        current_password: '',
-        new_password: '',
-        confirm_password: ''
-      });
+      // Changing the password signs out every session, including this one.
+      toast.success('Password updated successfully. Please sign in again.');
+      localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
+      window.location.href = '/auth/signin';
     } catch (err) {
       setError(err instanceof Error ? err.message : "Failed to update password");
     }
   };
 
+  const postTotp = async (path: string, body: object) => {
+    const token = localStorage.getItem('token');
+    const response = await fetch(`${config.API_URL}/users/2fa/${path}`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'token': token || ''
+      },
+      body: JSON.stringify(body)
+    });
+    const data = await response.json();
+    if (!response.ok) {
+      throw new Error(data.message || data.error || 'Two-factor request failed');
+    }
+    return data;
+  };
+
+  const handleTotpAction = async (action: 'setup' | 'enable' | 'disable' | 'recovery-codes') => {
+    try {
+      const data = await postTotp(action, { code: totpCode });
+      setTotpCode('');
+
+      if (action === 'setup') {
+        setTotpSetup(data);
+        setRecoveryCodes([]);
+      } else if (action === 'enable') {
+        setTotpEnabled(true);
+        setTotpSetup(null);
+        setRecoveryCodes(data.recovery_codes);
+        toast.success('Two-factor authentication enabled');
+      } else if (action === 'disable') {
+        setTotpEnabled(false);
+        setRecoveryCodes([]);
+        toast.success('Two-factor authentication disabled');
+      } else {
+        setRecoveryCodes(data.recovery_codes);
+        toast.success('New recovery codes generated');
+      }
+    } catch (err) {
+      toast.error(err instanceof Error ? err.message : 'Two-factor request failed');
+    }
+  };
+
   if (loading) {
     return (
       <div className="flex items-center justify-center h-64">
@@ -379,6 +437,17 @@ const UserSettings = () => {
           <Lock className="w-4 h-4 mr-2" />
           Password
         </button>
+        <button
+          onClick={() => setActiveTab('security')}
+          className={`flex items-center px-6 py-4 font-medium text-sm transition-colors ${
+            activeTab === 'security' 
+              ? 'text-[#0d6577] border-b-2 border-[#0d6577]' 
+              : 'text-gray-500 hover:text-[#0d6577]'
+          }`}
+        >
+          <ShieldCheck className="w-4 h-4 mr-2" />
+          Two-Factor
+        </button>
       </div>
 
       {activeTab === 'profile' && (
@@ -619,6 +688,21 @@ const UserSettings = () => {
               {passwordErrors.confirm_password && <p className="text-red-500 text-xs mt-1.5">{passwordErrors.confirm_password}</p>}
             </div>
 
+            {totpEnabled && (
+              <div>
+                <label className="block text-gray-600 text-sm font-medium mb-2">Authenticator Code</label>
+                <input
+                  type="text"
+                  inputMode="numeric"
+                  value={passwordData.totp_code}
+                  onChange={e => setPasswordData({ ...passwordData, totp_code: e.target.value })}
+                  className="w-full border border-gray-300 rounded-md py-2 px-3 focus:outline-none focus:ring-2 focus:ring-teal-500 focus:border-transparent"
+                  placeholder="6-digit code from your authenticator app"
+                />
+                {passwordErrors.totp_code && <p className="text-red-500 text-xs mt-1.5">{passwordErrors.totp_code}</p>}
+              </div>
+            )}
+
             <div className="flex justify-end">
               <button
                 type="submit"
@@ -630,6 +714,70 @@ const UserSettings = () => {
           </form>
         </div>
       )}
+
+      {activeTab === 'security' && (
+        <div className="p-6 space-y-6">
+          <p className="text-gray-600">
+            Two-factor authentication is <span className="font-medium">{totpEnabled ? 'on' : 'off'}</span>.
+            {totpEnabled
+              ? ' Signing in, withdrawing and changing your password ask for a code from your authenticator app.'
+              : ' Turn it on to protect your balance with a code from an authenticator app.'}
+          </p>
+
+          {!totpEnabled && !totpSetup && (
+            <button
+              onClick={() => handleTotpAction('setup')}
+              className="px-6 py-2.5 bg-[#0d6577] hover:bg-[#0F7A8D] text-white font-medium rounded-md"
+            >
+              Set Up Two-Factor
+            </button>
+          )}
+
+          {totpSetup && (
+            <div className="space-y-2">
+              <p className="text-gray-600 text-sm">Add this account to your authenticator app with the key below, or open the setup link on your phone.</p>
+              <p className="font-mono text-sm bg-gray-100 p-3 rounded break-all">{totpSetup.secret}</p>
+              <a href={totpSetup.provisioning_uri} className="text-sm font-medium text-[#0d6577] break-all">{totpSetup.provisioning_uri}</a>
+            </div>
+          )}
+
+          {(totpSetup || totpEnabled) && (
+            <div className="flex flex-wrap items-center gap-3">
+              <input
+                type="text"
+                value={totpCode}
+                onChange={e => setTotpCode(e.target.value)}
+                className="border border-gray-300 rounded-md py-2 px-3 focus:outline-none focus:ring-2 focus:ring-teal-500 focus:border-transparent"
+                placeholder={totpEnabled ? 'Authenticator or recovery code' : '6-digit code'}
+              />
+              {totpSetup && (
+                <button onClick={() => handleTotpAction('enable')} className="px-6 py-2.5 bg-[#0d6577] hover:bg-[#0F7A8D] text-white font-medium rounded-md">
+                  Confirm
+                </button>
+              )}
+              {totpEnabled && (
+                <>
+                  <button onClick={() => handleTotpAction('recovery-codes')} className="px-6 py-2.5 bg-[#0d6577] hover:bg-[#0F7A8D] text-white font-medium rounded-md">
+                    New Recovery Codes
+                  </button>
+                  <button onClick={() => handleTotpAction('disable')} className="px-6 py-2.5 bg-red-500 hover:bg-red-600 text-white font-medium rounded-md">
+                    Turn Off
+                  </button>
+                </>
+              )}
+            </div>
+          )}
+
+          {recoveryCodes.length > 0 && (
+            <div>
+              <p className="text-gray-600 text-sm mb-2">Store these recovery codes somewhere safe. Each works once if you lose your phone, and they will not be shown again.</p>
+              <ul className="grid grid-cols-2 gap-2 font-mono text-sm bg-gray-100 p-3 rounded">
+                {recoveryCodes.map(code => <li key={code}>{code}</li>)}
+              </ul>
+            </div>
+          )}
+        </div>
+      )}
     </div>
   );
 };
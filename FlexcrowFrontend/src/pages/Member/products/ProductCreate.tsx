@@ -9,6 +9,7 @@ interface ProductFormData {
   type: 1 | 2;
   description: string;
   price: string;
+  currency: string;
   image_id: string[];
   video_id: string;
 }
@@ -46,6 +47,7 @@ const ProductCreate = () => {
     type: 1,
     description: '',
     price: '',
+    currency: 'THB',
     image_id: [],
     video_id: ''
   });
@@ -266,7 +268,8 @@ const ProductCreate = () => {
     const dataToSubmit = {
       ...formData,
       status: 1,
-      price: parseFloat(formData.price) || 0
+      price: parseFloat(formData.price) || 0,
+      currency: formData.currency
     };
 
     try {
@@ -286,7 +289,7 @@ const ProductCreate = () => {
         if (responseData.error === 'user_error') {
           setErrors((prev) => ({ ...prev, user_id: 'User not found' }));
         } else {
-          throw new Error(responseData.error || 'Failed to create product');
+          throw new Error(responseData.message || responseData.error || 'Failed to create product');
         }
         return;
       }
@@ -407,6 +410,20 @@ const ProductCreate = () => {
                 />
                 {errors.price && <p className="text-red-500 text-xs mt-1">{errors.price}</p>}
               </div>
+              <div>
+                <label className="block text-sm font-medium text-teal-600 mb-2">Currency</label>
+                <select
+                  value={formData.currency}
+                  onChange={e => setFormData({ ...formData, currency: e.target.value })}
+                  className={inputClass}
+                >
+                  <option value="THB">THB</option>
+                  <option value="USD">USD</option>
+                  <option value="EUR">EUR</option>
+                  <option value="JPY">JPY</option>
+                  <option value="SGD">SGD</option>
+                </select>
+              </div>
             </div>
           </div>
 
@@ -9,6 +9,7 @@ interface ProductFormData {
   type: 1 | 2;
   description: string;
   price: string;
+  currency: string;
   image_id: string[];
   video_id: string;
 }
@@ -54,6 +55,7 @@ const ProductEdit = () => {
     type: 1,
     description: '',
     price: '',
+    currency: 'THB',
     image_id: [],
     video_id: ''
   });
@@ -315,6 +317,7 @@ const ProductEdit = () => {
           type: data.type,
           description: data.description,
           price: data.price,
+          currency: data.currency || 'THB',
           image_id: data.image_id || [],
           video_id: data.video_id || '',
         });
@@ -374,7 +377,8 @@ const ProductEdit = () => {
     const dataToSubmit = {
       ...formData,
       status: 1,
-      price: parseFloat(formData.price) || 0
+      price: parseFloat(formData.price) || 0,
+      currency: formData.currency
     };
 
     try {
@@ -518,6 +522,20 @@ const ProductEdit = () => {
                 />
                 {errors.price && <p className="text-red-500 text-xs mt-1">{errors.price}</p>}
               </div>
+              <div>
+                <label className="block text-sm font-medium text-teal-600 mb-2">Currency</label>
+                <select
+                  value={formData.currency}
+                  onChange={e => setFormData({ ...formData, currency: e.target.value })}
+                  className={inputClass}
+                >
+                  <option value="THB">THB</option>
+                  <option value="USD">USD</option>
+                  <option value="EUR">EUR</option>
+                  <option value="JPY">JPY</option>
+                  <option value="SGD">SGD</option>
+                </select>
+              </div>
             </div>
           </div>
 
@@ -155,18 +155,7 @@ const TransactionCreate = () => {
       return;
     }
   
-    const productPrice = selectedProduct.price * formData.product_number;
     const shippingPrice = parseFloat(formData.shipping_price) || 0;
-    const amount = productPrice + shippingPrice;
-  
-    let dataFee = 0;
-    if (amount > 200) {
-      dataFee = amount * 0.08;
-    } else if (amount > 100) {
-      dataFee = amount * 0.05;
-    } else {
-      dataFee = amount * 0.02;
-    }
   
     const dataToSubmit = {
       ...formData,
@@ -176,7 +165,6 @@ const TransactionCreate = () => {
       shipping_number: '',
       shipping_image_id: '',
       delivered_details: '',
-      fee: dataFee,
       shipping_price: shippingPrice
     };
   
@@ -212,7 +200,7 @@ const TransactionCreate = () => {
             setErrors((prev) => ({ ...prev, product_id: 'Product not found' }));
           }
         } else {
-          throw new Error(responseData.error || 'Failed to create transaction');
+          throw new Error(responseData.message || responseData.error || 'Failed to create transaction');
         }
         return;
       }
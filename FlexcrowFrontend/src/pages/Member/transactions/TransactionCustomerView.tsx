@@ -27,6 +27,8 @@ interface Transaction {
   delivered_details: string;
   fee: GLfloat;
   fee_type: 1 | 2 | 3;
+  currency?: string;
+  payment_currency?: string;
   created_at: string;
   updated_at: string;
 }
@@ -98,7 +100,6 @@ const TransactionCustomerView = () => {
   const [customerPhone, setCustomerPhone] = useState<string>('');
   const [customerEmail, setCustomerEmail] = useState<string>('');
   const [customerImage, setCustomerImage] = useState<{ id: string; url: string } | null>(null);
-  const [customerBalance, setCustomerBalance] = useState<GLfloat>(0);
   const [loadingCustomer, setLoadingCustomer] = useState<boolean>(false);
   const [address, setAddress] = React.useState<Address | null>(null);
   const [product, setProduct] = React.useState<Product | null>(null);
@@ -201,7 +202,6 @@ const TransactionCustomerView = () => {
           setCustomerName(data.first_name + ' ' + data.last_name);
           setCustomerPhone(data.phone);
           setCustomerEmail(data.email);
-          setCustomerBalance(data.balance);
 
           if (data.image_id) {
             const imageResponse = await fetch(`${config.API_URL}/files/${data.image_id}`, {
@@ -363,6 +363,8 @@ const TransactionCustomerView = () => {
 
   let amountBuyer = 0;
   let amountSeller = 0;
+  // The buyer pays in the currency the transaction was priced for them in.
+  const paymentCurrency = (transaction?.payment_currency || transaction?.currency || 'thb').toLowerCase();
 
   if(transaction && product) {
 
@@ -559,33 +561,6 @@ const TransactionCustomerView = () => {
       if (!response.ok) {
         const responseData = await response.json();
         throw new Error(responseData.error || 'Failed to complete transaction');
-      } else {
-
-        if(transaction) {
-
-          const dataUserToSubmit = {
-            balance: (customerBalance + amountSeller) || 0
-          };
-          
-          try {
-            const response = await fetch(`${config.API_URL}/users/${transaction.user_id}?transaction=true`, {
-              method: "PUT",
-              headers: {
-                "Content-Type": "application/json",
-                "token": token || "",
-              },
-              body: JSON.stringify(dataUserToSubmit),
-            });
-        
-            const responseData = await response.json();
-      
-            if (!response.ok) {
-              throw new Error(responseData.error || 'Failed to update user');
-            }
-          } catch (err) {
-            console.error("Update error:", err);
-          }
-        }
       }
 
       window.location.reload();
@@ -655,12 +630,12 @@ const TransactionCustomerView = () => {
     
         const token = localStorage.getItem('token');
         const dataToSubmit = {
-          ...(transaction ? { delivered_at: transaction.delivered_at } : {}),
-          status: 6
+          transaction_id: transaction_id,
+          reason: reason
         };
       
-        const apiResponse = await fetch(`${config.API_URL}/transactions/${transaction_id}`, {
-          method: 'PUT',
+        const apiResponse = await fetch(`${config.API_URL}/disputes`, {
+          method: 'POST',
           headers: {
             'Content-Type': 'application/json',
             'token': token || ''
@@ -670,7 +645,7 @@ const TransactionCustomerView = () => {
     
         if (!apiResponse.ok) {
           const responseData = await apiResponse.json();
-          throw new Error(responseData.error || 'Failed to update transaction');
+          throw new Error(responseData.error || 'Failed to open dispute');
         }
 
         setShowRejectionForm(false);
@@ -736,7 +711,7 @@ const TransactionCustomerView = () => {
     
     const dataToSubmit = {
       amount: amountBuyer,
-      currency: 'thb',
+      currency: paymentCurrency,
       description: 'Transaction #' + transaction_id,
       method: 'card',
     };
@@ -767,103 +742,87 @@ const TransactionCustomerView = () => {
     }
   };
 
+  const handleBalancePayment = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    setIsProcessing(true);
+
+    try {
+      const token = localStorage.getItem('token');
+      const response = await fetch(`${config.API_URL}/pay?transaction=${transaction_id}`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          'token': token || ''
+        },
+        body: JSON.stringify({
+          amount: amountBuyer,
+          currency: paymentCurrency,
+          description: 'Transaction #' + transaction_id,
+          method: 'balance',
+        })
+      });
+
+      const responseData = await response.json();
+
+      if (!response.ok) {
+        throw new Error(
+          responseData.error === 'insufficient_balance'
+            ? 'Your balance is not enough to pay for this transaction'
+            : responseData.error === 'concurrent_update'
+            ? 'Your balance changed while paying, please try again'
+            : responseData.error || 'Error'
+        );
+      }
+
+      window.location.reload();
+    } catch (err) {
+      const errorMessage = err instanceof Error ? err.message : 'Error';
+      setError(errorMessage);
+      toast.error(errorMessage);
+      setIsProcessing(false);
+    }
+  };
+
   const [searchParams] = useSearchParams();
   const paymentID = searchParams.get("payment")
   const paymentStatus = searchParams.get("payment_status")
 
   useEffect(() => {
-    const handlePaymentUpdate = async () => {
-      if(paymentID) {
-        const fetchPayment = async () => {
-          try {
-            const token = localStorage.getItem('token');
-            const response = await fetch(`${config.API_URL}/payments/${paymentID}`, {
-              headers: {
-                'Content-Type': 'application/json',
-                'token': token || ''
-              }
-            });
-    
-            if (!response.ok) throw new Error('Failed to fetch');
-            const data = await response.json();
-
-            if(data.status === 1) {
+    if (!paymentID || !paymentStatus) return;
 
-              let newPaymentStatus;
+    let attempts = 0;
 
-              if(paymentStatus) {
-                if(paymentStatus === "success") {
-                  newPaymentStatus = 2;
-                } else if (paymentStatus === "cancel") {
-                  newPaymentStatus = 3;
-                }
-              }
-
-              if(newPaymentStatus) {
+    const waitForConfirmation = async () => {
+      try {
+        const token = localStorage.getItem('token');
+        const response = await fetch(`${config.API_URL}/payments/${paymentID}`, {
+          headers: {
+            'Content-Type': 'application/json',
+            'token': token || ''
+          }
+        });
 
-                try {
-                  const paymentUpdateData = {
-                    status: newPaymentStatus
-                  };
-        
-                  const responseUpdate = await fetch(`${config.API_URL}/payments/${data.payment_id}`, {
-                    method: 'PUT',
-                    headers: {
-                      'Content-Type': 'application/json',
-                      'token': token || ''
-                    },
-                    body: JSON.stringify(paymentUpdateData)
-                  });
-
-                  if (responseUpdate.ok) {
-
-                    if(newPaymentStatus === 2) {
-
-                      try {
-                        const transactionUpdateData = {
-                          payment_id: data.payment_id,
-                          ...(transaction?.delivered_at ? { delivered_at: transaction.delivered_at } : {})
-                        };
-              
-                        const responseTran = await fetch(`${config.API_URL}/transactions/${transaction_id}`, {
-                          method: 'PUT',
-                          headers: {
-                            'Content-Type': 'application/json',
-                            'token': token || ''
-                          },
-                          body: JSON.stringify(transactionUpdateData)
-                        });
-
-                        if (responseTran.ok) {
-                          window.location.href = `/member/transactions/buy/${transaction_id}`;
-                        }
-                      } catch (updateError) {
-                        console.error('Error updating transaction:', updateError);
-                      }
-                    } else {
-                      window.location.href = `/member/transactions/buy/${transaction_id}`;
-                    }
-                  }
-
-                } catch (updateError) {
-                  console.error('Error updating payment:', updateError);
-                }
-              }
-            }
+        if (!response.ok) throw new Error('Failed to fetch');
+        const data = await response.json();
 
-          } catch (err) {
-            setError(err instanceof Error ? err.message : 'Failed to load address');
-          } finally {
-            setLoading(false);
-          }
-        };
+        // The payment is confirmed by the Stripe webhook, which may land after the redirect.
+        if (data.status === 1 && paymentStatus === "success" && attempts < 10) {
+          attempts++;
+          setTimeout(waitForConfirmation, 2000);
+          return;
+        }
 
-        fetchPayment();
+        window.location.href = `/member/transactions/buy/${transaction_id}`;
+      } catch (err) {
+        setError(err instanceof Error ? err.message : 'Failed to load payment');
+      } finally {
+        setLoading(false);
       }
     };
 
-    handlePaymentUpdate();
-  }, [paymentID, paymentStatus, transaction_id, transaction]);
+    waitForConfirmation();
+  }, [paymentID, paymentStatus, transaction_id]);
 
   const openFullscreen = (type: 'image' | 'video', url: string) => {
     setFullscreenMedia({ type, url });
@@ -1437,6 +1396,15 @@ const TransactionCustomerView = () => {
                         </span>
                       )}
                     </button>
+                    <button
+                      onClick={handleBalancePayment}
+                      disabled={isProcessing}
+                      className={`ml-3 px-6 py-3 bg-white text-cyan-700 border border-cyan-600 font-medium rounded-md transition-colors ${
+                        isProcessing ? 'cursor-not-allowed' : 'hover:bg-cyan-100'
+                      }`}
+                    >
+                      Pay with Balance
+                    </button>
                   </div>
                 </div>
               </div>
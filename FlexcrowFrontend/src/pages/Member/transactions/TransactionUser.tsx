@@ -19,6 +19,7 @@ interface Transaction {
   shipping_image_id: string;
   delivered_at: string;
   delivered_details: string;
+  cancel_reason: string | null;
   fee: GLfloat;
   created_at: string;
   updated_at: string;
@@ -377,7 +378,7 @@ const TransactionUser = () => {
                         ) : transaction.status === 3 ? (
                           'Completed'
                         ) : transaction.status === 4 ? (
-                          'Canceled'
+                          transaction.cancel_reason === 'expired' ? 'Expired' : 'Canceled'
                         ) : transaction.status === 5 ? (
                           'Rejected'
                         ) : transaction.status === 6 ? (
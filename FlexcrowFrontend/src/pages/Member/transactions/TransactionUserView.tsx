@@ -25,6 +25,7 @@ interface Transaction {
   shipping_image_id: string;
   delivered_at: string;
   delivered_details: string;
+  cancel_reason: string | null;
   fee: GLfloat;
   fee_type: 1 | 2 | 3;
   created_at: string;
@@ -917,7 +918,7 @@ const TransactionUserView = () => {
               ) : transaction.status === 3 ? (
                 'Completed'
               ) : transaction.status === 4 ? (
-                'Canceled'
+                transaction.cancel_reason === 'expired' ? 'Expired' : 'Canceled'
               ) : transaction.status === 5 ? (
                 'Rejected'
               ) : transaction.status === 6 ? (
@@ -933,8 +934,8 @@ const TransactionUserView = () => {
           <div className="flex items-center justify-center py-4 mb-4">
             <div className="text-center">
               <AlertCircle className="w-16 h-16 text-red-500 mx-auto mb-4" />
-              <h2 className="text-2xl font-bold text-gray-800 mb-2">Transaction Canceled</h2>
-              <p className="text-gray-600">Please contact us if you need assistance.</p>
+              <h2 className="text-2xl font-bold text-gray-800 mb-2">{transaction.cancel_reason === 'expired' ? 'Transaction Expired' : 'Transaction Canceled'}</h2>
+              <p className="text-gray-600">{transaction.cancel_reason === 'expired' ? 'The buyer did not pay before the offer expired.' : 'Please contact us if you need assistance.'}</p>
             </div>
           </div>
           ) : transaction.status === 5 ? (
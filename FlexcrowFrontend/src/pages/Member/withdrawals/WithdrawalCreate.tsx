@@ -13,6 +13,7 @@ interface WithdrawalFormData {
   amount: string;
   method: string;
   account: string;
+  totp_code: string;
 }
 
 interface UserBalance {
@@ -38,8 +39,10 @@ const WithdrawalCreate = () => {
   const [formData, setFormData] = useState<WithdrawalFormData>({
     amount: '',
     method: '',
-    account: ''
+    account: '',
+    totp_code: ''
   });
+  const [totpEnabled, setTotpEnabled] = useState(false);
 
   const [errors, setErrors] = useState<{ [key: string]: string }>({});
 
@@ -63,6 +66,7 @@ const WithdrawalCreate = () => {
         setUserBalance({
           available: data.balance || 0
         });
+        setTotpEnabled(!!data.totp_enabled);
       } catch (err) {
         console.error('Error fetching balance:', err);
         toast.error('Unable to fetch your current balance');
@@ -132,7 +136,7 @@ const WithdrawalCreate = () => {
         if (responseData.error === 'user_error') {
           setErrors((prev) => ({ ...prev, user_id: 'User not found' }));
         } else {
-          throw new Error(responseData.error || 'Failed to create withdrawal');
+          throw new Error(responseData.message || responseData.error || 'Failed to create withdrawal');
         }
         return;
       }
@@ -251,6 +255,20 @@ const WithdrawalCreate = () => {
               </div>
               {errors.amount && <p className="text-red-500 text-xs mt-1">{errors.amount}</p>}
             </div>
+
+            {totpEnabled && (
+              <div className="mb-6">
+                <label className="block text-sm font-medium text-teal-600 mb-2">Authenticator Code</label>
+                <input
+                  type="text"
+                  inputMode="numeric"
+                  value={formData.totp_code}
+                  onChange={e => setFormData({ ...formData, totp_code: e.target.value })}
+                  className={inputClass}
+                  placeholder="6-digit code from your authenticator app"
+                />
+              </div>
+            )}
           </div>
 
           <div className="bg-gray-50 p-4 rounded-lg mb-8 border border-gray-200">
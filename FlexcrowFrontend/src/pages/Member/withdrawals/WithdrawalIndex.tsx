@@ -7,7 +7,7 @@ import config from '../../../config';
 interface Withdrawal {
   withdrawal_id: string;
   user_id: string;
-  status: 1 | 2 | 3;
+  status: 1 | 2 | 3 | 4 | 5;
   amount: GLfloat;
   method: string;
   account: string;
@@ -171,7 +171,7 @@ const WithdrawalIndex = () => {
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap">
                     <span className="px-3 py-1 inline-flex text-xs leading-5 font-semibold rounded-full bg-teal-100 text-teal-800">
-                      {withdrawal.status === 1 ? 'Pending' : withdrawal.status === 2 ? 'Completed' : 'Canceled'}
+                      {withdrawal.status === 1 ? 'Pending' : withdrawal.status === 4 ? 'Approved' : withdrawal.status === 5 ? 'Processing' : withdrawal.status === 2 ? 'Completed' : 'Canceled'}
                     </span>
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">